@@ -0,0 +1,97 @@
+// backfill-rider-verification อนุมัติไรเดอร์ที่สมัครก่อนมีการตรวจสอบเอกสาร (verificationStatus ยังว่างอยู่)
+// ไรเดอร์กลุ่มนี้ผ่านการคัดกรองแบบเดิมมาแล้ว แต่ไม่มีเอกสารครบ 3 ชิ้น แอดมินจึงอนุมัติผ่าน ApproveRider ไม่ได้
+// ไรเดอร์ที่มีสถานะอยู่แล้ว (รวมถึงที่ถูกปฏิเสธ) จะไม่ถูกแตะ รันซ้ำได้โดยไม่มีผลเสีย
+//
+// วิธีใช้:
+//
+//	go run ./cmd/backfill-rider-verification [-dry-run]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"api-flash-dash/database"
+	"api-flash-dash/model"
+	"api-flash-dash/store"
+)
+
+// reviewer คือค่าที่บันทึกใน reviewedBy เพื่อแยกไรเดอร์ที่อนุมัติด้วยคำสั่งนี้ออกจากที่แอดมินอนุมัติ
+const reviewer = "backfill-rider-verification"
+
+// errHasStatus ใช้ยกเลิก Transaction เมื่อไรเดอร์มีสถานะแล้ว (เช่น ส่งเอกสารระหว่างที่คำสั่งนี้ทำงาน)
+var errHasStatus = errors.New("rider already has a verification status")
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "แสดงรายการที่จะเปลี่ยนโดยไม่เขียนจริง")
+	flag.Parse()
+
+	if os.Getenv("STORAGE_BACKEND") == "memory" {
+		log.Fatalf("backfill-rider-verification needs a persistent backend, STORAGE_BACKEND=memory has no riders to backfill")
+	}
+	app, _, err := database.InitFirebase()
+	if err != nil {
+		log.Fatalf("Could not initialize Firebase: %v", err)
+	}
+	stores, closeStore, err := database.InitStore(app)
+	if err != nil {
+		log.Fatalf("Could not initialize database: %v", err)
+	}
+	defer closeStore()
+
+	// เอกสารไรเดอร์เก่าไม่มีฟิลด์ verificationStatus เลย จึง query ด้วยค่าว่างไม่ได้ ต้องไล่จากผู้ใช้ที่เป็นไรเดอร์
+	ctx := context.Background()
+	users, err := stores.Users.ListUsersByRole(ctx, model.RoleRider)
+	if err != nil {
+		log.Fatalf("Could not list riders: %v", err)
+	}
+
+	approved, skipped, failed := 0, 0, 0
+	for _, user := range users {
+		rider, err := stores.Riders.GetRider(ctx, user.UID)
+		if errors.Is(err, store.ErrNotFound) {
+			log.Printf("Skipping %s: no riders document", user.UID)
+			failed++
+			continue
+		}
+		if err != nil {
+			log.Printf("Skipping %s: %v", user.UID, err)
+			failed++
+			continue
+		}
+		if rider.VerificationStatus != "" {
+			skipped++
+			continue
+		}
+		log.Printf("Approving %s", user.UID)
+		if *dryRun {
+			approved++
+			continue
+		}
+		err = stores.Riders.UpdateRider(ctx, user.UID, func(rider *model.Rider) error {
+			if rider.VerificationStatus != "" {
+				return errHasStatus
+			}
+			now := time.Now()
+			rider.VerificationStatus = model.RiderApproved
+			rider.ReviewedBy = reviewer
+			rider.ReviewedAt = &now
+			return nil
+		})
+		if errors.Is(err, errHasStatus) {
+			skipped++
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to approve %s: %v", user.UID, err)
+			failed++
+			continue
+		}
+		approved++
+	}
+	log.Printf("Done: %d approved, %d already have a status, %d skipped or failed", approved, skipped, failed)
+}
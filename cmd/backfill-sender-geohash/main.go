@@ -0,0 +1,75 @@
+// backfill-sender-geohash เติม senderGeohash ให้ deliveries ที่สร้างก่อนมีการค้นหางานตามพื้นที่
+// (GetPendingDeliveries ค้นหาด้วยช่วงของ senderGeohash จึงไม่เห็นงานที่ไม่มีฟิลด์นี้)
+// เติมให้ทุกสถานะ เพราะงานที่รับไปแล้วอาจถูกคืนกลับมาเป็น pending ภายหลัง
+// รันซ้ำได้โดยไม่มีผลเสีย
+//
+// วิธีใช้:
+//
+//	go run ./cmd/backfill-sender-geohash [-dry-run]
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"api-flash-dash/database"
+	"api-flash-dash/geo"
+	"api-flash-dash/model"
+	"api-flash-dash/store"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "แสดงรายการที่จะเปลี่ยนโดยไม่เขียนจริง")
+	flag.Parse()
+
+	if os.Getenv("STORAGE_BACKEND") == "memory" {
+		log.Fatalf("backfill-sender-geohash needs a persistent backend, STORAGE_BACKEND=memory has no deliveries to backfill")
+	}
+	app, _, err := database.InitFirebase()
+	if err != nil {
+		log.Fatalf("Could not initialize Firebase: %v", err)
+	}
+	stores, closeStore, err := database.InitStore(app)
+	if err != nil {
+		log.Fatalf("Could not initialize database: %v", err)
+	}
+	defer closeStore()
+
+	ctx := context.Background()
+	deliveries, err := stores.Deliveries.ListDeliveries(ctx, store.DeliveryFilter{})
+	if err != nil {
+		log.Fatalf("Could not list deliveries: %v", err)
+	}
+
+	updated, skipped, failed := 0, 0, 0
+	for _, delivery := range deliveries {
+		if delivery.SenderGeohash != "" {
+			skipped++
+			continue
+		}
+		pickup := delivery.SenderAddress.Coordinates
+		if pickup == (model.Coordinates{}) {
+			log.Printf("Skipping %s: sender address has no coordinates", delivery.ID)
+			failed++
+			continue
+		}
+		log.Printf("Setting senderGeohash of %s", delivery.ID)
+		if *dryRun {
+			updated++
+			continue
+		}
+		err := stores.Deliveries.UpdateDelivery(ctx, delivery.ID, func(d *model.Delivery) (*store.DeliveryWrite, error) {
+			d.SenderGeohash = geo.Encode(d.SenderAddress.Coordinates.Latitude, d.SenderAddress.Coordinates.Longitude, geo.DefaultPrecision)
+			return nil, nil
+		})
+		if err != nil {
+			log.Printf("Failed to update %s: %v", delivery.ID, err)
+			failed++
+			continue
+		}
+		updated++
+	}
+	log.Printf("Done: %d updated, %d already set, %d skipped or failed", updated, skipped, failed)
+}
@@ -0,0 +1,63 @@
+// bootstrap-admin ให้สิทธิ์แอดมินกับบัญชีที่สมัครไว้แล้ว
+// ใช้สร้างแอดมินคนแรก หลังจากนั้นแอดมินให้สิทธิ์กันเองได้ผ่าน POST /api/admin/users/{uid}/admin
+//
+// วิธีใช้:
+//
+//	go run ./cmd/bootstrap-admin -phone 0812345678
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"api-flash-dash/database"
+	"api-flash-dash/middleware"
+	"api-flash-dash/model"
+	"api-flash-dash/phone"
+	"api-flash-dash/store"
+)
+
+func main() {
+	rawPhone := flag.String("phone", "", "เบอร์โทรของบัญชีที่ต้องการให้เป็นแอดมิน")
+	flag.Parse()
+	if *rawPhone == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// 1. เชื่อมต่อ Firebase และฐานข้อมูล (อ่านการตั้งค่าจาก .env เหมือนเซิร์ฟเวอร์)
+	if os.Getenv("STORAGE_BACKEND") == "memory" {
+		log.Fatalf("bootstrap-admin needs a persistent backend, STORAGE_BACKEND=memory would lose the change")
+	}
+	app, authClient, err := database.InitFirebase()
+	if err != nil {
+		log.Fatalf("Could not initialize Firebase: %v", err)
+	}
+	stores, closeStore, err := database.InitStore(app)
+	if err != nil {
+		log.Fatalf("Could not initialize database: %v", err)
+	}
+	defer closeStore()
+
+	// 2. หาบัญชีจากเบอร์โทร (ต้องสมัครผ่าน /auth/register/* มาก่อน)
+	ctx := context.Background()
+	phoneE164, err := phone.Normalize(*rawPhone)
+	if err != nil {
+		log.Fatalf("Invalid phone number %s: %v", *rawPhone, err)
+	}
+	user, err := stores.Users.FindUserByPhone(ctx, phoneE164)
+	if err != nil {
+		log.Fatalf("Could not find a registered user with phone %s: %v", phoneE164, err)
+	}
+	// 3. เปลี่ยน role เป็น "admin" ทั้งใน custom claims (ใช้ตรวจสิทธิ์) และใน "users"
+	role := model.RoleAdmin
+	if err := authClient.SetCustomUserClaims(ctx, user.UID, middleware.RoleClaims(role)); err != nil {
+		log.Fatalf("Could not set admin role claim: %v", err)
+	}
+	if err := stores.Users.UpdateUser(ctx, user.UID, store.UserUpdate{Role: &role}); err != nil {
+		log.Fatalf("Could not grant admin role: %v", err)
+	}
+	log.Printf("User %s (%s) is now an admin, the role takes effect on their next sign-in", user.UID, user.Name)
+}
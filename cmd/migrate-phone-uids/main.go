@@ -0,0 +1,357 @@
+// migrate-phone-uids ย้ายบัญชีที่สมัครก่อนมี phone.Normalize ไปใช้ UID รูปแบบ E.164
+// เช่น UID "0812345678" หรือ "081-234-5678" จะกลายเป็น "+66812345678"
+//
+// สิ่งที่ย้ายให้ต่อ 1 บัญชี:
+//   - ผู้ใช้ใน Firebase Auth (import ใหม่พร้อมรหัสผ่านเดิม แล้วลบ UID เก่า)
+//   - "users/{uid}" และ "riders/{uid}" รวมทุก sub-collection (addresses, notifications, ratings, ledger)
+//   - senderUID / receiverUID / riderUID ใน "deliveries" และ actorUID ใน statusHistory
+//   - คะแนนที่บัญชีนี้เคยให้ไรเดอร์คนอื่น (รหัสเอกสารมี UID ของผู้ให้คะแนนอยู่ด้วย)
+//
+// บัญชีที่ UID ใหม่มีอยู่แล้ว (สมัครซ้ำด้วยเบอร์รูปแบบอื่น) จะถูกข้ามและต้องรวมข้อมูลเอง
+// ยกเว้นผู้ใช้ UID ใหม่ที่คำสั่งนี้ import ไว้ในการรันครั้งก่อนที่ล้มเหลวกลางทาง ซึ่งจะถูกย้ายต่อจนเสร็จ
+//
+// Firebase Auth ไม่ให้อ่านรหัสผ่าน จึงต้องใส่พารามิเตอร์ hash ของโปรเจกต์
+// (Firebase Console > Authentication > Users > ⋮ > Password hash parameters)
+// ควรรันด้วย -dry-run ก่อนทุกครั้ง
+//
+// วิธีใช้:
+//
+//	go run ./cmd/migrate-phone-uids -dry-run
+//	go run ./cmd/migrate-phone-uids -hash-key <base64_signer_key> -salt-separator <base64_salt_separator> -rounds 8 -memory-cost 14
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"api-flash-dash/database"
+	"api-flash-dash/phone"
+	"api-flash-dash/store"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/v4/auth"
+	"firebase.google.com/go/v4/auth/hash"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// uidFields คือฟิลด์ที่เก็บ UID (หรือเบอร์โทรที่เป็น UID) และต้องเปลี่ยนตาม
+var uidFields = []string{"phone", "senderUID", "receiverUID", "riderUID", "raterUID", "actorUID"}
+
+type migrator struct {
+	client     *firestore.Client
+	authClient *auth.Client
+	hash       hash.Scrypt
+}
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "แสดงรายการที่จะย้ายโดยไม่เขียนจริง")
+	hashKey := flag.String("hash-key", "", "base64_signer_key ของโปรเจกต์")
+	saltSeparator := flag.String("salt-separator", "", "base64_salt_separator ของโปรเจกต์")
+	rounds := flag.Int("rounds", 8, "rounds ของ scrypt")
+	memoryCost := flag.Int("memory-cost", 14, "mem_cost ของ scrypt")
+	flag.Parse()
+
+	if os.Getenv("STORAGE_BACKEND") == "memory" {
+		log.Fatalf("migrate-phone-uids needs a persistent backend, STORAGE_BACKEND=memory has no users to migrate")
+	}
+	// 1. อ่านพารามิเตอร์ hash (ไม่ต้องใช้ถ้าแค่ดูรายการ)
+	var scrypt hash.Scrypt
+	if !*dryRun {
+		key, err := base64.StdEncoding.DecodeString(*hashKey)
+		if err != nil || len(key) == 0 {
+			log.Fatalf("-hash-key is required and must be base64 (or use -dry-run)")
+		}
+		separator, err := base64.StdEncoding.DecodeString(*saltSeparator)
+		if err != nil {
+			log.Fatalf("-salt-separator must be base64: %v", err)
+		}
+		scrypt = hash.Scrypt{Key: key, SaltSeparator: separator, Rounds: *rounds, MemoryCost: *memoryCost}
+	}
+
+	// 2. เชื่อมต่อ Firebase (คำสั่งนี้ทำงานกับ Firestore โดยตรง เพราะต้องย้ายทุก sub-collection)
+	app, authClient, err := database.InitFirebase()
+	if err != nil {
+		log.Fatalf("Could not initialize Firebase: %v", err)
+	}
+	ctx := context.Background()
+	client, err := app.Firestore(ctx)
+	if err != nil {
+		log.Fatalf("Could not initialize database: %v", err)
+	}
+	defer client.Close()
+	m := &migrator{client: client, authClient: authClient, hash: scrypt}
+
+	// 3. โหลดผู้ใช้ใน Auth ทั้งหมด (ต้องใช้ iterator เพราะ GetUser ไม่คืน password hash)
+	accounts := map[string]*auth.ExportedUserRecord{}
+	users := authClient.Users(ctx, "")
+	for {
+		record, err := users.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Fatalf("Could not list Auth users: %v", err)
+		}
+		accounts[record.UID] = record
+	}
+
+	// 4. ไล่ทุกเอกสารใน "users" แล้วย้ายเฉพาะที่ UID ยังไม่ใช่ E.164
+	docs, err := client.Collection("users").DocumentRefs(ctx).GetAll()
+	if err != nil {
+		log.Fatalf("Could not list users: %v", err)
+	}
+	migrated, skipped, failed := 0, 0, 0
+	for _, doc := range docs {
+		oldUID := doc.ID
+		if phone.IsNormalized(oldUID) {
+			skipped++
+			continue
+		}
+		newUID, err := phone.Normalize(oldUID)
+		if err != nil {
+			log.Printf("Skipping %s: not a Thai mobile number, fix it by hand", oldUID)
+			failed++
+			continue
+		}
+		account, ok := accounts[oldUID]
+		if !ok {
+			log.Printf("Skipping %s: no Firebase Auth user with this UID", oldUID)
+			failed++
+			continue
+		}
+		// ผู้ใช้ UID ใหม่ที่ import จากบัญชีนี้ในการรันครั้งก่อน (ล้มเหลวกลางทาง) ให้ทำต่อจากเดิม
+		// ส่วนบัญชีที่สมัครเองด้วยเบอร์รูปแบบใหม่ต้องรวมข้อมูลเอง
+		existing, taken := accounts[newUID]
+		resume := taken && importedFrom(account, existing)
+		if taken && !resume {
+			log.Printf("Skipping %s: %s is already registered, the two accounts must be merged by hand", oldUID, newUID)
+			failed++
+			continue
+		}
+		if !resume {
+			if exists, err := m.exists(ctx, client.Collection("users").Doc(newUID)); err != nil || exists {
+				log.Printf("Skipping %s: users/%s already exists or could not be checked (%v)", oldUID, newUID, err)
+				failed++
+				continue
+			}
+		}
+
+		if resume {
+			log.Printf("Resuming %s -> %s (Auth user was imported by a previous run)", oldUID, newUID)
+		} else {
+			log.Printf("Migrating %s -> %s", oldUID, newUID)
+		}
+		if *dryRun {
+			migrated++
+			continue
+		}
+		if err := m.migrate(ctx, account, newUID, resume); err != nil {
+			log.Printf("Failed to migrate %s: %v", oldUID, err)
+			failed++
+			continue
+		}
+		migrated++
+	}
+	log.Printf("Done: %d migrated, %d already E.164, %d skipped or failed", migrated, skipped, failed)
+}
+
+// migrate ย้ายบัญชี 1 บัญชี ถ้าล้มเหลวกลางทางให้รันคำสั่งซ้ำ จะทำต่อด้วย resume = true (ข้ามการ import)
+// ทุกขั้นตอนหลังจากนั้นเขียนทับหรืออัปเดตซ้ำได้ และข้อมูลเก่าจะถูกลบหลังจากคัดลอกและอัปเดตการอ้างอิงครบแล้วเท่านั้น
+func (m *migrator) migrate(ctx context.Context, account *auth.ExportedUserRecord, newUID string, resume bool) error {
+	oldUID := account.UID
+
+	// 1. สร้างผู้ใช้ใน Auth ด้วย UID และอีเมลสังเคราะห์ใหม่ โดยใช้ password hash เดิม
+	if !resume {
+		if err := m.importAccount(ctx, account, newUID); err != nil {
+			return fmt.Errorf("import Auth user: %w", err)
+		}
+	}
+
+	// 2. คัดลอกเอกสารของผู้ใช้และไรเดอร์ไปยัง UID ใหม่
+	for _, collection := range []string{"users", "riders"} {
+		src := m.client.Collection(collection).Doc(oldUID)
+		dst := m.client.Collection(collection).Doc(newUID)
+		if err := m.copyTree(ctx, src, dst, oldUID, newUID); err != nil {
+			return fmt.Errorf("copy %s: %w", src.Path, err)
+		}
+	}
+
+	// 3. อัปเดตการอ้างอิงใน deliveries และคะแนนที่เคยให้ไว้
+	if err := m.rekeyDeliveries(ctx, oldUID, newUID); err != nil {
+		return fmt.Errorf("update deliveries: %w", err)
+	}
+	if err := m.rekeyRatings(ctx, oldUID, newUID); err != nil {
+		return fmt.Errorf("update ratings: %w", err)
+	}
+
+	// 4. ลบข้อมูลเก่า
+	for _, collection := range []string{"users", "riders"} {
+		if err := m.deleteTree(ctx, m.client.Collection(collection).Doc(oldUID)); err != nil {
+			return fmt.Errorf("delete %s/%s: %w", collection, oldUID, err)
+		}
+	}
+	// เอกสาร users เก่าถูกลบแล้ว การรันซ้ำจะไม่เห็นบัญชีนี้อีก ถ้าขั้นตอนนี้ล้มเหลวต้องลบผู้ใช้ใน Auth เอง
+	if err := m.authClient.DeleteUser(ctx, oldUID); err != nil && !auth.IsUserNotFound(err) {
+		return fmt.Errorf("delete Auth user %s (data is migrated, delete it by hand): %w", oldUID, err)
+	}
+	return nil
+}
+
+// importedFrom บอกว่าผู้ใช้ UID ใหม่ใน Auth ถูก import จาก account โดยคำสั่งนี้
+// (อีเมลสังเคราะห์ตรงกับ UID ใหม่ และใช้ password hash เดียวกัน ซึ่งการสมัครเองจะไม่มีทางได้ hash เดียวกัน)
+func importedFrom(account, imported *auth.ExportedUserRecord) bool {
+	return imported.Email == imported.UID+"@flashdash.app" &&
+		imported.PasswordHash == account.PasswordHash &&
+		imported.PasswordSalt == account.PasswordSalt
+}
+
+func (m *migrator) importAccount(ctx context.Context, account *auth.ExportedUserRecord, newUID string) error {
+	user := (&auth.UserToImport{}).
+		UID(newUID).
+		Email(newUID + "@flashdash.app").
+		DisplayName(account.DisplayName).
+		PhotoURL(account.PhotoURL).
+		Disabled(account.Disabled)
+	if len(account.CustomClaims) > 0 {
+		user.CustomClaims(account.CustomClaims)
+	}
+	if account.PasswordHash != "" {
+		passwordHash, err := base64.URLEncoding.DecodeString(account.PasswordHash)
+		if err != nil {
+			return fmt.Errorf("decode password hash: %w", err)
+		}
+		salt, err := base64.URLEncoding.DecodeString(account.PasswordSalt)
+		if err != nil {
+			return fmt.Errorf("decode password salt: %w", err)
+		}
+		user.PasswordHash(passwordHash).PasswordSalt(salt)
+	}
+
+	result, err := m.authClient.ImportUsers(ctx, []*auth.UserToImport{user}, auth.WithHash(m.hash))
+	if err != nil {
+		return err
+	}
+	if result.FailureCount > 0 {
+		return fmt.Errorf("%s", result.Errors[0].Reason)
+	}
+	return nil
+}
+
+// copyTree คัดลอกเอกสารพร้อมทุก sub-collection และเปลี่ยน UID เก่าในฟิลด์ uidFields เป็น UID ใหม่
+func (m *migrator) copyTree(ctx context.Context, src, dst *firestore.DocumentRef, oldUID, newUID string) error {
+	snap, err := src.Get(ctx)
+	// เอกสารที่ไม่มีข้อมูลแต่มี sub-collection ยังต้องไล่ลงไปต่อ
+	if err != nil && status.Code(err) != codes.NotFound {
+		return err
+	}
+	if err == nil {
+		data := snap.Data()
+		for _, field := range uidFields {
+			if value, ok := data[field].(string); ok && value == oldUID {
+				data[field] = newUID
+			}
+		}
+		if _, err := dst.Set(ctx, data); err != nil {
+			return err
+		}
+	}
+
+	collections, err := src.Collections(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, collection := range collections {
+		refs, err := collection.DocumentRefs(ctx).GetAll()
+		if err != nil {
+			return err
+		}
+		for _, ref := range refs {
+			if err := m.copyTree(ctx, ref, dst.Collection(collection.ID).Doc(ref.ID), oldUID, newUID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deleteTree ลบเอกสารพร้อมทุก sub-collection (Firestore ไม่ลบ sub-collection ให้เอง)
+func (m *migrator) deleteTree(ctx context.Context, ref *firestore.DocumentRef) error {
+	collections, err := ref.Collections(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, collection := range collections {
+		refs, err := collection.DocumentRefs(ctx).GetAll()
+		if err != nil {
+			return err
+		}
+		for _, child := range refs {
+			if err := m.deleteTree(ctx, child); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = ref.Delete(ctx)
+	return err
+}
+
+// rekeyDeliveries เปลี่ยน UID ใน deliveries ที่บัญชีนี้เป็นผู้ส่ง ผู้รับ หรือไรเดอร์ รวมถึงประวัติสถานะ
+func (m *migrator) rekeyDeliveries(ctx context.Context, oldUID, newUID string) error {
+	for _, field := range []string{"senderUID", "receiverUID", "riderUID"} {
+		docs, err := m.client.Collection("deliveries").Where(field, "==", oldUID).Documents(ctx).GetAll()
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			if _, err := doc.Ref.Update(ctx, []firestore.Update{{Path: field, Value: newUID}}); err != nil {
+				return err
+			}
+			history, err := doc.Ref.Collection("statusHistory").Where("actorUID", "==", oldUID).Documents(ctx).GetAll()
+			if err != nil {
+				return err
+			}
+			for _, change := range history {
+				if _, err := change.Ref.Update(ctx, []firestore.Update{{Path: "actorUID", Value: newUID}}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// rekeyRatings ย้ายคะแนนที่บัญชีนี้ให้ไรเดอร์คนอื่นไปยังรหัสเอกสารใหม่ (store.RatingID)
+// เพื่อให้การกันให้คะแนนซ้ำยังใช้ได้หลังเปลี่ยน UID
+// หมายเหตุ: query แบบ collection group ต้องเปิด single-field index ของ ratings.raterUID ก่อน
+func (m *migrator) rekeyRatings(ctx context.Context, oldUID, newUID string) error {
+	docs, err := m.client.CollectionGroup("ratings").Where("raterUID", "==", oldUID).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		data := doc.Data()
+		data["raterUID"] = newUID
+		deliveryID, _ := data["deliveryId"].(string)
+		batch := m.client.Batch()
+		batch.Set(doc.Ref.Parent.Doc(store.RatingID(deliveryID, newUID)), data)
+		batch.Delete(doc.Ref)
+		if _, err := batch.Commit(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *migrator) exists(ctx context.Context, ref *firestore.DocumentRef) (bool, error) {
+	_, err := ref.Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
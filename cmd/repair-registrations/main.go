@@ -0,0 +1,205 @@
+// repair-registrations หาและซ่อมบัญชีที่สมัครไม่สำเร็จแต่ค้างอยู่ครึ่งทาง (ก่อนมีการย้อนกลับแบบ saga ใน handler.registration
+// หรือกรณีที่ขั้นตอนย้อนกลับเองล้มเหลว) บัญชีแบบนี้ทำให้เบอร์นั้นสมัครใหม่ไม่ได้ ("already registered")
+//
+// สิ่งที่ถือว่าค้าง:
+//   - ผู้ใช้ใน Firebase Auth ที่ไม่มี "users/{uid}"
+//   - "users/{uid}" ที่ไม่มีผู้ใช้ใน Firebase Auth
+//   - ไรเดอร์ที่มี "users/{uid}" แต่ไม่มี "riders/{uid}"
+//
+// การซ่อมคือลบทั้งผู้ใช้ใน Auth และเอกสารที่เหลือ (พร้อม sub-collection) เพื่อให้สมัครใหม่ได้
+// ข้ามบัญชีที่อายุน้อยกว่า -min-age (อาจกำลังสมัครอยู่) บัญชีที่ไม่ได้สมัครผ่าน API (UID ไม่ใช่เบอร์ E.164)
+// และบัญชีที่มี delivery อ้างถึงแล้ว (ต้องตรวจสอบเอง)
+// ควรรันด้วย -dry-run ก่อนทุกครั้ง
+//
+// วิธีใช้:
+//
+//	go run ./cmd/repair-registrations -dry-run
+//	go run ./cmd/repair-registrations -min-age 1h
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"api-flash-dash/database"
+	"api-flash-dash/model"
+	"api-flash-dash/phone"
+	"api-flash-dash/store"
+
+	"firebase.google.com/go/v4/auth"
+	"google.golang.org/api/iterator"
+)
+
+// syntheticEmailDomain ต้องตรงกับ handler.syntheticEmail
+const syntheticEmailDomain = "@flashdash.app"
+
+type repairer struct {
+	stores     *store.Store
+	authClient *auth.Client
+	dryRun     bool
+	cutoff     time.Time
+
+	repaired, skipped, failed int
+}
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "แสดงรายการที่จะซ่อมโดยไม่ลบจริง")
+	minAge := flag.Duration("min-age", time.Hour, "ข้ามบัญชีที่สร้างไม่ถึงระยะเวลานี้ (อาจกำลังสมัครอยู่)")
+	flag.Parse()
+
+	if os.Getenv("STORAGE_BACKEND") == "memory" {
+		log.Fatalf("repair-registrations needs a persistent backend, STORAGE_BACKEND=memory has nothing to repair")
+	}
+	app, authClient, err := database.InitFirebase()
+	if err != nil {
+		log.Fatalf("Could not initialize Firebase: %v", err)
+	}
+	stores, closeStore, err := database.InitStore(app)
+	if err != nil {
+		log.Fatalf("Could not initialize database: %v", err)
+	}
+	defer closeStore()
+
+	ctx := context.Background()
+	r := &repairer{stores: stores, authClient: authClient, dryRun: *dryRun, cutoff: time.Now().Add(-*minAge)}
+
+	// 1. ผู้ใช้ใน Auth ที่ไม่มีเอกสาร "users" หรือเป็นไรเดอร์ที่ไม่มีเอกสาร "riders"
+	iter := authClient.Users(ctx, "")
+	for {
+		record, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Fatalf("Could not list auth users: %v", err)
+		}
+		r.checkAuthUser(ctx, record)
+	}
+
+	// 2. เอกสาร "users" ที่ไม่มีผู้ใช้ใน Auth (ย้อนกลับไม่ครบ)
+	users, err := stores.Users.ListUsersByRole(ctx, "")
+	if err != nil {
+		log.Fatalf("Could not list users: %v", err)
+	}
+	for _, user := range users {
+		r.checkUserDocument(ctx, user)
+	}
+
+	log.Printf("Done: %d repaired, %d skipped, %d failed", r.repaired, r.skipped, r.failed)
+}
+
+func (r *repairer) checkAuthUser(ctx context.Context, record *auth.ExportedUserRecord) {
+	uid := record.UID
+	if !phone.IsNormalized(uid) || record.Email != uid+syntheticEmailDomain {
+		return // ไม่ได้สมัครผ่าน API (เช่น สร้างจาก Firebase Console)
+	}
+	user, err := r.stores.Users.GetUser(ctx, uid)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("Skipping %s: %v", uid, err)
+		r.failed++
+		return
+	}
+
+	var problem string
+	switch {
+	case user == nil:
+		problem = "auth user without users document"
+	case user.Role == model.RoleRider:
+		_, err := r.stores.Riders.GetRider(ctx, uid)
+		if err == nil {
+			return
+		}
+		if !errors.Is(err, store.ErrNotFound) {
+			log.Printf("Skipping %s: %v", uid, err)
+			r.failed++
+			return
+		}
+		problem = "rider without riders document"
+	default:
+		return
+	}
+
+	created := time.Unix(0, record.UserMetadata.CreationTimestamp*int64(time.Millisecond))
+	if created.After(r.cutoff) {
+		log.Printf("Skipping %s (%s): created %s, may still be registering", uid, problem, created.Format(time.RFC3339))
+		r.skipped++
+		return
+	}
+	r.repair(ctx, uid, problem, true)
+}
+
+func (r *repairer) checkUserDocument(ctx context.Context, user model.UserProfile) {
+	if !phone.IsNormalized(user.UID) {
+		return // UID รูปแบบเก่า ให้ย้ายด้วย cmd/migrate-phone-uids ก่อน
+	}
+	_, err := r.authClient.GetUser(ctx, user.UID)
+	if err == nil {
+		return
+	}
+	if !auth.IsUserNotFound(err) {
+		log.Printf("Skipping %s: %v", user.UID, err)
+		r.failed++
+		return
+	}
+	r.repair(ctx, user.UID, "users document without auth user", false)
+}
+
+// repair ลบบัญชีที่ค้าง ถ้ายังไม่มี delivery อ้างถึง
+func (r *repairer) repair(ctx context.Context, uid, problem string, hasAuthUser bool) {
+	referenced, err := r.hasDeliveries(ctx, uid)
+	if err != nil {
+		log.Printf("Skipping %s: %v", uid, err)
+		r.failed++
+		return
+	}
+	if referenced {
+		log.Printf("Skipping %s (%s): referenced by deliveries, please review manually", uid, problem)
+		r.skipped++
+		return
+	}
+
+	log.Printf("Repairing %s: %s", uid, problem)
+	if r.dryRun {
+		r.repaired++
+		return
+	}
+	// ลบเอกสารก่อน แล้วค่อยลบผู้ใช้ใน Auth (ถ้าล้มเหลวกลางทาง รันซ้ำจะพบบัญชีนี้อีก)
+	if err := r.stores.Riders.DeleteRider(ctx, uid); err != nil {
+		log.Printf("Failed to delete rider %s: %v", uid, err)
+		r.failed++
+		return
+	}
+	if err := r.stores.Users.DeleteUser(ctx, uid); err != nil {
+		log.Printf("Failed to delete user %s: %v", uid, err)
+		r.failed++
+		return
+	}
+	if hasAuthUser {
+		if err := r.authClient.DeleteUser(ctx, uid); err != nil && !auth.IsUserNotFound(err) {
+			log.Printf("Failed to delete auth user %s: %v", uid, err)
+			r.failed++
+			return
+		}
+	}
+	r.repaired++
+}
+
+// hasDeliveries บอกว่ามี delivery ที่ uid เป็นผู้ส่ง ผู้รับ หรือไรเดอร์อยู่หรือไม่
+func (r *repairer) hasDeliveries(ctx context.Context, uid string) (bool, error) {
+	filters := []store.DeliveryFilter{{SenderUID: uid}, {ReceiverUID: uid}, {RiderUID: uid}}
+	for _, filter := range filters {
+		filter.Limit = 1
+		deliveries, err := r.stores.Deliveries.ListDeliveries(ctx, filter)
+		if err != nil {
+			return false, err
+		}
+		if len(deliveries) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
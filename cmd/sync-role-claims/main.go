@@ -0,0 +1,73 @@
+// sync-role-claims ตั้งค่า custom claim "role" ใน Firebase Auth ให้ตรงกับฟิลด์ role ใน "users"
+// ใช้ครั้งเดียวกับบัญชีที่สมัครก่อนมี middleware.RequireRole (Token ของบัญชีเหล่านั้นยังไม่มี role)
+// รันซ้ำได้โดยไม่มีผลเสีย
+//
+// วิธีใช้:
+//
+//	go run ./cmd/sync-role-claims [-dry-run]
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"api-flash-dash/database"
+	"api-flash-dash/middleware"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "แสดงรายการที่จะเปลี่ยนโดยไม่เขียนจริง")
+	flag.Parse()
+
+	if os.Getenv("STORAGE_BACKEND") == "memory" {
+		log.Fatalf("sync-role-claims needs a persistent backend, STORAGE_BACKEND=memory has no users to sync")
+	}
+	app, authClient, err := database.InitFirebase()
+	if err != nil {
+		log.Fatalf("Could not initialize Firebase: %v", err)
+	}
+	stores, closeStore, err := database.InitStore(app)
+	if err != nil {
+		log.Fatalf("Could not initialize database: %v", err)
+	}
+	defer closeStore()
+
+	ctx := context.Background()
+	users, err := stores.Users.ListUsersByRole(ctx, "")
+	if err != nil {
+		log.Fatalf("Could not list users: %v", err)
+	}
+
+	updated, skipped, failed := 0, 0, 0
+	for _, user := range users {
+		if user.Role == "" {
+			log.Printf("Skipping %s: no role in users document", user.UID)
+			skipped++
+			continue
+		}
+		record, err := authClient.GetUser(ctx, user.UID)
+		if err != nil {
+			log.Printf("Skipping %s: %v", user.UID, err)
+			failed++
+			continue
+		}
+		if record.CustomClaims[middleware.RoleClaim] == user.Role {
+			skipped++
+			continue
+		}
+		log.Printf("Setting role of %s to %q", user.UID, user.Role)
+		if *dryRun {
+			updated++
+			continue
+		}
+		if err := authClient.SetCustomUserClaims(ctx, user.UID, middleware.RoleClaims(user.Role)); err != nil {
+			log.Printf("Failed to set role of %s: %v", user.UID, err)
+			failed++
+			continue
+		}
+		updated++
+	}
+	log.Printf("Done: %d updated, %d already in sync or skipped, %d failed", updated, skipped, failed)
+}
@@ -5,15 +5,16 @@ import (
 	"log" // เพิ่ม log เข้ามาเผื่อ debug
 	"os"   // Import 'os' เพื่ออ่าน Environment Variables
 
-	"cloud.google.com/go/firestore"
+	"api-flash-dash/store"
+
 	firebase "firebase.google.com/go/v4"
 	"firebase.google.com/go/v4/auth"
 	"github.com/joho/godotenv" // <-- Import ไลบรารีที่เพิ่งติดตั้ง
 	"google.golang.org/api/option"
 )
 
-// InitFirebase ทำหน้าที่เชื่อมต่อ Firebase และคืนค่า Clients กลับไป
-func InitFirebase() (*firestore.Client, *auth.Client, error) {
+// InitFirebase ทำหน้าที่เชื่อมต่อ Firebase และคืนค่า App กับ Auth Client กลับไป
+func InitFirebase() (*firebase.App, *auth.Client, error) {
 	// --- ส่วนที่แก้ไข ---
 	// 1. โหลดค่าจากไฟล์ .env เข้าสู่ระบบ
 	err := godotenv.Load()
@@ -21,23 +22,22 @@ func InitFirebase() (*firestore.Client, *auth.Client, error) {
 		log.Printf("Warning: .env file not found, reading from environment variables")
 	}
 
+	ctx := context.Background()
+	var app *firebase.App
+
 	// 2. อ่านค่า Path ของไฟล์ Key จาก Environment Variable
 	credentialsPath := os.Getenv("FIREBASE_CREDENTIALS_PATH")
-	if credentialsPath == "" {
+	if credentialsPath != "" {
+		// 3. ใช้ Path ที่อ่านได้จาก .env ในการเชื่อมต่อ
+		opt := option.WithCredentialsFile(credentialsPath)
+		app, err = firebase.NewApp(ctx, nil, opt)
+	} else if os.Getenv("FIREBASE_AUTH_EMULATOR_HOST") != "" {
+		// ไม่มีไฟล์ Key แต่ชี้ไปที่ Auth Emulator ให้ใช้ Project ID อย่างเดียว (ไม่ต้องมีโปรเจกต์ Firebase จริง)
+		app, err = firebase.NewApp(ctx, &firebase.Config{ProjectID: os.Getenv("FIREBASE_PROJECT_ID")})
+	} else {
 		log.Fatalf("FIREBASE_CREDENTIALS_PATH environment variable not set")
 	}
 	// --- จบส่วนแก้ไข ---
-
-	ctx := context.Background()
-	// 3. ใช้ Path ที่อ่านได้จาก .env ในการเชื่อมต่อ
-	opt := option.WithCredentialsFile(credentialsPath)
-
-	app, err := firebase.NewApp(ctx, nil, opt)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	firestoreClient, err := app.Firestore(ctx)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -47,5 +47,25 @@ func InitFirebase() (*firestore.Client, *auth.Client, error) {
 		return nil, nil, err
 	}
 
-	return firestoreClient, authClient, nil
-}
\ No newline at end of file
+	return app, authClient, nil
+}
+
+// InitStore เลือก backend สำหรับเก็บข้อมูลตาม STORAGE_BACKEND
+// "firestore" (ค่าเริ่มต้น) หรือ "memory" สำหรับรันแบบไม่ต้องใช้ Firestore
+// ฟังก์ชันที่คืนกลับไปใช้สำหรับปิดการเชื่อมต่อตอนปิดเซิร์ฟเวอร์
+func InitStore(app *firebase.App) (*store.Store, func() error, error) {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "memory":
+		log.Println("Using in-memory storage backend (data will be lost on restart)")
+		return store.NewMemory(), func() error { return nil }, nil
+	case "", "firestore":
+		firestoreClient, err := app.Firestore(context.Background())
+		if err != nil {
+			return nil, nil, err
+		}
+		return store.NewFirestore(firestoreClient), firestoreClient.Close, nil
+	default:
+		log.Fatalf("Unknown STORAGE_BACKEND %q (expected \"firestore\" or \"memory\")", backend)
+		return nil, nil, nil
+	}
+}
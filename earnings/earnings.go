@@ -0,0 +1,123 @@
+package earnings
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"api-flash-dash/model"
+)
+
+// ประเภทของรายการในบัญชีรายได้
+const (
+	TypeDeliveryCredit = "delivery_credit" // รายได้จากงานที่ส่งสำเร็จ
+	TypePenalty        = "penalty"         // ค่าปรับ (หัก)
+	TypeAdjustment     = "adjustment"      // ปรับปรุงยอด (บวกหรือลบก็ได้)
+	TypePayout         = "payout"          // จ่ายเงินออกให้ไรเดอร์ (หัก)
+)
+
+// SystemActor คือ CreatedBy ของรายการที่ระบบบันทึกเอง
+const SystemActor = "system"
+
+// ช่วงเวลาของใบแจ้งยอด
+const (
+	PeriodDaily  = "daily"
+	PeriodWeekly = "weekly"
+)
+
+// DefaultRiderSharePercent คือส่วนแบ่งค่าส่ง (%) ที่ไรเดอร์ได้รับ
+const DefaultRiderSharePercent = 80
+
+// Location คือเขตเวลาที่ใช้ตัดรอบวัน/สัปดาห์ (เวลาประเทศไทย)
+var Location = time.FixedZone("ICT", 7*60*60)
+
+// ErrUnknownPeriod ถูกส่งกลับเมื่อช่วงเวลาไม่ใช่ "daily" หรือ "weekly"
+var ErrUnknownPeriod = errors.New("period must be \"daily\" or \"weekly\"")
+
+// Config คือการตั้งค่าการคำนวณรายได้ของไรเดอร์
+type Config struct {
+	RiderSharePercent float64
+}
+
+// LoadConfig อ่านการตั้งค่าจาก Environment Variable EARNINGS_RIDER_SHARE_PERCENT
+func LoadConfig() Config {
+	cfg := Config{RiderSharePercent: DefaultRiderSharePercent}
+	if raw := os.Getenv("EARNINGS_RIDER_SHARE_PERCENT"); raw != "" {
+		if v, err := strconv.ParseFloat(raw, 64); err == nil && v >= 0 && v <= 100 {
+			cfg.RiderSharePercent = v
+		}
+	}
+	return cfg
+}
+
+// CreditID คือ ID ของรายการรายได้จาก delivery (ใช้ ID คงที่เพื่อไม่ให้บันทึกซ้ำ)
+func CreditID(deliveryID string) string {
+	return TypeDeliveryCredit + "_" + deliveryID
+}
+
+// PayoutID คือ ID ของรายการจ่ายเงินจากเลขอ้างอิง (เช่น เลขที่โอนเงิน)
+// ใช้ ID คงที่เพื่อไม่ให้คำขอที่ส่งซ้ำหักเงินซ้ำ เลขอ้างอิงถูก hash เพราะอาจมีตัวอักษรที่ใช้เป็น Document ID ไม่ได้ (เช่น "/")
+func PayoutID(reference string) string {
+	sum := sha256.Sum256([]byte(reference))
+	return TypePayout + "_" + hex.EncodeToString(sum[:16])
+}
+
+// DeliveryCredit สร้างรายการรายได้ของไรเดอร์จาก delivery ที่ส่งสำเร็จแล้ว
+// คืนค่า false ถ้า delivery นี้ไม่มีค่าส่ง (สร้างก่อนมีระบบคำนวณค่าส่ง) หรือไม่มีไรเดอร์
+func (cfg Config) DeliveryCredit(delivery *model.Delivery, at time.Time) (model.LedgerEntry, bool) {
+	if delivery.Fare == nil || delivery.RiderUID == nil {
+		return model.LedgerEntry{}, false
+	}
+	amount := int(math.Round(float64(delivery.Fare.Total) * cfg.RiderSharePercent / 100))
+	return model.LedgerEntry{
+		ID:         CreditID(delivery.ID),
+		RiderUID:   *delivery.RiderUID,
+		Type:       TypeDeliveryCredit,
+		Amount:     amount,
+		DeliveryID: delivery.ID,
+		CreatedBy:  SystemActor,
+		CreatedAt:  at,
+	}, true
+}
+
+// PeriodBounds คืนช่วงเวลา [start, end) ของวันหรือสัปดาห์ (เริ่มวันจันทร์) ที่ day อยู่
+func PeriodBounds(period string, day time.Time) (time.Time, time.Time, error) {
+	local := day.In(Location)
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, Location)
+	switch period {
+	case PeriodDaily:
+		return start, start.AddDate(0, 0, 1), nil
+	case PeriodWeekly:
+		offset := (int(start.Weekday()) + 6) % 7 // จำนวนวันนับจากวันจันทร์
+		start = start.AddDate(0, 0, -offset)
+		return start, start.AddDate(0, 0, 7), nil
+	}
+	return time.Time{}, time.Time{}, ErrUnknownPeriod
+}
+
+// Summary คือยอดรวมของรายการในช่วงเวลาหนึ่ง
+type Summary struct {
+	Credits int            `json:"credits"` // ผลรวมรายการบวก
+	Debits  int            `json:"debits"`  // ผลรวมรายการลบ (เป็นค่าบวก)
+	Net     int            `json:"net"`
+	ByType  map[string]int `json:"byType"`
+}
+
+// Summarize รวมยอดของรายการทั้งหมด
+func Summarize(entries []model.LedgerEntry) Summary {
+	summary := Summary{ByType: map[string]int{}}
+	for _, entry := range entries {
+		if entry.Amount >= 0 {
+			summary.Credits += entry.Amount
+		} else {
+			summary.Debits -= entry.Amount
+		}
+		summary.Net += entry.Amount
+		summary.ByType[entry.Type] += entry.Amount
+	}
+	return summary
+}
@@ -0,0 +1,42 @@
+package earnings
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPeriodBounds(t *testing.T) {
+	ict := func(y int, m time.Month, d, h int) time.Time { return time.Date(y, m, d, h, 0, 0, 0, Location) }
+	tests := []struct {
+		name   string
+		period string
+		day    time.Time
+		start  time.Time
+		end    time.Time
+		err    error
+	}{
+		{name: "daily", period: PeriodDaily, day: ict(2024, 3, 13, 15), start: ict(2024, 3, 13, 0), end: ict(2024, 3, 14, 0)},
+		{name: "daily at midnight", period: PeriodDaily, day: ict(2024, 3, 13, 0), start: ict(2024, 3, 13, 0), end: ict(2024, 3, 14, 0)},
+		// 20:00 UTC วันที่ 12 คือ 03:00 วันที่ 13 เวลาไทย
+		{name: "daily uses Thai time", period: PeriodDaily, day: time.Date(2024, 3, 12, 20, 0, 0, 0, time.UTC), start: ict(2024, 3, 13, 0), end: ict(2024, 3, 14, 0)},
+		{name: "daily across month end", period: PeriodDaily, day: ict(2024, 2, 29, 23), start: ict(2024, 2, 29, 0), end: ict(2024, 3, 1, 0)},
+		// 13 มี.ค. 2024 เป็นวันพุธ
+		{name: "weekly midweek", period: PeriodWeekly, day: ict(2024, 3, 13, 15), start: ict(2024, 3, 11, 0), end: ict(2024, 3, 18, 0)},
+		{name: "weekly on Monday", period: PeriodWeekly, day: ict(2024, 3, 11, 0), start: ict(2024, 3, 11, 0), end: ict(2024, 3, 18, 0)},
+		{name: "weekly on Sunday", period: PeriodWeekly, day: ict(2024, 3, 17, 23), start: ict(2024, 3, 11, 0), end: ict(2024, 3, 18, 0)},
+		{name: "weekly across year end", period: PeriodWeekly, day: ict(2025, 1, 1, 9), start: ict(2024, 12, 30, 0), end: ict(2025, 1, 6, 0)},
+		{name: "unknown period", period: "monthly", day: ict(2024, 3, 13, 15), err: ErrUnknownPeriod},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, err := PeriodBounds(tt.period, tt.day)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("PeriodBounds() error = %v, want %v", err, tt.err)
+			}
+			if !start.Equal(tt.start) || !end.Equal(tt.end) {
+				t.Errorf("PeriodBounds() = [%v, %v), want [%v, %v)", start, end, tt.start, tt.end)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"api-flash-dash/model"
+)
+
+// ประเภทของ Event ที่ส่งให้ผู้ติดตาม
+const (
+	TypeStatus   = "status"
+	TypeLocation = "location"
+)
+
+// Event คือข้อมูลที่ถูกส่งไปยังผู้ติดตาม delivery หรือไรเดอร์
+type Event struct {
+	Type       string             `json:"type"`
+	DeliveryID string             `json:"deliveryId,omitempty"`
+	Status     string             `json:"status,omitempty"`
+	RiderUID   string             `json:"riderUID,omitempty"`
+	Location   *model.Coordinates `json:"location,omitempty"`
+	At         time.Time          `json:"at"`
+}
+
+// DeliveryTopic คือชื่อหัวข้อสำหรับการเปลี่ยนสถานะของ delivery
+func DeliveryTopic(deliveryID string) string {
+	return "delivery:" + deliveryID
+}
+
+// RiderTopic คือชื่อหัวข้อสำหรับตำแหน่งของไรเดอร์
+func RiderTopic(riderUID string) string {
+	return "rider:" + riderUID
+}
+
+// subscriberBuffer คือจำนวน Event ที่พักไว้ได้ต่อผู้ติดตาม 1 ราย
+const subscriberBuffer = 16
+
+// Bus คือ event bus ภายใน process (ใช้ได้เมื่อรันเซิร์ฟเวอร์ instance เดียว)
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[string]map[chan Event]struct{}
+}
+
+// NewBus สร้าง Bus ใหม่
+func NewBus() *Bus {
+	return &Bus{subs: make(map[string]map[chan Event]struct{})}
+}
+
+// Subscribe เริ่มติดตามหัวข้อ topic
+// ต้องเรียกฟังก์ชันที่คืนกลับไปเพื่อยกเลิกการติดตามเมื่อเลิกใช้งาน
+func (b *Bus) Subscribe(topic string) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subs[topic] == nil {
+		b.subs[topic] = make(map[chan Event]struct{})
+	}
+	b.subs[topic][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs[topic], ch)
+			if len(b.subs[topic]) == 0 {
+				delete(b.subs, topic)
+			}
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish ส่ง Event ไปยังผู้ติดตามหัวข้อ topic ทุกราย
+// ไม่รอผู้ติดตามที่รับไม่ทัน (Event ของรายนั้นจะถูกทิ้งไป)
+func (b *Bus) Publish(topic string, event Event) {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subs[topic] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
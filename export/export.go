@@ -0,0 +1,169 @@
+// Package export จัดรูปแบบไฟล์ส่งออกข้อมูลส่วนบุคคล (JSON หรือ ZIP) และเก็บไฟล์ไว้ให้ดาวน์โหลด
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"api-flash-dash/model"
+)
+
+// รูปแบบไฟล์ที่รองรับ
+const (
+	FormatJSON = "json"
+	FormatZIP  = "zip"
+)
+
+// ErrNotFound ถูกส่งกลับเมื่อไม่มีไฟล์ (ยังสร้างไม่เสร็จ หรือถูกลบไปแล้ว)
+var ErrNotFound = errors.New("export: archive not found")
+
+// Config คือการตั้งค่าของการส่งออกข้อมูล
+type Config struct {
+	TTL time.Duration // ระยะเวลาที่ดาวน์โหลดไฟล์ได้หลังสร้างเสร็จ
+	// Timeout คือเวลาสูงสุดที่งานเบื้องหลัง 1 งานใช้ได้
+	Timeout time.Duration
+}
+
+// LoadConfig อ่านการตั้งค่าจาก Environment Variable (ถ้าไม่กำหนดจะใช้ค่าเริ่มต้น)
+//   - EXPORT_TTL_HOURS (ค่าเริ่มต้น 24)
+//   - EXPORT_TIMEOUT_SECONDS (ค่าเริ่มต้น 300)
+func LoadConfig() Config {
+	cfg := Config{TTL: 24 * time.Hour, Timeout: 5 * time.Minute}
+	if n, err := strconv.Atoi(os.Getenv("EXPORT_TTL_HOURS")); err == nil && n > 0 {
+		cfg.TTL = time.Duration(n) * time.Hour
+	}
+	if n, err := strconv.Atoi(os.Getenv("EXPORT_TIMEOUT_SECONDS")); err == nil && n > 0 {
+		cfg.Timeout = time.Duration(n) * time.Second
+	}
+	return cfg
+}
+
+// ContentType คือ Content-Type ของไฟล์แต่ละรูปแบบ
+func ContentType(format string) string {
+	if format == FormatZIP {
+		return "application/zip"
+	}
+	return "application/json"
+}
+
+// Filename คือชื่อไฟล์ที่แนะนำให้ผู้ใช้ตอนดาวน์โหลด
+func Filename(format string, generatedAt time.Time) string {
+	return fmt.Sprintf("flashdash-data-%s.%s", generatedAt.Format("20060102-150405"), format)
+}
+
+// Write เขียนข้อมูลลง w ตามรูปแบบที่ระบุ
+// แบบ ZIP จะแยกแต่ละหมวดเป็นไฟล์ JSON ของตัวเอง (เปิดดูทีละส่วนได้ง่ายกว่าเมื่อประวัติยาว)
+func Write(w io.Writer, format string, data *model.PersonalData) error {
+	if format != FormatZIP {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(data)
+	}
+
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name  string
+		value interface{}
+		skip  bool
+	}{
+		{"profile.json", data.Profile, false},
+		{"addresses.json", data.Addresses, false},
+		{"notifications.json", data.Notifications, false},
+		{"rider.json", data.Rider, data.Rider == nil},
+		{"ledger.json", data.Ledger, data.Rider == nil},
+		{"deliveries.json", data.Deliveries, false},
+	}
+	for _, file := range files {
+		if file.skip {
+			continue
+		}
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: data.GeneratedAt})
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(file.value); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// Storage เก็บไฟล์ที่สร้างเสร็จแล้วไว้ให้ดาวน์โหลด
+// ต่อกับ Cloud Storage ได้โดย implement interface นี้แล้วเลือกใช้ใน LoadStorage
+type Storage interface {
+	Save(id string, write func(w io.Writer) error) (int64, error)
+	Open(id string) (io.ReadCloser, error)
+	Delete(id string) error
+}
+
+// DirStorage เก็บไฟล์ไว้ในโฟลเดอร์บนเครื่อง
+// ถ้ารันหลาย instance ต้องชี้ไปที่โฟลเดอร์ที่ใช้ร่วมกัน (ไม่เช่นนั้นดาวน์โหลดได้เฉพาะ instance ที่สร้างไฟล์)
+type DirStorage struct {
+	Dir string
+}
+
+// LoadStorage เลือกที่เก็บไฟล์จาก EXPORT_DIR (ค่าเริ่มต้นคือโฟลเดอร์ชั่วคราวของระบบ)
+func LoadStorage() Storage {
+	dir := os.Getenv("EXPORT_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "flashdash-exports")
+	}
+	return DirStorage{Dir: dir}
+}
+
+func (s DirStorage) path(id string) string {
+	return filepath.Join(s.Dir, filepath.Base(id))
+}
+
+// Save เขียนไฟล์ชั่วคราวก่อนแล้วค่อยเปลี่ยนชื่อ ผู้ดาวน์โหลดจะไม่เห็นไฟล์ที่เขียนไม่เสร็จ
+func (s DirStorage) Save(id string, write func(w io.Writer) error) (int64, error) {
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return 0, err
+	}
+	f, err := os.CreateTemp(s.Dir, ".tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name()) // ไม่มีผลถ้าเปลี่ยนชื่อสำเร็จแล้ว
+	if err := write(f); err != nil {
+		f.Close()
+		return 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(f.Name(), s.path(id)); err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (s DirStorage) Open(id string) (io.ReadCloser, error) {
+	f, err := os.Open(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s DirStorage) Delete(id string) error {
+	err := os.Remove(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
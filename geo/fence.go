@@ -0,0 +1,47 @@
+package geo
+
+import (
+	"os"
+	"strconv"
+)
+
+// โหมดของ geofence เมื่อไรเดอร์ยืนยันรับ/ส่งของนอกรัศมี
+const (
+	FenceReject = "reject" // ปฏิเสธการยืนยัน
+	FenceFlag   = "flag"   // ยอมรับ แต่ทำเครื่องหมายให้แอดมินตรวจสอบ
+)
+
+// DefaultFenceRadiusM คือรัศมีเริ่มต้น (เมตร) รอบจุดรับ/ส่งของ
+const DefaultFenceRadiusM = 200
+
+// Fence คือการตั้งค่าการตรวจสอบตำแหน่งตอนยืนยันรับ/ส่งของ
+// RadiusM เป็น 0 หมายถึงปิดการตรวจสอบ (แต่ยังบันทึกระยะทางไว้)
+type Fence struct {
+	RadiusM float64
+	Mode    string
+}
+
+// Enabled บอกว่าเปิดการตรวจสอบรัศมีอยู่หรือไม่
+func (f Fence) Enabled() bool {
+	return f.RadiusM > 0
+}
+
+// FlagOnly บอกว่าควรยอมรับการยืนยันที่อยู่นอกรัศมีแล้วทำเครื่องหมายไว้แทนการปฏิเสธ
+func (f Fence) FlagOnly() bool {
+	return f.Mode == FenceFlag
+}
+
+// LoadFence อ่านการตั้งค่าจาก Environment Variables
+// GEOFENCE_RADIUS_METERS (ค่าเริ่มต้น 200) และ GEOFENCE_MODE ("reject" หรือ "flag")
+func LoadFence() Fence {
+	fence := Fence{RadiusM: DefaultFenceRadiusM, Mode: FenceReject}
+	if raw := os.Getenv("GEOFENCE_RADIUS_METERS"); raw != "" {
+		if v, err := strconv.ParseFloat(raw, 64); err == nil && v >= 0 {
+			fence.RadiusM = v
+		}
+	}
+	if os.Getenv("GEOFENCE_MODE") == FenceFlag {
+		fence.Mode = FenceFlag
+	}
+	return fence
+}
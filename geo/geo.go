@@ -0,0 +1,137 @@
+package geo
+
+import (
+	"math"
+	"sort"
+)
+
+// earthRadiusKm คือรัศมีเฉลี่ยของโลก (กิโลเมตร)
+const earthRadiusKm = 6371.0
+
+// kmPerDegreeLat คือระยะทางโดยประมาณของละติจูด 1 องศา (กิโลเมตร)
+const kmPerDegreeLat = 111.32
+
+// DistanceKm คำนวณระยะทางเส้นตรงบนผิวโลกระหว่าง 2 พิกัดด้วยสูตร Haversine (หน่วยกิโลเมตร)
+func DistanceKm(lat1, lng1, lat2, lng2 float64) float64 {
+	dLat := toRadians(lat2 - lat1)
+	dLng := toRadians(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+func toRadians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// --- Geohash ---
+
+const base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// DefaultPrecision คือความละเอียดของ geohash ที่เก็บลงเอกสาร (~5 เมตร)
+const DefaultPrecision = 9
+
+// Encode แปลงพิกัดเป็น geohash ที่มีความยาว precision ตัวอักษร
+func Encode(lat, lng float64, precision int) string {
+	latMin, latMax := -90.0, 90.0
+	lngMin, lngMax := -180.0, 180.0
+	hash := make([]byte, 0, precision)
+	bit, ch := 0, 0
+	even := true // บิตคู่ใช้ longitude, บิตคี่ใช้ latitude
+
+	for len(hash) < precision {
+		if even {
+			mid := (lngMin + lngMax) / 2
+			if lng >= mid {
+				ch = ch<<1 | 1
+				lngMin = mid
+			} else {
+				ch <<= 1
+				lngMax = mid
+			}
+		} else {
+			mid := (latMin + latMax) / 2
+			if lat >= mid {
+				ch = ch<<1 | 1
+				latMin = mid
+			} else {
+				ch <<= 1
+				latMax = mid
+			}
+		}
+		even = !even
+		bit++
+		if bit == 5 {
+			hash = append(hash, base32[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return string(hash)
+}
+
+// cellSizeDegrees คืนขนาดของช่อง geohash ที่ความละเอียด precision (องศา lat, องศา lng)
+func cellSizeDegrees(precision int) (float64, float64) {
+	bits := 5 * precision
+	lngBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 180 / math.Pow(2, float64(latBits)), 360 / math.Pow(2, float64(lngBits))
+}
+
+// Range คือช่วงของ geohash [Start, End] สำหรับใช้ query แบบ StartAt/EndAt
+type Range struct {
+	Start string
+	End   string
+}
+
+// QueryRanges คืนช่วง geohash ที่ครอบคลุมวงกลมรัศมี radiusKm รอบพิกัดที่กำหนด
+// ผลลัพธ์อาจมีเอกสารที่อยู่นอกวงกลมปนมาด้วย ผู้เรียกต้องกรองด้วย DistanceKm อีกครั้ง
+func QueryRanges(lat, lng, radiusKm float64) []Range {
+	dLat := radiusKm / kmPerDegreeLat
+	cosLat := math.Cos(toRadians(lat))
+	dLng := 360.0
+	if cosLat > 1e-9 {
+		dLng = math.Min(360, radiusKm/(kmPerDegreeLat*cosLat))
+	}
+
+	// เลือกความละเอียดสูงสุดที่ขนาดช่องยังใหญ่กว่ารัศมี
+	// ทำให้ช่องที่ครอบจุด 3x3 รอบศูนย์กลาง (ห่างกันเท่ารัศมี) ครอบคลุมวงกลมทั้งหมด
+	precision := 1
+	for p := DefaultPrecision; p >= 1; p-- {
+		cellLat, cellLng := cellSizeDegrees(p)
+		if cellLat >= dLat && cellLng >= dLng {
+			precision = p
+			break
+		}
+	}
+
+	seen := make(map[string]bool)
+	var hashes []string
+	for _, offLat := range []float64{-dLat, 0, dLat} {
+		for _, offLng := range []float64{-dLng, 0, dLng} {
+			pLat := math.Max(-90, math.Min(90, lat+offLat))
+			pLng := wrapLongitude(lng + offLng)
+			hash := Encode(pLat, pLng, precision)
+			if !seen[hash] {
+				seen[hash] = true
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+	sort.Strings(hashes)
+
+	ranges := make([]Range, 0, len(hashes))
+	for _, hash := range hashes {
+		ranges = append(ranges, Range{Start: hash, End: hash + "~"}) // "~" มากกว่าตัวอักษร base32 ทุกตัว
+	}
+	return ranges
+}
+
+func wrapLongitude(lng float64) float64 {
+	for lng > 180 {
+		lng -= 360
+	}
+	for lng < -180 {
+		lng += 360
+	}
+	return lng
+}
@@ -0,0 +1,85 @@
+package geo
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		lat, lng  float64
+		precision int
+		want      string
+	}{
+		// ค่าอ้างอิงจากตัวอย่างมาตรฐานของ geohash
+		{lat: 57.64911, lng: 10.40744, precision: 11, want: "u4pruydqqvj"},
+		{lat: 42.6, lng: -5.6, precision: 5, want: "ezs42"},
+	}
+	for _, tt := range tests {
+		if got := Encode(tt.lat, tt.lng, tt.precision); got != tt.want {
+			t.Errorf("Encode(%v, %v, %d) = %q, want %q", tt.lat, tt.lng, tt.precision, got, tt.want)
+		}
+	}
+}
+
+func TestQueryRanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lng float64
+		radiusKm float64
+	}{
+		{name: "bangkok 1km", lat: 13.7563, lng: 100.5018, radiusKm: 1},
+		{name: "bangkok 5km", lat: 13.7563, lng: 100.5018, radiusKm: 5},
+		{name: "bangkok 50km", lat: 13.7563, lng: 100.5018, radiusKm: 50},
+		{name: "tiny radius", lat: 13.7563, lng: 100.5018, radiusKm: 0.01},
+		{name: "on a cell edge", lat: 0, lng: 0, radiusKm: 3},
+		{name: "across the antimeridian", lat: 10, lng: 179.99, radiusKm: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranges := QueryRanges(tt.lat, tt.lng, tt.radiusKm)
+			if len(ranges) == 0 || len(ranges) > 9 {
+				t.Fatalf("got %d ranges, want 1..9", len(ranges))
+			}
+			// ทุกจุดบนขอบและภายในวงกลมต้องตกอยู่ในช่วงใดช่วงหนึ่ง
+			dLat := tt.radiusKm / kmPerDegreeLat
+			for _, frac := range []float64{0, 0.5, 0.99} {
+				for deg := 0; deg < 360; deg += 15 {
+					angle := float64(deg) * math.Pi / 180
+					lat := math.Max(-90, math.Min(90, tt.lat+frac*dLat*math.Sin(angle)))
+					lng := tt.lng
+					if cosLat := math.Cos(toRadians(tt.lat)); cosLat > 1e-9 {
+						lng = wrapLongitude(tt.lng + frac*dLat/cosLat*math.Cos(angle))
+					}
+					if DistanceKm(tt.lat, tt.lng, lat, lng) > tt.radiusKm {
+						continue
+					}
+					hash := Encode(lat, lng, DefaultPrecision)
+					if !covered(ranges, hash) {
+						t.Errorf("point (%v, %v) hash %s not covered by %v", lat, lng, hash, ranges)
+					}
+				}
+			}
+		})
+	}
+}
+
+func covered(ranges []Range, hash string) bool {
+	for _, r := range ranges {
+		if hash >= r.Start && hash <= r.End && strings.HasPrefix(hash, r.Start) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDistanceKm(t *testing.T) {
+	// กรุงเทพฯ -> เชียงใหม่ ประมาณ 580 กม. (เส้นตรง)
+	if d := DistanceKm(13.7563, 100.5018, 18.7883, 98.9853); d < 570 || d > 590 {
+		t.Errorf("DistanceKm() = %v, want about 580", d)
+	}
+	if d := DistanceKm(13.7563, 100.5018, 13.7563, 100.5018); d != 0 {
+		t.Errorf("DistanceKm() same point = %v, want 0", d)
+	}
+}
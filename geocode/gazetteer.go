@@ -0,0 +1,137 @@
+package geocode
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"api-flash-dash/geo"
+	"api-flash-dash/model"
+)
+
+// Gazetteer คือ geocoder แบบออฟไลน์จากรายชื่อสถานที่ที่รู้จัก (ไม่ต้องต่อเน็ตหรือใช้ API Key)
+// เหมาะกับการพัฒนาและทดสอบ ความละเอียดขึ้นกับรายชื่อในไฟล์ (ระดับเขต/ย่าน ไม่ใช่บ้านเลขที่)
+type Gazetteer struct {
+	entries []gazetteerEntry
+}
+
+type gazetteerEntry struct {
+	names   []string // ชื่อแรกคือชื่อหลัก ที่เหลือคือชื่ออื่น
+	keys    []string // ชื่อที่ normalize แล้ว ใช้จับคู่กับข้อความ
+	at      model.Coordinates
+	radiusM float64
+}
+
+// LoadGazetteer อ่านรายชื่อสถานที่จากไฟล์ CSV (ดูรูปแบบที่ ParseGazetteer)
+func LoadGazetteer(path string) (*Gazetteer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("geocode: open gazetteer: %w", err)
+	}
+	defer f.Close()
+	return ParseGazetteer(f)
+}
+
+// ParseGazetteer อ่าน CSV ที่มีคอลัมน์ name,latitude,longitude,radius_m
+// name ใส่ได้หลายชื่อคั่นด้วย | (เช่น "สยาม|Siam") บรรทัดที่ขึ้นต้นด้วย # คือคอมเมนต์
+func ParseGazetteer(r io.Reader) (*Gazetteer, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 4
+	reader.TrimLeadingSpace = true
+
+	g := &Gazetteer{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("geocode: gazetteer: %w", err)
+		}
+		if line == 1 && record[0] == "name" {
+			continue // header
+		}
+		lat, latErr := strconv.ParseFloat(record[1], 64)
+		lng, lngErr := strconv.ParseFloat(record[2], 64)
+		radius, radiusErr := strconv.ParseFloat(record[3], 64)
+		at := model.Coordinates{Latitude: lat, Longitude: lng}
+		if latErr != nil || lngErr != nil || radiusErr != nil || radius <= 0 || !validCoordinates(at) {
+			return nil, fmt.Errorf("geocode: gazetteer: invalid entry %q", strings.Join(record, ","))
+		}
+
+		entry := gazetteerEntry{at: at, radiusM: radius}
+		for _, name := range strings.Split(record[0], "|") {
+			if name = strings.TrimSpace(name); name != "" {
+				entry.names = append(entry.names, name)
+				entry.keys = append(entry.keys, normalize(name))
+			}
+		}
+		if len(entry.names) == 0 {
+			return nil, fmt.Errorf("geocode: gazetteer: entry without a name %q", strings.Join(record, ","))
+		}
+		g.entries = append(g.entries, entry)
+	}
+	if len(g.entries) == 0 {
+		return nil, fmt.Errorf("geocode: gazetteer is empty")
+	}
+	return g, nil
+}
+
+func (g *Gazetteer) Name() string { return "gazetteer" }
+
+// Geocode หาสถานที่ที่มีชื่ออยู่ในข้อความ ถ้าเจอหลายที่จะเลือกที่เล็กที่สุด (เฉพาะเจาะจงที่สุด)
+// เช่น "ถนนสีลม เขตบางรัก กรุงเทพมหานคร" จะได้ "สีลม" ไม่ใช่ "กรุงเทพมหานคร"
+func (g *Gazetteer) Geocode(ctx context.Context, text string) (*Place, error) {
+	text = normalize(text)
+	var best *gazetteerEntry
+	bestLen := 0
+	for i := range g.entries {
+		entry := &g.entries[i]
+		for _, key := range entry.keys {
+			if !strings.Contains(text, key) {
+				continue
+			}
+			if best == nil || entry.radiusM < best.radiusM || (entry.radiusM == best.radiusM && len(key) > bestLen) {
+				best, bestLen = entry, len(key)
+			}
+		}
+	}
+	if best == nil {
+		return nil, ErrNoMatch
+	}
+	return &Place{Text: best.names[0], Coordinates: best.at, RadiusM: best.radiusM}, nil
+}
+
+// Reverse คืนชื่อทุกสถานที่ที่ครอบคลุมพิกัด เรียงจากเล็กไปใหญ่ เช่น "สีลม, บางรัก, กรุงเทพมหานคร"
+func (g *Gazetteer) Reverse(ctx context.Context, at model.Coordinates) (*Place, error) {
+	var hits []*gazetteerEntry
+	for i := range g.entries {
+		entry := &g.entries[i]
+		if geo.DistanceKm(at.Latitude, at.Longitude, entry.at.Latitude, entry.at.Longitude)*1000 <= entry.radiusM {
+			hits = append(hits, entry)
+		}
+	}
+	if len(hits) == 0 {
+		return nil, ErrNoMatch
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].radiusM < hits[j].radiusM })
+
+	names := make([]string, len(hits))
+	for i, entry := range hits {
+		names[i] = entry.names[0]
+	}
+	closest := hits[0]
+	return &Place{Text: strings.Join(names, ", "), Coordinates: closest.at, RadiusM: closest.radiusM}, nil
+}
+
+// normalize ตัดช่องว่างและตัวพิมพ์ใหญ่ออก เพื่อให้ "Siam  Paragon" ตรงกับ "siamparagon"
+// (ภาษาไทยไม่เว้นวรรคระหว่างคำอยู่แล้ว จึงตัดช่องว่างทิ้งทั้งหมด)
+func normalize(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), "")
+}
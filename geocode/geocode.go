@@ -0,0 +1,172 @@
+// Package geocode แปลงข้อความที่อยู่เป็นพิกัด (geocode) และพิกัดเป็นข้อความ (reverse geocode)
+// ใช้ตรวจและเติมข้อมูลที่อยู่ที่แอปส่งมา (ดู Resolver)
+package geocode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"api-flash-dash/geo"
+	"api-flash-dash/model"
+)
+
+var (
+	// ErrNoMatch ถูกส่งกลับเมื่อหาสถานที่ที่ตรงกับข้อความหรือพิกัดไม่พบ
+	ErrNoMatch = errors.New("geocode: no matching place")
+	// ErrIncomplete ถูกส่งกลับเมื่อที่อยู่ไม่มีทั้งข้อความและพิกัด (หรือขาดอย่างใดอย่างหนึ่งโดยไม่ได้เปิด geocoder)
+	ErrIncomplete = errors.New("geocode: address needs a detail and coordinates")
+	// ErrInvalidCoordinates ถูกส่งกลับเมื่อพิกัดอยู่นอกช่วงที่เป็นไปได้
+	ErrInvalidCoordinates = errors.New("geocode: coordinates are out of range")
+)
+
+// Place คือสถานที่ที่ geocoder หาเจอ
+type Place struct {
+	Text        string
+	Coordinates model.Coordinates
+	// RadiusM คือขนาดโดยประมาณของสถานที่ (เช่น ทั้งเขตมีรัศมีหลายกิโลเมตร) ใช้เป็นค่าความคลาดเคลื่อนที่ยอมรับได้
+	RadiusM float64
+}
+
+// Geocoder ค้นหาสถานที่จากข้อความหรือพิกัด
+// ต่อกับผู้ให้บริการอื่นได้โดย implement interface นี้แล้วเลือกใช้ใน LoadResolver
+type Geocoder interface {
+	// Name คือชื่อผู้ให้บริการ (บันทึกไว้ในผลการตรวจ)
+	Name() string
+	Geocode(ctx context.Context, text string) (*Place, error)
+	Reverse(ctx context.Context, at model.Coordinates) (*Place, error)
+}
+
+// DefaultMismatchM คือระยะห่าง (เมตร) ระหว่างพิกัดที่แอปส่งมากับพิกัดจากข้อความ ที่ถือว่าไม่ตรงกัน
+const DefaultMismatchM = 500
+
+// Resolver ตรวจและเติมข้อมูลที่อยู่ก่อนบันทึก
+//   - มีทั้งข้อความและพิกัด: geocode ข้อความแล้วเทียบระยะ ถ้าห่างเกินกำหนดจะทำเครื่องหมาย Mismatch (แต่ยังใช้พิกัดของแอป)
+//   - มีแต่ข้อความ: เติมพิกัดจากการ geocode
+//   - มีแต่พิกัด: เติมข้อความจากการ reverse geocode
+//
+// Resolver ที่เป็น nil (ไม่ได้เปิด geocoder) จะบังคับให้ส่งมาครบทั้งข้อความและพิกัดเหมือนเดิม
+type Resolver struct {
+	Geocoder  Geocoder
+	MismatchM float64
+}
+
+// LoadResolver เลือก geocoder จาก Environment Variable (คืนค่า nil ถ้าไม่ได้เปิดใช้)
+//   - GEOCODER: "gazetteer" (ไฟล์บนเครื่อง ไม่ต้องต่อเน็ต) หรือ "google" (ค่าว่าง = ปิด)
+//   - GEOCODER_GAZETTEER_PATH (ค่าเริ่มต้น geocode/gazetteer.csv)
+//   - GOOGLE_MAPS_API_KEY และ GOOGLE_GEOCODING_URL (ถ้าต้องการกำหนด base URL เอง)
+//   - GEOCODER_MISMATCH_METERS (ค่าเริ่มต้น 500)
+func LoadResolver() (*Resolver, error) {
+	var g Geocoder
+	switch provider := os.Getenv("GEOCODER"); provider {
+	case "":
+		return nil, nil
+	case "gazetteer":
+		path := os.Getenv("GEOCODER_GAZETTEER_PATH")
+		if path == "" {
+			path = "geocode/gazetteer.csv"
+		}
+		gazetteer, err := LoadGazetteer(path)
+		if err != nil {
+			return nil, err
+		}
+		g = gazetteer
+	case "google":
+		google := NewGoogle(os.Getenv("GOOGLE_MAPS_API_KEY"))
+		if google.APIKey == "" {
+			return nil, errors.New("geocode: GOOGLE_MAPS_API_KEY is required when GEOCODER=google")
+		}
+		if v := os.Getenv("GOOGLE_GEOCODING_URL"); v != "" {
+			google.BaseURL = v
+		}
+		g = google
+	default:
+		return nil, fmt.Errorf("geocode: unknown GEOCODER %q", provider)
+	}
+
+	r := &Resolver{Geocoder: g, MismatchM: DefaultMismatchM}
+	if v, err := strconv.ParseFloat(os.Getenv("GEOCODER_MISMATCH_METERS"), 64); err == nil && v > 0 {
+		r.MismatchM = v
+	}
+	return r, nil
+}
+
+// Resolve ตรวจและเติมข้อความ/พิกัดของ a และบันทึกผลไว้ที่ a.Geocode
+// error ที่ไม่ใช่ ErrIncomplete, ErrInvalidCoordinates หรือ ErrNoMatch คือผู้ให้บริการใช้งานไม่ได้
+// ในกรณีนั้นถ้ามีข้อมูลครบอยู่แล้วจะไม่คืนค่า error แต่บันทึกว่ายังไม่ได้ตรวจ (Status "unchecked")
+func (r *Resolver) Resolve(ctx context.Context, a *model.AddressPayload) error {
+	hasDetail, hasCoordinates := a.Detail != "", a.HasCoordinates()
+	if hasCoordinates && !validCoordinates(a.Coordinates) {
+		return ErrInvalidCoordinates
+	}
+	a.Geocode = nil
+	if r == nil || r.Geocoder == nil {
+		if !hasDetail || !hasCoordinates {
+			return ErrIncomplete
+		}
+		return nil
+	}
+
+	check := &model.GeocodeCheck{Provider: r.Geocoder.Name(), CheckedAt: time.Now()}
+	switch {
+	case hasDetail && hasCoordinates:
+		place, err := r.Geocoder.Geocode(ctx, a.Detail)
+		if errors.Is(err, ErrNoMatch) {
+			// ข้อความไม่ตรงกับสถานที่ใดเลย ตรวจไม่ได้ว่าตรงกับพิกัดหรือไม่
+			check.Status = model.GeocodeUnmatched
+			break
+		}
+		if err != nil {
+			log.Printf("Address %q was saved unchecked, %s is unavailable: %v", a.Detail, r.Geocoder.Name(), err)
+			check.Status = model.GeocodeUnchecked
+			break
+		}
+		distanceM := math.Round(geo.DistanceKm(a.Coordinates.Latitude, a.Coordinates.Longitude, place.Coordinates.Latitude, place.Coordinates.Longitude) * 1000)
+		check.Status = model.GeocodeVerified
+		check.MatchedText = place.Text
+		check.MatchedCoordinates = &place.Coordinates
+		check.DistanceM = &distanceM
+		if distanceM > r.tolerance(place) {
+			check.Status = model.GeocodeMismatch
+		}
+	case hasDetail:
+		place, err := r.Geocoder.Geocode(ctx, a.Detail)
+		if err != nil {
+			return err
+		}
+		a.Coordinates = place.Coordinates
+		check.Status = model.GeocodeFilledCoordinates
+		check.MatchedText = place.Text
+		check.MatchedCoordinates = &place.Coordinates
+	case hasCoordinates:
+		place, err := r.Geocoder.Reverse(ctx, a.Coordinates)
+		if err != nil {
+			return err
+		}
+		a.Detail = place.Text
+		check.Status = model.GeocodeFilledDetail
+		check.MatchedText = place.Text
+		check.MatchedCoordinates = &place.Coordinates
+	default:
+		return ErrIncomplete
+	}
+	a.Geocode = check
+	return nil
+}
+
+// tolerance คือระยะห่างที่ยอมรับได้ สถานที่ใหญ่ (เช่น ทั้งเขต) ยอมให้ห่างได้ตามขนาดของสถานที่
+func (r *Resolver) tolerance(place *Place) float64 {
+	if place.RadiusM > r.MismatchM {
+		return place.RadiusM
+	}
+	return r.MismatchM
+}
+
+func validCoordinates(c model.Coordinates) bool {
+	return c.Latitude >= -90 && c.Latitude <= 90 && c.Longitude >= -180 && c.Longitude <= 180
+}
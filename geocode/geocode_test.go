@@ -0,0 +1,185 @@
+package geocode
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"api-flash-dash/model"
+)
+
+const testGazetteer = `name,latitude,longitude,radius_m
+กรุงเทพมหานคร|Bangkok,13.7563,100.5018,25000
+สยาม|Siam,13.7456,100.5341,1000
+สยามพารากอน|Siam Paragon,13.7462,100.5347,300
+`
+
+var (
+	bangkok   = model.Coordinates{Latitude: 13.7563, Longitude: 100.5018}
+	paragon   = model.Coordinates{Latitude: 13.7462, Longitude: 100.5347}
+	siam      = model.Coordinates{Latitude: 13.7456, Longitude: 100.5341}
+	nearby    = model.Coordinates{Latitude: 13.7465, Longitude: 100.5350} // ห่างจากสยามพารากอนประมาณ 45 ม.
+	chiangMai = model.Coordinates{Latitude: 18.7883, Longitude: 98.9853}
+)
+
+func newTestGazetteer(t *testing.T) *Gazetteer {
+	t.Helper()
+	g, err := ParseGazetteer(strings.NewReader(testGazetteer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+// unavailableGeocoder จำลองผู้ให้บริการที่ใช้งานไม่ได้ (เช่น เน็ตล่ม)
+type unavailableGeocoder struct{}
+
+func (unavailableGeocoder) Name() string { return "unavailable" }
+
+func (unavailableGeocoder) Geocode(ctx context.Context, text string) (*Place, error) {
+	return nil, errors.New("connection refused")
+}
+
+func (unavailableGeocoder) Reverse(ctx context.Context, at model.Coordinates) (*Place, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestParseGazetteer(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		wantErr bool
+	}{
+		{name: "valid", csv: testGazetteer},
+		{name: "comments without header", csv: "# สถานที่\nสยาม,13.7456,100.5341,1000\n"},
+		{name: "empty", csv: "name,latitude,longitude,radius_m\n", wantErr: true},
+		{name: "zero radius", csv: "สยาม,13.7456,100.5341,0\n", wantErr: true},
+		{name: "latitude out of range", csv: "สยาม,91,100.5341,1000\n", wantErr: true},
+		{name: "not a number", csv: "สยาม,north,100.5341,1000\n", wantErr: true},
+		{name: "no name", csv: " | ,13.7456,100.5341,1000\n", wantErr: true},
+		{name: "missing column", csv: "สยาม,13.7456,100.5341\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseGazetteer(strings.NewReader(tt.csv))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseGazetteer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadGazetteerBundled(t *testing.T) {
+	g, err := LoadGazetteer("gazetteer.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Geocode(context.Background(), "สยามพารากอน"); err != nil {
+		t.Errorf("bundled gazetteer: Geocode() error = %v", err)
+	}
+}
+
+func TestGazetteerGeocode(t *testing.T) {
+	g := newTestGazetteer(t)
+	tests := []struct {
+		text string
+		want string
+		err  error
+	}{
+		// เจอหลายที่ เลือกที่เล็กที่สุด
+		{text: "ห้างสยามพารากอน ถนนพระราม 1 กรุงเทพมหานคร", want: "สยามพารากอน"},
+		{text: "ซอยสยามสแควร์ 3 กรุงเทพมหานคร", want: "สยาม"},
+		{text: "  SIAM   paragon ", want: "สยามพารากอน"},
+		{text: "Bangkok", want: "กรุงเทพมหานคร"},
+		{text: "ถนนนิมมานเหมินท์ เชียงใหม่", err: ErrNoMatch},
+	}
+	for _, tt := range tests {
+		place, err := g.Geocode(context.Background(), tt.text)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Geocode(%q) error = %v, want %v", tt.text, err, tt.err)
+			continue
+		}
+		if err == nil && place.Text != tt.want {
+			t.Errorf("Geocode(%q) = %q, want %q", tt.text, place.Text, tt.want)
+		}
+	}
+}
+
+func TestGazetteerReverse(t *testing.T) {
+	g := newTestGazetteer(t)
+	place, err := g.Reverse(context.Background(), paragon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "สยามพารากอน, สยาม, กรุงเทพมหานคร"; place.Text != want || place.Coordinates != paragon {
+		t.Errorf("Reverse() = %q at %v, want %q at %v", place.Text, place.Coordinates, want, paragon)
+	}
+	if _, err := g.Reverse(context.Background(), chiangMai); !errors.Is(err, ErrNoMatch) {
+		t.Errorf("Reverse() outside every place error = %v, want %v", err, ErrNoMatch)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	gazetteer := newTestGazetteer(t)
+	resolver := &Resolver{Geocoder: gazetteer, MismatchM: DefaultMismatchM}
+	unavailable := &Resolver{Geocoder: unavailableGeocoder{}, MismatchM: DefaultMismatchM}
+
+	tests := []struct {
+		name       string
+		resolver   *Resolver
+		address    model.AddressPayload
+		err        error  // ค่า error ที่คาดไว้ (anyErr = error ใดๆ ที่ไม่ใช่ nil)
+		wantStatus string // "" = ไม่มีผลการตรวจ
+		wantDetail string
+		wantAt     model.Coordinates
+	}{
+		{name: "matching detail and coordinates", resolver: resolver, address: model.AddressPayload{Detail: "สยามพารากอน", Coordinates: nearby}, wantStatus: model.GeocodeVerified, wantDetail: "สยามพารากอน", wantAt: nearby},
+		{name: "coordinates far from detail", resolver: resolver, address: model.AddressPayload{Detail: "สยามพารากอน", Coordinates: bangkok}, wantStatus: model.GeocodeMismatch, wantDetail: "สยามพารากอน", wantAt: bangkok},
+		// สถานที่ใหญ่ (ทั้งจังหวัด) ยอมให้ห่างได้ตามรัศมีของสถานที่
+		{name: "large place tolerance", resolver: resolver, address: model.AddressPayload{Detail: "กรุงเทพมหานคร", Coordinates: siam}, wantStatus: model.GeocodeVerified, wantDetail: "กรุงเทพมหานคร", wantAt: siam},
+		{name: "unknown detail is kept", resolver: resolver, address: model.AddressPayload{Detail: "ถนนนิมมานเหมินท์", Coordinates: chiangMai}, wantStatus: model.GeocodeUnmatched, wantDetail: "ถนนนิมมานเหมินท์", wantAt: chiangMai},
+		{name: "fill coordinates", resolver: resolver, address: model.AddressPayload{Detail: "Siam Paragon"}, wantStatus: model.GeocodeFilledCoordinates, wantDetail: "Siam Paragon", wantAt: paragon},
+		{name: "fill detail", resolver: resolver, address: model.AddressPayload{Coordinates: paragon}, wantStatus: model.GeocodeFilledDetail, wantDetail: "สยามพารากอน, สยาม, กรุงเทพมหานคร", wantAt: paragon},
+		{name: "unknown detail only", resolver: resolver, address: model.AddressPayload{Detail: "ถนนนิมมานเหมินท์"}, err: ErrNoMatch},
+		{name: "unknown coordinates only", resolver: resolver, address: model.AddressPayload{Coordinates: chiangMai}, err: ErrNoMatch},
+		{name: "invalid coordinates", resolver: resolver, address: model.AddressPayload{Detail: "สยาม", Coordinates: model.Coordinates{Latitude: 91, Longitude: 100}}, err: ErrInvalidCoordinates},
+		{name: "empty address", resolver: resolver, err: ErrIncomplete},
+
+		// ผู้ให้บริการใช้งานไม่ได้: ข้อมูลครบแล้วยังบันทึกได้ ถ้าต้องเติมข้อมูลจะล้มเหลว
+		{name: "unavailable with full address", resolver: unavailable, address: model.AddressPayload{Detail: "สยาม", Coordinates: siam}, wantStatus: model.GeocodeUnchecked, wantDetail: "สยาม", wantAt: siam},
+		{name: "unavailable with detail only", resolver: unavailable, address: model.AddressPayload{Detail: "สยาม"}, err: anyErr},
+
+		// ไม่ได้เปิด geocoder: ต้องส่งมาครบเหมือนเดิม
+		{name: "disabled with full address", address: model.AddressPayload{Detail: "สยาม", Coordinates: siam}, wantDetail: "สยาม", wantAt: siam},
+		{name: "disabled with detail only", address: model.AddressPayload{Detail: "สยาม"}, err: ErrIncomplete},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address := tt.address
+			err := tt.resolver.Resolve(context.Background(), &address)
+			switch {
+			case tt.err == anyErr && err != nil:
+				return
+			case !errors.Is(err, tt.err):
+				t.Fatalf("Resolve() error = %v, want %v", err, tt.err)
+			case err != nil:
+				return
+			}
+
+			if address.Detail != tt.wantDetail || address.Coordinates != tt.wantAt {
+				t.Errorf("address = %q at %v, want %q at %v", address.Detail, address.Coordinates, tt.wantDetail, tt.wantAt)
+			}
+			status := ""
+			if address.Geocode != nil {
+				status = address.Geocode.Status
+			}
+			if status != tt.wantStatus {
+				t.Errorf("geocode status = %q, want %q", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// anyErr ใช้ในตารางทดสอบแทน error ใดๆ ที่ไม่ใช่ nil
+var anyErr = errors.New("any error")
@@ -0,0 +1,118 @@
+package geocode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"api-flash-dash/geo"
+	"api-flash-dash/model"
+)
+
+// DefaultGoogleGeocodingURL คือ endpoint ของ Google Maps Geocoding API
+const DefaultGoogleGeocodingURL = "https://maps.googleapis.com/maps/api/geocode/json"
+
+// GoogleGeocoder เรียก Google Maps Geocoding API
+// ตั้งค่า BaseURL ได้เพื่อชี้ไปที่ proxy หรือ mock server
+type GoogleGeocoder struct {
+	APIKey  string
+	BaseURL string
+	HTTP    *http.Client
+}
+
+// NewGoogle สร้าง GoogleGeocoder ด้วยค่าเริ่มต้น
+func NewGoogle(apiKey string) *GoogleGeocoder {
+	return &GoogleGeocoder{
+		APIKey:  apiKey,
+		BaseURL: DefaultGoogleGeocodingURL,
+		HTTP:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (g *GoogleGeocoder) Name() string { return "google" }
+
+func (g *GoogleGeocoder) Geocode(ctx context.Context, text string) (*Place, error) {
+	return g.lookup(ctx, url.Values{"address": {text}})
+}
+
+func (g *GoogleGeocoder) Reverse(ctx context.Context, at model.Coordinates) (*Place, error) {
+	return g.lookup(ctx, url.Values{"latlng": {fmt.Sprintf("%f,%f", at.Latitude, at.Longitude)}})
+}
+
+// lookup เรียก API แล้วใช้ผลลัพธ์แรก (Google เรียงผลที่ตรงที่สุดไว้ก่อน)
+func (g *GoogleGeocoder) lookup(ctx context.Context, query url.Values) (*Place, error) {
+	query.Set("key", g.APIKey)
+	query.Set("language", "th")
+	query.Set("region", "th")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(g.BaseURL, "/")+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := g.HTTP.Do(req)
+	if err != nil {
+		// error ของ net/http มี URL ทั้งหมด (รวม API Key) ติดมาด้วย จึงส่งต่อเฉพาะสาเหตุ
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("geocode: Google request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("geocode: Google returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	type latLng struct {
+		Lat float64 `json:"lat"`
+		Lng float64 `json:"lng"`
+	}
+	var result struct {
+		Status       string `json:"status"`
+		ErrorMessage string `json:"error_message"`
+		Results      []struct {
+			FormattedAddress string `json:"formatted_address"`
+			Geometry         struct {
+				Location latLng `json:"location"`
+				Viewport struct {
+					Northeast latLng `json:"northeast"`
+					Southwest latLng `json:"southwest"`
+				} `json:"viewport"`
+			} `json:"geometry"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	switch result.Status {
+	case "OK":
+	case "ZERO_RESULTS":
+		return nil, ErrNoMatch
+	default:
+		// เช่น OVER_QUERY_LIMIT, REQUEST_DENIED (API Key ผิด)
+		return nil, fmt.Errorf("geocode: Google returned %s: %s", result.Status, result.ErrorMessage)
+	}
+	if len(result.Results) == 0 {
+		return nil, ErrNoMatch
+	}
+
+	first := result.Results[0]
+	location, ne, sw := first.Geometry.Location, first.Geometry.Viewport.Northeast, first.Geometry.Viewport.Southwest
+	// ขนาดของสถานที่ประมาณจากครึ่งหนึ่งของเส้นทแยงมุม viewport
+	radiusM := geo.DistanceKm(ne.Lat, ne.Lng, sw.Lat, sw.Lng) * 1000 / 2
+	return &Place{
+		Text:        first.FormattedAddress,
+		Coordinates: model.Coordinates{Latitude: location.Lat, Longitude: location.Lng},
+		RadiusM:     math.Round(radiusM),
+	}, nil
+}
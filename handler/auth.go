@@ -1,62 +1,125 @@
 package handler
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"io/ioutil"
+	"errors"
 	"log"
 	"net/http"
-	"os"
+	"sort"
 	"strings"
 	"time"
 
+	"api-flash-dash/earnings"
+	"api-flash-dash/events"
+	"api-flash-dash/export"
+	"api-flash-dash/geo"
+	"api-flash-dash/geocode"
+	"api-flash-dash/identity"
+	"api-flash-dash/lifecycle"
+	"api-flash-dash/middleware"
 	"api-flash-dash/model"
+	"api-flash-dash/otp"
+	"api-flash-dash/phone"
+	"api-flash-dash/pricing"
+	"api-flash-dash/store"
 
-	"cloud.google.com/go/firestore"
 	"firebase.google.com/go/v4/auth"
 	"github.com/gin-gonic/gin"
-	"google.golang.org/api/iterator"
 )
 
+// AuthHandler ไม่ได้คุยกับ Firestore โดยตรง แต่เรียกผ่าน interface ใน package store
+// ทำให้สลับไปใช้ backend แบบ in-memory ได้ (ดู database.InitStore)
 type AuthHandler struct {
-	FirestoreClient *firestore.Client
-	AuthClient      *auth.Client
+	Users         store.UserStore
+	Addresses     store.AddressStore
+	Riders        store.RiderStore
+	Deliveries    store.DeliveryStore
+	Notifications store.NotificationStore
+	Events        *events.Bus
+	Ledger        store.LedgerStore
+	Pricing       *pricing.Engine
+	Earnings      earnings.Config
+	Geofence      geo.Fence
+	Verifications store.VerificationStore
+	OTP           otp.Config
+	SMS           otp.Sender
+	Identity      *identity.Client
+	Exports       store.ExportStore
+	ExportFiles   export.Storage
+	Export        export.Config
+	// Geocoder ตรวจและเติมข้อความ/พิกัดของที่อยู่ (nil = ไม่ได้เปิดใช้ แอปต้องส่งมาครบ)
+	Geocoder      *geocode.Resolver
+	AuthClient    *auth.Client
+	// CheckRevoked เปิดการตรวจ Token ที่ถูกเพิกถอนใน middleware.AuthMiddleware
+	CheckRevoked bool
+}
+
+// normalizePhone แปลงเบอร์ที่แอปส่งมาเป็น E.164 (ดู phone.Normalize)
+// ถ้าเบอร์ไม่ถูกต้องจะตอบ 400 กลับไปให้แล้ว และคืนค่า false
+func normalizePhone(c *gin.Context, raw string) (string, bool) {
+	normalized, err := phone.Normalize(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid phone number, expected a Thai mobile number such as 0812345678"})
+		return "", false
+	}
+	return normalized, true
 }
 
 // registerUserCore เป็นฟังก์ชันกลางสำหรับสร้างผู้ใช้ใน Auth และบันทึกข้อมูลพื้นฐานลง Firestore
-func (h *AuthHandler) registerUserCore(c *gin.Context, coreData model.UserCore, role string) (*auth.UserRecord, error) {
-	syntheticEmail := coreData.Phone + "@flashdash.app"
+// ทุกขั้นตอนลงทะเบียนขั้นตอนชดเชยไว้ใน reg ผู้เรียกต้องเรียก reg.rollback ถ้าขั้นตอนใดล้มเหลว
+func (h *AuthHandler) registerUserCore(c *gin.Context, reg *registration, coreData model.UserCore, role string) (*auth.UserRecord, error) {
+	ctx := c.Request.Context()
 
 	// 1. สร้างผู้ใช้ใน Firebase Authentication
 	params := (&auth.UserToCreate{}).
-		UID(coreData.Phone). // ใช้เบอร์โทรเป็น UID
-		Email(syntheticEmail).
+		UID(coreData.Phone). // ใช้เบอร์โทร (E.164) เป็น UID
+		Email(syntheticEmail(coreData.Phone)).
 		Password(coreData.Password).
 		DisplayName(coreData.Name).
 		PhotoURL(coreData.ImageProfile)
 
-	userRecord, err := h.AuthClient.CreateUser(c.Request.Context(), params)
+	userRecord, err := reg.createAuthUser(ctx, params)
 	if err != nil {
 		return nil, err
 	}
 
-	// 2. บันทึกข้อมูลพื้นฐานลงใน Collection "users"
-	userData := map[string]interface{}{
-		"name":          coreData.Name,
-		"phone":         coreData.Phone,
-		"role":          role,
-		"image_profile": coreData.ImageProfile,
+	// 2. บันทึกข้อมูลพื้นฐานลงใน Collection "users" (ลบพร้อม sub-collection ถ้าต้องย้อนกลับ)
+	userData := model.UserProfile{
+		Name:         coreData.Name,
+		Phone:        coreData.Phone,
+		Role:         role,
+		ImageProfile: coreData.ImageProfile,
+	}
+	err = reg.createDocument(ctx, "users document", func(ctx context.Context) error {
+		return h.Users.CreateUser(ctx, userRecord.UID, userData)
+	}, func(ctx context.Context) error {
+		return h.Users.DeleteUser(ctx, userRecord.UID)
+	})
+	if err != nil {
+		return nil, err
 	}
-	_, err = h.FirestoreClient.Collection("users").Doc(userRecord.UID).Set(c.Request.Context(), userData)
+
+	// 3. ตั้งค่า role ใน custom claims เพื่อให้ middleware.RequireRole ตรวจสอบจาก Token ได้
+	// (ไม่ต้องมีขั้นตอนชดเชย claims จะหายไปพร้อมผู้ใช้ใน Auth)
+	err = h.AuthClient.SetCustomUserClaims(ctx, userRecord.UID, middleware.RoleClaims(role))
 	if err != nil {
-		// Optional: ควรมี Logic ลบผู้ใช้ใน Auth ถ้าบันทึก Firestore ไม่สำเร็จ
 		return nil, err
 	}
 
 	return userRecord, nil
 }
 
+// respondRegistrationError ตอบกลับเมื่อการสมัครล้มเหลว หลังจากย้อนกลับขั้นตอนที่ทำไปแล้ว
+// (กรณีเบอร์นี้สมัครไว้แล้ว ไม่มีอะไรถูกสร้างใน Auth แต่ยังต้องคืน ticket)
+func respondRegistrationError(c *gin.Context, reg *registration, err error, message string) {
+	reg.rollback(err)
+	if auth.IsEmailAlreadyExists(err) || auth.IsUIDAlreadyExists(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "This phone number is already registered."})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
+
 // RegisterCustomerHandler สำหรับสมัครสมาชิกเป็น Customer
 func (h *AuthHandler) RegisterCustomerHandler(c *gin.Context) {
 	var payload model.RegisterCustomerPayload
@@ -64,24 +127,32 @@ func (h *AuthHandler) RegisterCustomerHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	var ok bool
+	if payload.UserCore.Phone, ok = normalizePhone(c, payload.UserCore.Phone); !ok {
+		return
+	}
+	// ตรวจที่อยู่ก่อนใช้ ticket เพื่อให้แก้ที่อยู่แล้วส่งใหม่ได้โดยไม่ต้องขอ OTP ใหม่
+	if !cleanAddressPayload(c, &payload.Address) || !h.resolveAddress(c, &payload.Address) {
+		return
+	}
+	reg := h.newRegistration(payload.UserCore.Phone)
+	// ต้องยืนยันความเป็นเจ้าของเบอร์ด้วย OTP มาก่อน (ticket ใช้ได้ครั้งเดียว)
+	if !reg.redeemTicket(c, payload.UserCore.VerificationTicket) {
+		return
+	}
 
 	// เรียกฟังก์ชันกลางเพื่อสร้างผู้ใช้
-	userRecord, err := h.registerUserCore(c, payload.UserCore, "customer")
+	userRecord, err := h.registerUserCore(c, reg, payload.UserCore, model.RoleCustomer)
 	if err != nil {
-		if auth.IsEmailAlreadyExists(err) || auth.IsUIDAlreadyExists(err) {
-			c.JSON(http.StatusConflict, gin.H{"error": "This phone number is already registered."})
-			return
-		}
-		log.Printf("Error creating user core: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		respondRegistrationError(c, reg, err, "Failed to create user")
 		return
 	}
 
-	// บันทึกข้อมูลที่อยู่ลงใน Sub-collection
-	_, _, err = h.FirestoreClient.Collection("users").Doc(userRecord.UID).Collection("addresses").Add(c.Request.Context(), payload.Address)
+	// บันทึกข้อมูลที่อยู่ลงใน Sub-collection (ถูกลบไปพร้อมเอกสาร "users" ถ้าต้องย้อนกลับ)
+	// ที่อยู่แรกเป็นที่อยู่หลักเสมอ (AddAddress ตั้งให้เอง)
+	_, err = h.Addresses.AddAddress(c.Request.Context(), userRecord.UID, payload.Address)
 	if err != nil {
-		log.Printf("Error saving address: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save address data"})
+		respondRegistrationError(c, reg, err, "Failed to save address data")
 		return
 	}
 
@@ -94,27 +165,43 @@ func (h *AuthHandler) RegisterRiderHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	var ok bool
+	if payload.UserCore.Phone, ok = normalizePhone(c, payload.UserCore.Phone); !ok {
+		return
+	}
+	reg := h.newRegistration(payload.UserCore.Phone)
+	// ต้องยืนยันความเป็นเจ้าของเบอร์ด้วย OTP มาก่อน (ticket ใช้ได้ครั้งเดียว)
+	if !reg.redeemTicket(c, payload.UserCore.VerificationTicket) {
+		return
+	}
 
-	userRecord, err := h.registerUserCore(c, payload.UserCore, "rider")
+	userRecord, err := h.registerUserCore(c, reg, payload.UserCore, model.RoleRider)
 	if err != nil {
-		if auth.IsEmailAlreadyExists(err) || auth.IsUIDAlreadyExists(err) {
-			c.JSON(http.StatusConflict, gin.H{"error": "This phone number is already registered."})
-			return
-		}
-		log.Printf("Error creating user core: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		respondRegistrationError(c, reg, err, "Failed to create user")
 		return
 	}
 
 	// บันทึกข้อมูล Rider ลงใน Collection "riders"
-	_, err = h.FirestoreClient.Collection("riders").Doc(userRecord.UID).Set(c.Request.Context(), payload.Rider)
+	// รับจากแอปเฉพาะข้อมูลรถ ส่วนสถานะการตรวจสอบเซิร์ฟเวอร์เป็นคนกำหนด (เริ่มที่ "pending_verification")
+	err = reg.createDocument(c.Request.Context(), "riders document", func(ctx context.Context) error {
+		return h.Riders.CreateRider(ctx, userRecord.UID, model.Rider{
+			ImageVehicle:        payload.Rider.ImageVehicle,
+			VehicleRegistration: payload.Rider.VehicleRegistration,
+			VerificationStatus:  model.RiderPendingVerification,
+		})
+	}, func(ctx context.Context) error {
+		return h.Riders.DeleteRider(ctx, userRecord.UID)
+	})
 	if err != nil {
-		log.Printf("Error saving rider details: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save rider data"})
+		respondRegistrationError(c, reg, err, "Failed to save rider data")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Rider registered successfully", "uid": userRecord.UID})
+	c.JSON(http.StatusOK, gin.H{
+		"message":            "Rider registered successfully",
+		"uid":                userRecord.UID,
+		"verificationStatus": model.RiderPendingVerification,
+	})
 }
 
 //-----------------------------------------------------------------------------------------------------------------------------------------//
@@ -133,90 +220,103 @@ func (h *AuthHandler) LoginHandler(c *gin.Context) {
 		return
 	}
 
-	syntheticEmail := req.Phone + "@flashdash.app"
-
-	// 1. ยิง API ไปยัง Firebase Auth REST API เพื่อ Sign-in
-	// !!! สำคัญ: ควรเก็บ FIREBASE_WEB_API_KEY ไว้ใน Environment Variable !!!
-	apiKey := os.Getenv("FIREBASE_WEB_API_KEY")
-	restApiURL := "https://identitytoolkit.googleapis.com/v1/accounts:signInWithPassword?key=" + apiKey
-
-	requestBody, _ := json.Marshal(map[string]interface{}{
-		"email":             syntheticEmail,
-		"password":          req.Password,
-		"returnSecureToken": true,
-	})
-
-	resp, err := http.Post(restApiURL, "application/json", bytes.NewBuffer(requestBody))
-	if err != nil {
-		log.Printf("Error calling Firebase REST API: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate with Firebase"})
+	phoneE164, ok := normalizePhone(c, req.Phone)
+	if !ok {
 		return
 	}
-	defer resp.Body.Close()
-
-	body, _ := ioutil.ReadAll(resp.Body)
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Firebase auth failed with status: %d, body: %s", resp.StatusCode, string(body))
+	// 1. ล็อกอินผ่าน Firebase Auth REST API (ดู identity.Client)
+	token, err := h.Identity.SignInWithPassword(c.Request.Context(), syntheticEmail(phoneE164), req.Password)
+	if errors.Is(err, identity.ErrUserDisabled) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This account has been suspended"})
+		return
+	}
+	if errors.Is(err, identity.ErrInvalidCredentials) {
+		log.Printf("Firebase sign-in failed for %s: %v", phoneE164, err)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid phone number or password"})
 		return
 	}
+	if err != nil {
+		log.Printf("Error calling Firebase REST API: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate with Firebase"})
+		return
+	}
+	uid := token.UID
 
-	var firebaseResp map[string]interface{}
-	json.Unmarshal(body, &firebaseResp)
-
-	idToken := firebaseResp["idToken"].(string)
-	uid := firebaseResp["localId"].(string)
-
-	// 2. ดึงข้อมูลพื้นฐานจาก Firestore Collection "users"
-	userDoc, err := h.FirestoreClient.Collection("users").Doc(uid).Get(c.Request.Context())
+	// 2. ดึงข้อมูลพื้นฐานจาก Collection "users"
+	userProfile, err := h.Users.GetUser(c.Request.Context(), uid)
 	if err != nil {
-		log.Printf("Error getting user from Firestore: %v\n", err)
+		log.Printf("Error getting user from store: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user data"})
 		return
 	}
-	userProfile := userDoc.Data()
 
 	// 3. ตรวจสอบ Role และดึงข้อมูลเพิ่มเติม
-	role := userProfile["role"].(string)
 	var roleSpecificData interface{} // เตรียมตัวแปรไว้เก็บข้อมูลเฉพาะทาง
 
-	if role == "customer" {
+	if userProfile.Role == "customer" {
 		// ดึงข้อมูลที่อยู่ทั้งหมดจาก sub-collection "addresses"
-		var addresses []map[string]interface{}
-		iter := h.FirestoreClient.Collection("users").Doc(uid).Collection("addresses").Documents(c.Request.Context())
-		for {
-			doc, err := iter.Next()
-			if err == iterator.Done {
-				break
-			}
-			if err != nil {
-				log.Printf("Failed to iterate addresses: %v", err)
-				break // หรือจัดการ error ตามความเหมาะสม
-			}
-			addressData := doc.Data()
-			addressData["id"] = doc.Ref.ID // เพิ่ม document ID เข้าไปในข้อมูลด้วย
-			addresses = append(addresses, addressData)
+		addresses, err := h.getAllUserAddresses(uid)
+		if err != nil {
+			log.Printf("Failed to list addresses: %v", err) // หรือจัดการ error ตามความเหมาะสม
 		}
 		roleSpecificData = addresses
 
-	} else if role == "rider" {
+	} else if userProfile.Role == "rider" {
 		// ดึงข้อมูล Rider จาก collection "riders"
-		riderDoc, err := h.FirestoreClient.Collection("riders").Doc(uid).Get(c.Request.Context())
+		rider, err := h.Riders.GetRider(c.Request.Context(), uid)
 		if err == nil { // ตรวจสอบว่ามีข้อมูลจริง
-			roleSpecificData = riderDoc.Data()
+			roleSpecificData = rider
 		}
 	}
 
 	// 4. รวบรวมข้อมูลทั้งหมดเพื่อส่งกลับ
 	c.JSON(http.StatusOK, gin.H{
 		"message":          "Login successful",
-		"idToken":          idToken,
+		"idToken":          token.IDToken,
+		"refreshToken":     token.RefreshToken, // ใช้กับ POST /auth/refresh เมื่อ idToken หมดอายุ
+		"expiresIn":        token.ExpiresIn,    // อายุของ idToken (วินาที)
 		"userProfile":      userProfile,
 		"roleSpecificData": roleSpecificData, // ข้อมูลจะเปลี่ยนไปตาม Role
 	})
 }
 
+// RefreshTokenRequest คือ struct สำหรับขอ ID Token ใหม่
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+// RefreshTokenHandler แลก refreshToken (ได้จากตอนล็อกอิน) เป็น idToken ใหม่ก่อนของเดิมหมดอายุ (1 ชั่วโมง)
+func (h *AuthHandler) RefreshTokenHandler(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := h.Identity.Refresh(c.Request.Context(), req.RefreshToken)
+	if errors.Is(err, identity.ErrUserDisabled) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This account has been suspended"})
+		return
+	}
+	if errors.Is(err, identity.ErrInvalidRefreshToken) {
+		// แอปต้องให้ผู้ใช้ล็อกอินใหม่
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired, please log in again"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error refreshing token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"idToken":      token.IDToken,
+		"refreshToken": token.RefreshToken, // Firebase อาจออก refreshToken ใหม่ ให้แอปเก็บค่านี้แทนของเดิม
+		"expiresIn":    token.ExpiresIn,
+	})
+}
+
 //-----------------------------------------------------------------------------------------------------------------------------------------//
 
 // UpdateUserProfile คือ Handler สำหรับอัปเดตข้อมูลผู้ใช้
@@ -238,11 +338,11 @@ func (h *AuthHandler) UpdateUserProfile(c *gin.Context) {
 
 	// 3. เตรียมข้อมูลที่จะอัปเดต
 	authParams := &auth.UserToUpdate{}
-	var firestoreUpdates []firestore.Update
+	var userUpdate store.UserUpdate
 
 	if payload.Name != nil {
 		authParams.DisplayName(*payload.Name)
-		firestoreUpdates = append(firestoreUpdates, firestore.Update{Path: "name", Value: *payload.Name})
+		userUpdate.Name = payload.Name
 	}
 	if payload.Password != nil && *payload.Password != "" {
 		if len(*payload.Password) < 6 {
@@ -253,7 +353,7 @@ func (h *AuthHandler) UpdateUserProfile(c *gin.Context) {
 	}
 	if payload.ImageProfile != nil {
 		authParams.PhotoURL(*payload.ImageProfile)
-		firestoreUpdates = append(firestoreUpdates, firestore.Update{Path: "image_profile", Value: *payload.ImageProfile})
+		userUpdate.ImageProfile = payload.ImageProfile
 	}
 
 	// 4. สั่งอัปเดตข้อมูลใน Firebase Authentication
@@ -261,10 +361,21 @@ func (h *AuthHandler) UpdateUserProfile(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update Firebase Auth user: " + err.Error()})
 		return
 	}
+	// เปลี่ยนรหัสผ่านแล้ว ต้องเพิกถอน session เดิมทั้งหมด (เช่น เครื่องที่ถูกขโมย)
+	passwordChanged := payload.Password != nil && *payload.Password != ""
+	var session *identity.Token
+	if passwordChanged {
+		var err error
+		if session, err = h.revokeSessions(context.Background(), uidStr, *payload.Password); err != nil {
+			log.Printf("Error revoking sessions of %s: %v", uidStr, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Password was changed but other sessions could not be signed out, please log out manually"})
+			return
+		}
+	}
 
-	// 5. สั่งอัปเดตข้อมูลใน Firestore (ถ้ามี)
-	if len(firestoreUpdates) > 0 {
-		if _, err := h.FirestoreClient.Collection("users").Doc(uidStr).Update(context.Background(), firestoreUpdates); err != nil {
+	// 5. สั่งอัปเดตข้อมูลใน Collection "users" (ถ้ามี)
+	if !userUpdate.IsEmpty() {
+		if err := h.Users.UpdateUser(context.Background(), uidStr, userUpdate); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update Firestore user: " + err.Error()})
 			return
 		}
@@ -277,52 +388,36 @@ func (h *AuthHandler) UpdateUserProfile(c *gin.Context) {
 		return
 	}
 
-	// ดึง ID Token เดิมจาก Header เพื่อส่งกลับไปให้แอปใช้ต่อ
-	authHeader := c.GetHeader("Authorization")
-	idToken := strings.Replace(authHeader, "Bearer ", "", 1)
-
 	// 7. ส่งข้อความและข้อมูลที่อัปเดตแล้วกลับไปในโครงสร้างที่สมบูรณ์
-	c.JSON(http.StatusOK, gin.H{
+	// idToken คือ Token เดิมจาก Header หรือ Token ใหม่ถ้าเปลี่ยนรหัสผ่าน (ดู sessionResponse)
+	c.JSON(http.StatusOK, sessionResponse(c, gin.H{
 		"message":          "อัปเดตโปรไฟล์สำเร็จ",
-		"idToken":          idToken,                         // <-- เพิ่ม idToken เข้าไป
 		"userProfile":      updatedData["userProfile"],      // <-- แยก userProfile ออกมา
 		"roleSpecificData": updatedData["roleSpecificData"], // <-- แยก roleSpecificData ออกมา
-	})
+	}, passwordChanged, session))
 }
 
 // --- ฟังก์ชันเสริม (Helper Function) ---
-// getUserDataByUID ดึงข้อมูลผู้ใช้ทั้งหมดจาก Firestore ตาม UID
+// getUserDataByUID ดึงข้อมูลผู้ใช้ทั้งหมดจาก store ตาม UID
 func (h *AuthHandler) getUserDataByUID(uid string) (map[string]interface{}, error) {
-	userDoc, err := h.FirestoreClient.Collection("users").Doc(uid).Get(context.Background())
+	userProfile, err := h.Users.GetUser(context.Background(), uid)
 	if err != nil {
-		log.Printf("Error getting user from Firestore: %v\n", err)
+		log.Printf("Error getting user from store: %v\n", err)
 		return nil, err
 	}
-	userProfile := userDoc.Data()
 
-	role := userProfile["role"].(string)
 	var roleSpecificData interface{}
 
-	if role == "customer" {
-		var addresses []map[string]interface{}
-		iter := h.FirestoreClient.Collection("users").Doc(uid).Collection("addresses").Documents(context.Background())
-		for {
-			doc, err := iter.Next()
-			if err == iterator.Done {
-				break
-			}
-			if err != nil {
-				return nil, err
-			}
-			addressData := doc.Data()
-			addressData["id"] = doc.Ref.ID
-			addresses = append(addresses, addressData)
+	if userProfile.Role == "customer" {
+		addresses, err := h.getAllUserAddresses(uid)
+		if err != nil {
+			return nil, err
 		}
 		roleSpecificData = addresses
-	} else if role == "rider" {
-		riderDoc, err := h.FirestoreClient.Collection("riders").Doc(uid).Get(context.Background())
+	} else if userProfile.Role == "rider" {
+		rider, err := h.Riders.GetRider(context.Background(), uid)
 		if err == nil {
-			roleSpecificData = riderDoc.Data()
+			roleSpecificData = rider
 		}
 	}
 
@@ -354,12 +449,15 @@ func (h *AuthHandler) AddUserAddress(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
 		return
 	}
+	if !cleanAddressPayload(c, &payload) || !h.resolveAddress(c, &payload) {
+		return
+	}
 
 	// 3. เพิ่มข้อมูลลงใน sub-collection 'addresses' ของผู้ใช้คนนั้น
-	// Firestore จะสร้าง Document ID ให้โดยอัตโนมัติ
-	_, _, err := h.FirestoreClient.Collection("users").Doc(uidStr).Collection("addresses").Add(context.Background(), payload)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add new address: " + err.Error()})
+	// ที่อยู่แรกของผู้ใช้เป็นที่อยู่หลักเสมอ และถ้าขอให้เป็นที่อยู่หลัก ที่อยู่หลักเดิมจะถูกยกเลิกใน Transaction เดียวกัน
+	if _, err := h.Addresses.AddAddress(context.Background(), uidStr, payload); err != nil {
+		log.Printf("Error adding address of %s: %v", uidStr, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add new address"})
 		return
 	}
 
@@ -401,11 +499,30 @@ func (h *AuthHandler) UpdateUserAddress(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
 		return
 	}
+	if !cleanAddressPayload(c, &payload) || !h.resolveAddress(c, &payload) {
+		return
+	}
+
+	// ยกเลิกที่อยู่หลักด้วยการอัปเดตไม่ได้ (ต้องเลือกที่อยู่หลักใหม่แทน) จึงไม่ทำให้ผู้ใช้ไม่มีที่อยู่หลัก
+	current, err := h.Addresses.GetAddress(context.Background(), uidStr, addressId)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting address %s of %s: %v", addressId, uidStr, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update address"})
+		return
+	}
+	payload.IsDefault = payload.IsDefault || current.IsDefault
 
 	// 4. อัปเดตข้อมูลใน Document ของที่อยู่นั้นๆ (ใช้ Set เพื่อเขียนทับทั้งหมด)
-	_, err := h.FirestoreClient.Collection("users").Doc(uidStr).Collection("addresses").Doc(addressId).Set(context.Background(), payload)
+	// ถ้าขอให้เป็นที่อยู่หลัก ที่อยู่หลักเดิมจะถูกยกเลิกใน Transaction เดียวกัน
+	// delivery ที่สร้างไปแล้วเก็บสำเนาของที่อยู่ไว้เอง จึงไม่เปลี่ยนตาม
+	err = h.Addresses.SetAddress(context.Background(), uidStr, addressId, payload)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update address: " + err.Error()})
+		log.Printf("Error updating address %s of %s: %v", addressId, uidStr, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update address"})
 		return
 	}
 
@@ -423,51 +540,154 @@ func (h *AuthHandler) UpdateUserAddress(c *gin.Context) {
 	})
 }
 
-// --- ฟังก์ชันเสริม (Helper Function) ---
-// getAllUserAddresses ดึงที่อยู่ทั้งหมดของผู้ใช้คนนั้นๆ
-func (h *AuthHandler) getAllUserAddresses(uid string) ([]map[string]interface{}, error) {
-	var addresses []map[string]interface{}
-	iter := h.FirestoreClient.Collection("users").Doc(uid).Collection("addresses").Documents(context.Background())
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			return nil, err
-		}
+// DeleteUserAddress คือ Handler สำหรับลบที่อยู่
+// delivery ที่ใช้ที่อยู่นี้ไปแล้วไม่ได้รับผลกระทบ เพราะเก็บสำเนาของที่อยู่ไว้ในเอกสาร delivery เอง
+// ถ้าลบที่อยู่หลัก ที่อยู่อื่นที่เหลือจะถูกตั้งเป็นที่อยู่หลักแทน
+func (h *AuthHandler) DeleteUserAddress(c *gin.Context) {
+	// 1. ดึง UID และ Address ID
+	uidStr := c.GetString("uid")
+	addressId := c.Param("addressId")
 
-		data := doc.Data()
+	// 2. ลบที่อยู่
+	err := h.Addresses.DeleteAddress(context.Background(), uidStr, addressId)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting address %s of %s: %v", addressId, uidStr, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete address"})
+		return
+	}
+
+	// 3. ส่งรายการที่อยู่ล่าสุดกลับไป
+	allAddresses, err := h.getAllUserAddresses(uidStr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve updated address list"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "ลบที่อยู่สำเร็จ",
+		"addresses": allAddresses,
+	})
+}
 
-		coords, _ := data["coordinates"].(map[string]interface{})
+// SetDefaultUserAddress คือ Handler สำหรับตั้งที่อยู่หลัก (ที่อยู่หลักเดิมจะถูกยกเลิก)
+func (h *AuthHandler) SetDefaultUserAddress(c *gin.Context) {
+	// 1. ดึง UID และ Address ID
+	uidStr := c.GetString("uid")
+	addressId := c.Param("addressId")
+
+	// 2. ตั้งที่อยู่หลัก
+	err := h.Addresses.SetDefaultAddress(context.Background(), uidStr, addressId)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error setting default address %s of %s: %v", addressId, uidStr, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set default address"})
+		return
+	}
 
-		address := map[string]interface{}{
-			"id":     doc.Ref.ID, // ✅ เพิ่ม id กลับไปด้วย
-			"detail": data["detail"],
-			"coordinates": map[string]interface{}{
-				"latitude":  coords["latitude"],
-				"longitude": coords["longitude"],
-			},
+	// 3. ส่งรายการที่อยู่ล่าสุดกลับไป
+	allAddresses, err := h.getAllUserAddresses(uidStr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve updated address list"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "ตั้งที่อยู่หลักสำเร็จ",
+		"addresses": allAddresses,
+	})
+}
+
+// --- ฟังก์ชันเสริม (Helper Function) ---
+// getAllUserAddresses ดึงที่อยู่ทั้งหมดของผู้ใช้คนนั้นๆ (ที่อยู่หลักอยู่ลำดับแรก)
+// ผู้ใช้เดิมที่สร้างที่อยู่ก่อนมีที่อยู่หลักจะไม่มีที่อยู่หลักเลย จึงตั้งที่อยู่แรกเป็นที่อยู่หลักให้ตอนอ่าน
+func (h *AuthHandler) getAllUserAddresses(uid string) ([]model.Address, error) {
+	// model.Address มี id ติดกลับไปด้วยอยู่แล้ว
+	addresses, err := h.Addresses.ListAddresses(context.Background(), uid)
+	if err != nil {
+		return nil, err
+	}
+	if len(addresses) > 0 && !hasDefaultAddress(addresses) {
+		if err := h.Addresses.SetDefaultAddress(context.Background(), uid, addresses[0].ID); err != nil {
+			// ไม่ทำให้การอ่านล้มเหลว จะลองใหม่ในการอ่านครั้งถัดไป
+			log.Printf("Failed to set fallback default address %s of %s: %v", addresses[0].ID, uid, err)
+		} else {
+			addresses[0].IsDefault = true
 		}
-		addresses = append(addresses, address)
 	}
+	sort.SliceStable(addresses, func(i, j int) bool { return addresses[i].IsDefault && !addresses[j].IsDefault })
 	return addresses, nil
 }
 
+// hasDefaultAddress บอกว่ามีที่อยู่หลักอยู่ในรายการหรือไม่
+func hasDefaultAddress(addresses []model.Address) bool {
+	for _, address := range addresses {
+		if address.IsDefault {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanAddressPayload ตัดช่องว่างของข้อความ และแปลงเบอร์ผู้ติดต่อเป็น E.164
+// ถ้าเบอร์ไม่ถูกต้องจะตอบ 400 กลับไปให้แล้ว และคืนค่า false
+func cleanAddressPayload(c *gin.Context, payload *model.AddressPayload) bool {
+	payload.Detail = strings.TrimSpace(payload.Detail)
+	payload.Label = strings.TrimSpace(payload.Label)
+	payload.ContactName = strings.TrimSpace(payload.ContactName)
+	payload.AccessNotes = strings.TrimSpace(payload.AccessNotes)
+	if strings.TrimSpace(payload.ContactPhone) == "" {
+		payload.ContactPhone = ""
+		return true
+	}
+	var ok bool
+	payload.ContactPhone, ok = normalizePhone(c, payload.ContactPhone)
+	return ok
+}
+
+// resolveAddress ตรวจและเติมข้อความ/พิกัดของที่อยู่ด้วย geocoder (ดู geocode.Resolver)
+// ถ้าใช้ที่อยู่นี้ไม่ได้จะตอบกลับไปให้แล้ว และคืนค่า false
+func (h *AuthHandler) resolveAddress(c *gin.Context, payload *model.AddressPayload) bool {
+	err := h.Geocoder.Resolve(c.Request.Context(), payload)
+	switch {
+	case err == nil:
+		if payload.Geocode.Mismatch() {
+			log.Printf("Address %q does not match its coordinates (%.0f m from %q)", payload.Detail, *payload.Geocode.DistanceM, payload.Geocode.MatchedText)
+		}
+		return true
+	case errors.Is(err, geocode.ErrIncomplete):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Address detail and coordinates are required"})
+	case errors.Is(err, geocode.ErrInvalidCoordinates):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Coordinates are out of range"})
+	case errors.Is(err, geocode.ErrNoMatch):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Could not find this address, please add more detail or pin the location on the map"})
+	default:
+		log.Printf("Error geocoding address %q: %v", payload.Detail, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Address lookup is unavailable, please send both the address detail and the pinned location"})
+	}
+	return false
+}
+
 // -----------------------------------------------------------------------------------------------------------------------------------------//
 // **** เพิ่มฟังก์ชันใหม่สำหรับค้นหาผู้ใช้ ****
 // FindUserByPhone ค้นหาผู้ใช้ด้วยเบอร์โทรศัพท์และคืนค่าชื่อพร้อมที่อยู่ทั้งหมด
 func (h *AuthHandler) FindUserByPhone(c *gin.Context) {
-	phone := c.Query("phone")
-	if phone == "" {
+	rawPhone := c.Query("phone")
+	if rawPhone == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Phone number query parameter is required"})
 		return
 	}
+	phoneE164, ok := normalizePhone(c, rawPhone)
+	if !ok {
+		return
+	}
 
-	query := h.FirestoreClient.Collection("users").Where("phone", "==", phone).Limit(1)
-	iter := query.Documents(context.Background())
-	doc, err := iter.Next()
-	if err == iterator.Done {
+	userProfile, err := h.Users.FindUserByPhone(context.Background(), phoneE164)
+	if errors.Is(err, store.ErrNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "ไม่พบผู้ใช้"})
 		return
 	}
@@ -476,41 +696,12 @@ func (h *AuthHandler) FindUserByPhone(c *gin.Context) {
 		return
 	}
 
-	var userProfile model.UserProfile
-	if err := doc.DataTo(&userProfile); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user profile"})
+	// ดึงข้อมูลที่อยู่ทั้งหมดจาก sub-collection ในรูปแบบ []model.Address
+	addresses, err := h.Addresses.ListAddresses(context.Background(), userProfile.UID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user addresses"})
 		return
 	}
-	uid := doc.Ref.ID
-
-	// --- 1. จุดแก้ไขหลัก ---
-	// สร้าง slice สำหรับเก็บข้อมูลประเภท []model.Address โดยตรง
-	var addresses []model.Address
-
-	// 2. ดึงข้อมูลที่อยู่ทั้งหมดจาก sub-collection
-	addrIter := h.FirestoreClient.Collection("users").Doc(uid).Collection("addresses").Documents(context.Background())
-	for {
-		addrDoc, err := addrIter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user addresses"})
-			return
-		}
-
-		// 3. แปลงข้อมูล Firestore แต่ละอันให้เป็น struct model.Address
-		var address model.Address
-		if err := addrDoc.DataTo(&address); err != nil {
-			log.Printf("Could not convert address data: %v", err)
-			continue // ข้ามที่อยู่ที่มีปัญหาไป
-		}
-		address.ID = addrDoc.Ref.ID // เพิ่ม ID เข้าไปใน struct ด้วย
-
-		// 4. เพิ่ม struct ที่แปลงแล้วเข้าไปใน slice
-		addresses = append(addresses, address)
-	}
-	// --- จบส่วนแก้ไข ---
 
 	// 5. สร้างข้อมูลเพื่อส่งกลับ (ตอนนี้ชนิดข้อมูลถูกต้องแล้ว)
 	response := model.FindUserResponse{
@@ -518,7 +709,7 @@ func (h *AuthHandler) FindUserByPhone(c *gin.Context) {
 		Phone:        userProfile.Phone,        // ++ เพิ่มเข้ามา
 		ImageProfile: userProfile.ImageProfile, // ++ เพิ่มเข้ามา
 		Role:         userProfile.Role,         // ++ เพิ่มเข้ามา
-		Addresses:    addresses,
+		Addresses:    model.PublicAddresses(addresses),
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -540,43 +731,62 @@ func (h *AuthHandler) CreateDeliveryHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
 		return
 	}
+	// เบอร์ผู้รับคือ UID ของผู้รับ ต้องอยู่ในรูปแบบเดียวกับตอนสมัคร
+	var ok bool
+	if payload.ReceiverPhone, ok = normalizePhone(c, payload.ReceiverPhone); !ok {
+		return
+	}
 
 	// 3. ดึงข้อมูลที่อยู่เต็มๆ ของผู้ส่งและผู้รับจาก Firestore
 	// (เพื่อเก็บข้อมูลทั้งหมดไว้ในเอกสาร delivery ป้องกันปัญหาถ้า user ลบที่อยู่ทิ้งในอนาคต)
-	senderAddrDoc, err := h.FirestoreClient.Collection("users").Doc(senderUIDStr).Collection("addresses").Doc(payload.SenderAddressID).Get(context.Background())
+	senderAddress, err := h.Addresses.GetAddress(context.Background(), senderUIDStr, payload.SenderAddressID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve sender address"})
 		return
 	}
 
-	receiverAddrDoc, err := h.FirestoreClient.Collection("users").Doc(payload.ReceiverPhone).Collection("addresses").Doc(payload.ReceiverAddressID).Get(context.Background())
+	receiverAddress, err := h.Addresses.GetAddress(context.Background(), payload.ReceiverPhone, payload.ReceiverAddressID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve receiver address"})
 		return
 	}
 
+	// คำนวณค่าส่งฝั่งเซิร์ฟเวอร์ และล็อกไว้ในเอกสาร (ไม่เชื่อราคาที่แอปส่งมา)
+	fare := h.quoteFare(c, *senderAddress, *receiverAddress, payload.VehicleType)
+	if fare == nil {
+		return
+	}
+
 	// 4. สร้างเอกสารใหม่ใน Collection 'deliveries'
-	deliveryData := map[string]interface{}{
-		"senderUID":       senderUIDStr,
-		"senderAddress":   senderAddrDoc.Data(),
-		"receiverUID":     payload.ReceiverPhone,
-		"receiverAddress": receiverAddrDoc.Data(),
-		"itemDescription": payload.ItemDescription,
-		"itemImage":       payload.ItemImageFilename,
-		"riderNoteImage":  payload.RiderNoteImageFilename,
-		"status":          "pending",  // สถานะเริ่มต้น
-		"createdAt":       time.Now(), // เวลาที่สร้าง
-		"riderUID":        nil,        // ยังไม่มีไรเดอร์รับงาน
-	}
-
-	_, _, err = h.FirestoreClient.Collection("deliveries").Add(context.Background(), deliveryData)
+	deliveryData := model.Delivery{
+		SenderUID:       senderUIDStr,
+		SenderAddress:   senderAddress.Snapshot(),
+		ReceiverUID:     payload.ReceiverPhone,
+		ReceiverAddress: receiverAddress.Snapshot(),
+		ItemDescription: payload.ItemDescription,
+		ItemImage:       payload.ItemImageFilename,
+		RiderNoteImage:  payload.RiderNoteImageFilename,
+		CreatedAt:       time.Now(), // เวลาที่สร้าง
+		RiderUID:        nil,        // ยังไม่มีไรเดอร์รับงาน
+		Fare:            fare,
+	}
+	// เก็บ geohash ของจุดรับสินค้าไว้ เพื่อให้ไรเดอร์ค้นหางานใกล้ตัวได้
+	deliveryData.SenderGeohash = geo.Encode(senderAddress.Coordinates.Latitude, senderAddress.Coordinates.Longitude, geo.DefaultPrecision)
+	// ตั้งสถานะเริ่มต้น ("pending") และสร้างประวัติรายการแรก
+	initialChange := lifecycle.Create(&deliveryData, lifecycle.Actor{UID: senderUIDStr, Role: lifecycle.RoleSender})
+
+	deliveryId, err := h.Deliveries.CreateDelivery(context.Background(), deliveryData, initialChange)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create delivery record: " + err.Error()})
 		return
 	}
 
 	// 5. ส่งข้อความกลับไปหาแอป
-	c.JSON(http.StatusCreated, gin.H{"message": "สร้างการจัดส่งสำเร็จ!"})
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "สร้างการจัดส่งสำเร็จ!",
+		"deliveryId": deliveryId,
+		"fare":       fare,
+	})
 }
 
 // GetUserDeliveries ดึงรายการจัดส่งที่ผู้ใช้เป็น "ผู้ส่ง" และ "ผู้รับ"
@@ -585,19 +795,26 @@ func (h *AuthHandler) GetUserDeliveries(c *gin.Context) {
 	uidStr := uid.(string)
 
 	// 1. ค้นหารายการที่ผู้ใช้เป็น "ผู้ส่ง"
-	sentDeliveries, err := h.queryDeliveries("senderUID", uidStr)
+	sentDeliveries, err := h.queryDeliveries(store.DeliveryFilter{SenderUID: uidStr})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sent deliveries"})
 		return
 	}
 
 	// 2. ค้นหารายการที่ผู้ใช้เป็น "ผู้รับ"
-	receivedDeliveries, err := h.queryDeliveries("receiverUID", uidStr)
+	receivedDeliveries, err := h.queryDeliveries(store.DeliveryFilter{ReceiverUID: uidStr})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get received deliveries"})
 		return
 	}
 
+	// PIN ยืนยันการรับของแสดงให้ผู้รับเห็นเท่านั้น และเฉพาะงานที่ยังไม่จบ
+	for i := range receivedDeliveries {
+		if !lifecycle.IsFinal(receivedDeliveries[i].Status) && !receivedDeliveries[i].PINLocked {
+			receivedDeliveries[i].ReceiverPIN = receivedDeliveries[i].DeliveryPIN
+		}
+	}
+
 	// 3. ส่งข้อมูลทั้งสองรายการกลับไป
 	c.JSON(http.StatusOK, gin.H{
 		"sentDeliveries":     sentDeliveries,
@@ -607,57 +824,42 @@ func (h *AuthHandler) GetUserDeliveries(c *gin.Context) {
 
 // --- ฟังก์ชันเสริม (Helper Function) ที่แก้ไขแล้ว ---
 // queryDeliveries คือฟังก์ชันที่ใช้ในการค้นหาข้อมูลใน collection 'deliveries'
-func (h *AuthHandler) queryDeliveries(field, uid string) ([]model.Delivery, error) {
-	var deliveries []model.Delivery
+func (h *AuthHandler) queryDeliveries(filter store.DeliveryFilter) ([]model.Delivery, error) {
 	ctx := context.Background()
 
-	iter := h.FirestoreClient.Collection("deliveries").Where(field, "==", uid).Documents(ctx)
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			log.Printf("Failed to iterate deliveries: %v", err)
-			return nil, err
-		}
+	deliveries, err := h.Deliveries.ListDeliveries(ctx, filter)
+	if err != nil {
+		log.Printf("Failed to iterate deliveries: %v", err)
+		return nil, err
+	}
 
-		var delivery model.Delivery
-		if err := doc.DataTo(&delivery); err != nil {
-			log.Printf("Failed to convert delivery data: %v", err)
-			continue // ข้ามเอกสารที่มีปัญหา
-		}
-		delivery.ID = doc.Ref.ID
-
-		// --- จุดแก้ไข: ดึงชื่อและรูปโปรไฟล์ของผู้ส่งและผู้รับ ---
-		senderProfile, _ := h.FirestoreClient.Collection("users").Doc(delivery.SenderUID).Get(ctx)
-		if senderProfile != nil {
-			senderData := senderProfile.Data()
-			if name, ok := senderData["name"].(string); ok {
-				delivery.SenderName = name
-			}
-			// ดึงรูปโปรไฟล์ผู้ส่ง
-			if img, ok := senderData["image_profile"].(string); ok {
-				delivery.SenderImageProfile = img
-			}
-		}
+	// ดึงชื่อและรูปโปรไฟล์ของผู้ส่งและผู้รับ
+	for i := range deliveries {
+		h.enrichDelivery(ctx, &deliveries[i])
+	}
+	return deliveries, nil
+}
 
-		receiverProfile, _ := h.FirestoreClient.Collection("users").Doc(delivery.ReceiverUID).Get(ctx)
-		if receiverProfile != nil {
-			receiverData := receiverProfile.Data()
-			if name, ok := receiverData["name"].(string); ok {
-				delivery.ReceiverName = name
-			}
-			// ดึงรูปโปรไฟล์ผู้รับ
-			if img, ok := receiverData["image_profile"].(string); ok {
-				delivery.ReceiverImageProfile = img
-			}
+// enrichDelivery เติมชื่อและรูปโปรไฟล์ของผู้ส่งและผู้รับ (และไรเดอร์ถ้ามี) ลงใน delivery
+func (h *AuthHandler) enrichDelivery(ctx context.Context, delivery *model.Delivery) {
+	if sender, err := h.Users.GetUser(ctx, delivery.SenderUID); err == nil {
+		delivery.SenderName = sender.Name
+		delivery.SenderImageProfile = sender.ImageProfile
+	}
+	if receiver, err := h.Users.GetUser(ctx, delivery.ReceiverUID); err == nil {
+		delivery.ReceiverName = receiver.Name
+		delivery.ReceiverImageProfile = receiver.ImageProfile
+	}
+	if delivery.RiderUID != nil {
+		if riderProfile, err := h.Users.GetUser(ctx, *delivery.RiderUID); err == nil {
+			delivery.RiderName = riderProfile.Name
+			delivery.RiderImageProfile = riderProfile.ImageProfile
+		}
+		if rider, err := h.Riders.GetRider(ctx, *delivery.RiderUID); err == nil {
+			summary := riderRatingSummary(rider)
+			delivery.RiderRating = &summary
 		}
-		// --- จบส่วนแก้ไข ---
-
-		deliveries = append(deliveries, delivery)
 	}
-	return deliveries, nil
 }
 
 // GetAllCustomersHandler ดึงข้อมูลลูกค้าทั้งหมด (ที่ไม่ใช่ rider และไม่ใช่ตัวเอง)
@@ -675,52 +877,25 @@ func (h *AuthHandler) GetAllCustomersHandler(c *gin.Context) {
 	// --- จบส่วนแก้ไข ---
 
 	// 2. Query ผู้ใช้ทั้งหมดที่เป็น "customer"
-	iter := h.FirestoreClient.Collection("users").Where("role", "==", "customer").Documents(ctx)
-	
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			log.Printf("Failed to iterate customers: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve customers"})
-			return
-		}
+	users, err := h.Users.ListUsersByRole(ctx, model.RoleCustomer)
+	if err != nil {
+		log.Printf("Failed to iterate customers: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve customers"})
+		return
+	}
 
+	for _, userProfile := range users {
 		// --- 3. จุดแก้ไข: ตรวจสอบว่า User ที่วนลูปเจอ คือ "ตัวเอง" หรือไม่ ---
-		customerUID := doc.Ref.ID
+		customerUID := userProfile.UID
 		if customerUID == senderUID {
 			continue // ถ้าใช่ ให้ข้ามไปคนถัดไป
 		}
 		// --- จบส่วนแก้ไข ---
 
-		var userProfile model.UserProfile
-		if err := doc.DataTo(&userProfile); err != nil {
-			log.Printf("Failed to parse user profile: %v", err)
-			continue // ข้าม user ที่มีปัญหา
-		}
-
 		// 4. สำหรับลูกค้าแต่ละคน, ดึงที่อยู่ (addresses) ทั้งหมดของเขา
-		var addresses []model.Address
-		addrIter := h.FirestoreClient.Collection("users").Doc(customerUID).Collection("addresses").Documents(ctx) // ใช้ customerUID
-		for {
-			addrDoc, err := addrIter.Next()
-			if err == iterator.Done {
-				break
-			}
-			if err != nil {
-				log.Printf("Failed to get address for user %s: %v", customerUID, err)
-				break 
-			}
-
-			var address model.Address
-			if err := addrDoc.DataTo(&address); err != nil {
-				log.Printf("Could not convert address data: %v", err)
-				continue
-			}
-			address.ID = addrDoc.Ref.ID
-			addresses = append(addresses, address)
+		addresses, err := h.Addresses.ListAddresses(ctx, customerUID) // ใช้ customerUID
+		if err != nil {
+			log.Printf("Failed to get address for user %s: %v", customerUID, err)
 		}
 
 		// 5. สร้าง object response สำหรับลูกค้ารายนี้
@@ -729,7 +904,7 @@ func (h *AuthHandler) GetAllCustomersHandler(c *gin.Context) {
 			Phone: userProfile.Phone,
 			ImageProfile: userProfile.ImageProfile,
 			Role: userProfile.Role,
-			Addresses: addresses,
+			Addresses: model.PublicAddresses(addresses),
 		}
 		customers = append(customers, customerData)
 	}
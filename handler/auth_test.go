@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"api-flash-dash/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func addressRouter(h *AuthHandler) *gin.Engine {
+	router := gin.New()
+	router.Use(withUID)
+	router.POST("/addresses", h.AddUserAddress)
+	router.PUT("/addresses/:addressId", h.UpdateUserAddress)
+	router.DELETE("/addresses/:addressId", h.DeleteUserAddress)
+	router.POST("/addresses/:addressId/default", h.SetDefaultUserAddress)
+	return router
+}
+
+func addressBody(label string, isDefault bool) gin.H {
+	return gin.H{
+		"detail":      label + " street",
+		"coordinates": gin.H{"latitude": 13.75, "longitude": 100.5},
+		"label":       label,
+		"isDefault":   isDefault,
+	}
+}
+
+// defaults คืน label ของที่อยู่หลักทั้งหมดตามลำดับที่ตอบกลับมา และ label ของที่อยู่แรก
+func defaults(t *testing.T, body map[string]interface{}) ([]string, string) {
+	t.Helper()
+	list, ok := body["addresses"].([]interface{})
+	if !ok || len(list) == 0 {
+		t.Fatalf("response has no addresses: %v", body)
+	}
+	var labels []string
+	for _, item := range list {
+		address := item.(map[string]interface{})
+		if address["isDefault"] == true {
+			labels = append(labels, address["label"].(string))
+		}
+	}
+	return labels, list[0].(map[string]interface{})["label"].(string)
+}
+
+func addressID(t *testing.T, h *AuthHandler, uid, label string) string {
+	t.Helper()
+	addresses, err := h.Addresses.ListAddresses(context.Background(), uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, address := range addresses {
+		if address.Label == label {
+			return address.ID
+		}
+	}
+	t.Fatalf("address %q not found", label)
+	return ""
+}
+
+func TestAddressDefaults(t *testing.T) {
+	const uid = "+66812345678"
+	tests := []struct {
+		name   string
+		steps  func(t *testing.T, h *AuthHandler, router *gin.Engine) map[string]interface{}
+		wantDf string
+	}{
+		{
+			name: "first address becomes default",
+			steps: func(t *testing.T, h *AuthHandler, router *gin.Engine) map[string]interface{} {
+				_, body := do(t, router, http.MethodPost, "/addresses", uid, addressBody("home", false))
+				return body
+			},
+			wantDf: "home",
+		},
+		{
+			name: "second address is not default",
+			steps: func(t *testing.T, h *AuthHandler, router *gin.Engine) map[string]interface{} {
+				do(t, router, http.MethodPost, "/addresses", uid, addressBody("home", false))
+				_, body := do(t, router, http.MethodPost, "/addresses", uid, addressBody("work", false))
+				return body
+			},
+			wantDf: "home",
+		},
+		{
+			name: "new default replaces old default",
+			steps: func(t *testing.T, h *AuthHandler, router *gin.Engine) map[string]interface{} {
+				do(t, router, http.MethodPost, "/addresses", uid, addressBody("home", false))
+				_, body := do(t, router, http.MethodPost, "/addresses", uid, addressBody("work", true))
+				return body
+			},
+			wantDf: "work",
+		},
+		{
+			name: "update cannot unset default",
+			steps: func(t *testing.T, h *AuthHandler, router *gin.Engine) map[string]interface{} {
+				do(t, router, http.MethodPost, "/addresses", uid, addressBody("home", false))
+				do(t, router, http.MethodPost, "/addresses", uid, addressBody("work", false))
+				_, body := do(t, router, http.MethodPut, "/addresses/"+addressID(t, h, uid, "home"), uid, addressBody("home", false))
+				return body
+			},
+			wantDf: "home",
+		},
+		{
+			name: "update can make default",
+			steps: func(t *testing.T, h *AuthHandler, router *gin.Engine) map[string]interface{} {
+				do(t, router, http.MethodPost, "/addresses", uid, addressBody("home", false))
+				do(t, router, http.MethodPost, "/addresses", uid, addressBody("work", false))
+				_, body := do(t, router, http.MethodPut, "/addresses/"+addressID(t, h, uid, "work"), uid, addressBody("work", true))
+				return body
+			},
+			wantDf: "work",
+		},
+		{
+			name: "deleting default promotes another",
+			steps: func(t *testing.T, h *AuthHandler, router *gin.Engine) map[string]interface{} {
+				do(t, router, http.MethodPost, "/addresses", uid, addressBody("home", false))
+				do(t, router, http.MethodPost, "/addresses", uid, addressBody("work", false))
+				_, body := do(t, router, http.MethodDelete, "/addresses/"+addressID(t, h, uid, "home"), uid, nil)
+				return body
+			},
+			wantDf: "work",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandler()
+			body := tt.steps(t, h, addressRouter(h))
+			labels, first := defaults(t, body)
+			if len(labels) != 1 || labels[0] != tt.wantDf {
+				t.Errorf("default addresses = %v, want [%s]", labels, tt.wantDf)
+			}
+			if first != tt.wantDf {
+				t.Errorf("first address = %q, want the default %q", first, tt.wantDf)
+			}
+		})
+	}
+}
+
+func TestLegacyAddressesGetDefault(t *testing.T) {
+	const uid = "+66812345678"
+	h, _ := newTestHandler()
+	ctx := context.Background()
+	// ที่อยู่ที่สร้างก่อนมีที่อยู่หลัก
+	h.Addresses.SetAddress(ctx, uid, "a-legacy", model.AddressPayload{Label: "legacy"})
+	h.Addresses.SetAddress(ctx, uid, "b-legacy", model.AddressPayload{Label: "other"})
+
+	addresses, err := h.getAllUserAddresses(uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !addresses[0].IsDefault || addresses[1].IsDefault {
+		t.Errorf("addresses = %+v, want only the first one as default", addresses)
+	}
+	stored, _ := h.Addresses.GetAddress(ctx, uid, addresses[0].ID)
+	if !stored.IsDefault {
+		t.Errorf("fallback default was not saved")
+	}
+}
+
+func TestAddressValidation(t *testing.T) {
+	const uid = "+66812345678"
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   gin.H
+		want   int
+	}{
+		{name: "missing coordinates without geocoder", method: http.MethodPost, path: "/addresses", body: gin.H{"detail": "home street"}, want: http.StatusBadRequest},
+		{name: "invalid contact phone", method: http.MethodPost, path: "/addresses", body: gin.H{"detail": "x", "coordinates": gin.H{"latitude": 13.75, "longitude": 100.5}, "contactPhone": "12345"}, want: http.StatusBadRequest},
+		{name: "update unknown address", method: http.MethodPut, path: "/addresses/missing", body: addressBody("home", false), want: http.StatusNotFound},
+		{name: "delete unknown address", method: http.MethodDelete, path: "/addresses/missing", want: http.StatusNotFound},
+		{name: "default unknown address", method: http.MethodPost, path: "/addresses/missing/default", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandler()
+			var body interface{}
+			if tt.body != nil {
+				body = tt.body
+			}
+			if code, resp := do(t, addressRouter(h), tt.method, tt.path, uid, body); code != tt.want {
+				t.Errorf("status = %d, want %d (%v)", code, tt.want, resp)
+			}
+		})
+	}
+}
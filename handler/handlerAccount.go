@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"api-flash-dash/identity"
+	"api-flash-dash/lifecycle"
+	"api-flash-dash/model"
+	"api-flash-dash/store"
+
+	"firebase.google.com/go/v4/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// accountDeletedReason คือเหตุผลที่บันทึกลง delivery ที่ถูกยกเลิกเพราะผู้ใช้ลบบัญชี
+const accountDeletedReason = "account deleted"
+
+// deletedAlias สร้างตัวแทนของผู้ใช้ที่ลบบัญชีแล้ว ใช้แทน uid (= เบอร์โทร) ในประวัติการจัดส่ง
+// สุ่มใหม่ทุกครั้ง จึงย้อนกลับไปหาเบอร์โทรเดิมไม่ได้ แต่ยังนับได้ว่ารายการไหนเป็นของคนเดียวกัน
+func deletedAlias() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "deleted-" + hex.EncodeToString(b)
+}
+
+// DeleteAccount ลบบัญชีของผู้ใช้ที่ล็อกอินอยู่ตามสิทธิ์ในการลบข้อมูลของ PDPA
+// ข้อมูลส่วนตัว (โปรไฟล์ ที่อยู่ การแจ้งเตือน ข้อมูลไรเดอร์) จะถูกลบ
+// ส่วนประวัติการจัดส่งและบัญชีรายได้ของไรเดอร์จะถูกเก็บไว้แต่เปลี่ยนตัวตนของผู้ใช้เป็น alias ที่ไม่ระบุตัวตน
+// Endpoint: DELETE /api/user/account
+func (h *AuthHandler) DeleteAccount(c *gin.Context) {
+	ctx := c.Request.Context()
+	uid := c.GetString("uid")
+
+	var payload model.DeleteAccountPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 1. ยืนยันตัวตนด้วยรหัสผ่านอีกครั้ง (Token ที่ถูกขโมยไปอย่างเดียวลบบัญชีไม่ได้)
+	if _, err := h.Identity.SignInWithPassword(ctx, syntheticEmail(uid), payload.Password); err != nil {
+		if errors.Is(err, identity.ErrInvalidCredentials) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+			return
+		}
+		if errors.Is(err, identity.ErrUserDisabled) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+			return
+		}
+		log.Printf("Error re-authenticating %s for account deletion: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify password"})
+		return
+	}
+
+	profile, err := h.Users.GetUser(ctx, uid)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("Error getting user %s for account deletion: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+	isRider := profile != nil && profile.Role == model.RoleRider
+
+	// 2. รวบรวม delivery ทั้งหมดที่ผู้ใช้เกี่ยวข้อง (ผู้ส่ง ผู้รับ ไรเดอร์)
+	deliveries, err := h.accountDeliveries(ctx, uid, isRider)
+	if err != nil {
+		log.Printf("Error listing deliveries of %s for account deletion: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	// 3. ห้ามลบบัญชีระหว่างที่มีงานกำลังวิ่งอยู่ (ไรเดอร์รับงานแล้วหรือรับของไปแล้ว)
+	var active []string
+	for _, delivery := range deliveries {
+		if delivery.Status == lifecycle.StatusAccepted || delivery.Status == lifecycle.StatusPickedUp {
+			active = append(active, delivery.ID)
+		}
+	}
+	if len(active) > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":             "Account cannot be deleted while deliveries are in progress",
+			"activeDeliveryIds": active,
+		})
+		return
+	}
+
+	// 4. ไรเดอร์ต้องไม่มีรายได้ค้างจ่าย (หลังลบบัญชีแล้วจะไม่มีใครรับเงินส่วนนั้นได้)
+	if isRider {
+		balance, err := h.riderBalance(ctx, uid, time.Time{})
+		if err != nil {
+			log.Printf("Error getting balance of rider %s for account deletion: %v", uid, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+			return
+		}
+		if balance != 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Account cannot be deleted until the outstanding balance is settled",
+				"balance": balance,
+			})
+			return
+		}
+	}
+
+	// 5. ยกเลิกงานที่ยังรอไรเดอร์อยู่ แล้วเปลี่ยนตัวตนในทุก delivery เป็น alias
+	alias := deletedAlias()
+	cancelled := 0
+	for _, delivery := range deliveries {
+		if delivery.Status == lifecycle.StatusPending {
+			if err := h.cancelForDeletedAccount(c, &delivery, uid); err != nil {
+				log.Printf("Error cancelling delivery %s for account deletion of %s: %v", delivery.ID, uid, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+				return
+			}
+			cancelled++
+		}
+		if err := h.anonymizeDelivery(c, delivery.ID, uid, alias); err != nil {
+			log.Printf("Error anonymizing delivery %s of %s: %v", delivery.ID, uid, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+			return
+		}
+	}
+	if err := h.Riders.AnonymizeRatingsBy(ctx, uid, alias); err != nil {
+		log.Printf("Error anonymizing ratings by %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	// 6. ลบข้อมูลส่วนตัวใน Firestore และไฟล์ส่งออกข้อมูลที่ยังค้างอยู่
+	// บัญชีรายได้ของไรเดอร์ต้องเก็บไว้เป็นหลักฐานทางบัญชี จึงย้ายไปไว้ใต้ alias แทนการลบ
+	if isRider {
+		if err := h.Ledger.AnonymizeLedger(ctx, uid, alias); err != nil {
+			log.Printf("Error anonymizing ledger of rider %s: %v", uid, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+			return
+		}
+		if err := h.Riders.DeleteRider(ctx, uid); err != nil {
+			log.Printf("Error deleting rider %s: %v", uid, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+			return
+		}
+	}
+	if err := h.Users.DeleteUser(ctx, uid); err != nil {
+		log.Printf("Error deleting user %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+	exports, err := h.Exports.ListExports(ctx, uid)
+	if err != nil {
+		log.Printf("Error listing data exports of %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+	for _, job := range exports {
+		if err := h.deleteDataExport(ctx, job.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+			return
+		}
+	}
+	if err := h.Verifications.DeletePhoneVerifications(ctx, uid); err != nil {
+		log.Printf("Error deleting phone verifications of %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	// 7. ลบผู้ใช้ใน Firebase Authentication เป็นขั้นตอนสุดท้าย
+	// ถ้าขั้นตอนก่อนหน้าล้มเหลว ผู้ใช้ยังล็อกอินและเรียก endpoint นี้ซ้ำได้ (ทุกขั้นตอนเรียกซ้ำได้)
+	if err := h.AuthClient.DeleteUser(ctx, uid); err != nil && !auth.IsUserNotFound(err) {
+		log.Printf("Error deleting auth user %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	log.Printf("Account %s deleted (%d deliveries anonymized as %s, %d cancelled)", uid, len(deliveries), alias, cancelled)
+	c.JSON(http.StatusOK, gin.H{
+		"message":              "Account deleted successfully",
+		"deliveriesAnonymized": len(deliveries),
+		"deliveriesCancelled":  cancelled,
+	})
+}
+
+// accountDeliveries ดึง delivery ทุกรายการที่ผู้ใช้เป็นผู้ส่ง ผู้รับ หรือไรเดอร์ (ไม่ซ้ำกัน)
+func (h *AuthHandler) accountDeliveries(ctx context.Context, uid string, isRider bool) ([]model.Delivery, error) {
+	filters := []store.DeliveryFilter{{SenderUID: uid}, {ReceiverUID: uid}}
+	if isRider {
+		filters = append(filters, store.DeliveryFilter{RiderUID: uid})
+	}
+	seen := make(map[string]bool)
+	var deliveries []model.Delivery
+	for _, filter := range filters {
+		found, err := h.Deliveries.ListDeliveries(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, delivery := range found {
+			if !seen[delivery.ID] {
+				seen[delivery.ID] = true
+				deliveries = append(deliveries, delivery)
+			}
+		}
+	}
+	return deliveries, nil
+}
+
+// cancelForDeletedAccount ยกเลิก delivery ที่ยัง pending ของผู้ใช้ที่กำลังลบบัญชี และแจ้งอีกฝ่าย
+// ผู้ส่งยกเลิกงานของตัวเองได้ตามปกติ ส่วนผู้รับยกเลิกไม่ได้ จึงให้ระบบเป็นผู้ยกเลิกแทน
+func (h *AuthHandler) cancelForDeletedAccount(c *gin.Context, delivery *model.Delivery, uid string) error {
+	ctx := c.Request.Context()
+	event, actor := lifecycle.EventCancel, lifecycle.Actor{UID: uid, Role: lifecycle.RoleSender}
+	if delivery.SenderUID != uid {
+		event, actor = lifecycle.EventForceCancel, lifecycle.Actor{UID: uid, Role: lifecycle.RoleSystem}
+	}
+	cancelled, err := h.applyTransition(ctx, delivery.ID, event, lifecycle.Input{Actor: actor, Reason: accountDeletedReason})
+	if err != nil {
+		return err
+	}
+	*delivery = *cancelled
+
+	notification := model.Notification{
+		Type:       "delivery_cancelled",
+		DeliveryID: delivery.ID,
+		Message:    "การจัดส่งถูกยกเลิก เนื่องจากผู้ใช้อีกฝ่ายลบบัญชี",
+	}
+	if cancelled.SenderUID != uid {
+		h.notify(ctx, cancelled.SenderUID, notification)
+	}
+	if cancelled.ReceiverUID != uid {
+		h.notify(ctx, cancelled.ReceiverUID, notification)
+	}
+	if cancelled.RiderUID != nil {
+		h.notify(ctx, *cancelled.RiderUID, notification)
+	}
+	return nil
+}
+
+// anonymizeDelivery เปลี่ยน uid ของผู้ใช้ใน delivery และประวัติสถานะเป็น alias
+func (h *AuthHandler) anonymizeDelivery(c *gin.Context, deliveryId, uid, alias string) error {
+	ctx := c.Request.Context()
+	err := h.Deliveries.UpdateDelivery(ctx, deliveryId, func(delivery *model.Delivery) (*store.DeliveryWrite, error) {
+		delivery.AnonymizeParty(uid, alias)
+		return nil, nil
+	})
+	if err != nil {
+		return err
+	}
+	return h.Deliveries.AnonymizeStatusHistory(ctx, deliveryId, uid, alias)
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"api-flash-dash/earnings"
+	"api-flash-dash/lifecycle"
+	"api-flash-dash/model"
+	"api-flash-dash/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDeleteAccountKeepsRiderLedger(t *testing.T) {
+	const riderUID = "+66888888888"
+	ctx := context.Background()
+	h, _ := newTestHandler()
+	auth := newFakeAuth(t, h, "secret123")
+	newTestRider(t, h, riderUID)
+	rider := riderUID
+	deliveryID, err := h.Deliveries.CreateDelivery(ctx, model.Delivery{
+		SenderUID:   "+66811111111",
+		ReceiverUID: "+66822222222",
+		Status:      lifecycle.StatusDelivered,
+		RiderUID:    &rider,
+	}, model.StatusChange{To: lifecycle.StatusDelivered, At: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ได้รายได้แล้วถูกจ่ายออกไปหมด ยอดคงเหลือเป็น 0 จึงลบบัญชีได้
+	for _, entry := range []model.LedgerEntry{
+		{ID: earnings.CreditID(deliveryID), Type: earnings.TypeDeliveryCredit, Amount: 40, DeliveryID: deliveryID},
+		{ID: earnings.PayoutID("TRF-001"), Type: earnings.TypePayout, Amount: -40, Reference: "TRF-001"},
+	} {
+		entry.RiderUID = riderUID
+		entry.CreatedAt = time.Now()
+		if _, err := h.Ledger.AddLedgerEntry(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	router := gin.New()
+	router.Use(withUID)
+	router.DELETE("/user/account", h.DeleteAccount)
+
+	if code, body := do(t, router, http.MethodDelete, "/user/account", riderUID, gin.H{"password": "wrong"}); code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: status = %d, want %d (%v)", code, http.StatusUnauthorized, body)
+	}
+	if _, err := h.Riders.GetRider(ctx, riderUID); err != nil {
+		t.Fatalf("rider deleted after wrong password: %v", err)
+	}
+
+	if code, body := do(t, router, http.MethodDelete, "/user/account", riderUID, gin.H{"password": "secret123"}); code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (%v)", code, http.StatusOK, body)
+	}
+	if !auth.called("accounts:delete") {
+		t.Error("auth user was not deleted")
+	}
+	if _, err := h.Riders.GetRider(ctx, riderUID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetRider() error = %v, want %v", err, store.ErrNotFound)
+	}
+	if entries, _ := h.Ledger.ListLedgerEntries(ctx, riderUID, time.Time{}, time.Time{}); len(entries) != 0 {
+		t.Errorf("ledger still under rider uid: %+v", entries)
+	}
+
+	// บัญชีรายได้ถูกเก็บไว้ใต้ alias เดียวกับที่ใช้ใน delivery
+	delivery, err := h.Deliveries.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.RiderUID == nil || *delivery.RiderUID == riderUID {
+		t.Fatalf("delivery rider = %v, want an alias", delivery.RiderUID)
+	}
+	alias := *delivery.RiderUID
+	entries, err := h.Ledger.ListLedgerEntries(ctx, alias, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("ledger under alias has %d entries, want 2", len(entries))
+	}
+	for _, entry := range entries {
+		if entry.RiderUID != alias {
+			t.Errorf("entry %s riderUID = %q, want %q", entry.ID, entry.RiderUID, alias)
+		}
+	}
+}
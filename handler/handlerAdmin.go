@@ -0,0 +1,466 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-flash-dash/lifecycle"
+	"api-flash-dash/middleware"
+	"api-flash-dash/model"
+	"api-flash-dash/phone"
+	"api-flash-dash/store"
+
+	"firebase.google.com/go/v4/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// ค่า limit เริ่มต้นและสูงสุดของรายการ delivery ที่แอดมินดึงได้ในครั้งเดียว
+const (
+	defaultAdminListLimit = 100
+	maxAdminListLimit     = 500
+)
+
+// adminUser คือข้อมูลผู้ใช้ที่ส่งให้แอดมิน (รวม UID ด้วย ซึ่ง UserProfile ปกติซ่อนไว้)
+type adminUser struct {
+	UID string `json:"uid"`
+	model.UserProfile
+}
+
+// AdminActionRequest คือข้อมูลที่แอดมินส่งมากับคำสั่งที่ต้องระบุเหตุผล
+type AdminActionRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// ReassignDeliveryRequest คือข้อมูลสำหรับมอบงานให้ไรเดอร์คนใหม่
+type ReassignDeliveryRequest struct {
+	RiderUID string `json:"riderUID" binding:"required"`
+	Reason   string `json:"reason" binding:"required"`
+}
+
+// AdminOnly คือ Middleware ที่ตรวจสิทธิ์แอดมินจากข้อมูลล่าสุดใน "users" (role เป็น "admin" และบัญชียังไม่ถูกระงับ)
+// ใช้ต่อจาก middleware.RequireRole เพราะ role ใน Token อาจค้างอยู่ได้ถึง 1 ชั่วโมงหลังถอนสิทธิ์หรือระงับบัญชี
+// (ถ้าไม่ได้เปิด AUTH_CHECK_REVOKED) ซึ่งยอมรับได้กับเส้นทางทั่วไป แต่ไม่ใช่กับ /api/admin
+func (h *AuthHandler) AdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := c.GetString("uid")
+		profile, err := h.Users.GetUser(c.Request.Context(), uid)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			log.Printf("Failed to check admin role of %s: %v", uid, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			return
+		}
+		if err != nil || profile.Role != model.RoleAdmin || profile.IsSuspended() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You do not have permission to access this resource"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// --- ผู้ใช้ ---
+
+// ListUsersForAdmin ค้นหาผู้ใช้ทั้งหมด
+// Query: ?role=customer|rider|admin &status=active|suspended &q=คำค้นในชื่อหรือเบอร์โทร
+func (h *AuthHandler) ListUsersForAdmin(c *gin.Context) {
+	users, err := h.Users.ListUsersByRole(context.Background(), c.Query("role"))
+	if err != nil {
+		log.Printf("Failed to list users: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
+		return
+	}
+
+	// Firestore ค้นหาข้อความบางส่วนไม่ได้ จึงกรองที่ฝั่งเซิร์ฟเวอร์
+	q := strings.ToLower(strings.TrimSpace(c.Query("q")))
+	// ถ้าคำค้นเป็นเบอร์เต็ม (เช่น 081-234-5678) ให้เทียบกับเบอร์ E.164 ที่เก็บไว้
+	if normalized, err := phone.Normalize(q); err == nil {
+		q = normalized
+	}
+	status := c.Query("status")
+	result := []adminUser{}
+	for _, user := range users {
+		if q != "" && !strings.Contains(strings.ToLower(user.Name), q) && !strings.Contains(user.Phone, q) {
+			continue
+		}
+		if status == model.AccountSuspended && !user.IsSuspended() ||
+			status == model.AccountActive && user.IsSuspended() {
+			continue
+		}
+		result = append(result, adminUser{UID: user.UID, UserProfile: user})
+	}
+	c.JSON(http.StatusOK, gin.H{"users": result, "count": len(result)})
+}
+
+// GetUserForAdmin ดึงข้อมูลผู้ใช้ 1 คน พร้อมที่อยู่และข้อมูลไรเดอร์ (ถ้ามี)
+func (h *AuthHandler) GetUserForAdmin(c *gin.Context) {
+	ctx := context.Background()
+	uid := c.Param("uid")
+
+	profile, ok := h.adminGetUser(c, uid)
+	if !ok {
+		return
+	}
+	addresses, err := h.Addresses.ListAddresses(ctx, uid)
+	if err != nil {
+		log.Printf("Failed to list addresses for %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve addresses"})
+		return
+	}
+
+	response := gin.H{
+		"user":      adminUser{UID: uid, UserProfile: *profile},
+		"addresses": addresses,
+	}
+	if rider, err := h.Riders.GetRider(ctx, uid); err == nil {
+		response["rider"] = rider
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// SuspendUser ระงับบัญชีผู้ใช้: ปิดบัญชีใน Firebase Auth, ยกเลิก refresh token และบันทึกเหตุผล
+func (h *AuthHandler) SuspendUser(c *gin.Context) {
+	ctx := context.Background()
+	uid := c.Param("uid")
+
+	var req AdminActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if uid == c.GetString("uid") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot suspend your own account"})
+		return
+	}
+	if _, ok := h.adminGetUser(c, uid); !ok {
+		return
+	}
+
+	// 1. ปิดบัญชีใน Firebase Auth เพื่อไม่ให้ล็อกอินหรือขอ token ใหม่ได้
+	if _, err := h.AuthClient.UpdateUser(ctx, uid, (&auth.UserToUpdate{}).Disabled(true)); err != nil {
+		log.Printf("Failed to disable auth user %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable account"})
+		return
+	}
+	if err := h.AuthClient.RevokeRefreshTokens(ctx, uid); err != nil {
+		log.Printf("Failed to revoke tokens for %s: %v", uid, err)
+	}
+
+	// 2. บันทึกสถานะลง "users"
+	status, reason, now := model.AccountSuspended, strings.TrimSpace(req.Reason), time.Now()
+	if err := h.Users.UpdateUser(ctx, uid, store.UserUpdate{Status: &status, SuspendedReason: &reason, SuspendedAt: &now}); err != nil {
+		log.Printf("Failed to mark user %s as suspended: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User suspended successfully", "uid": uid})
+}
+
+// ReactivateUser เปิดใช้งานบัญชีที่ถูกระงับอีกครั้ง
+func (h *AuthHandler) ReactivateUser(c *gin.Context) {
+	ctx := context.Background()
+	uid := c.Param("uid")
+
+	if _, ok := h.adminGetUser(c, uid); !ok {
+		return
+	}
+	if _, err := h.AuthClient.UpdateUser(ctx, uid, (&auth.UserToUpdate{}).Disabled(false)); err != nil {
+		log.Printf("Failed to enable auth user %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable account"})
+		return
+	}
+
+	status, reason := model.AccountActive, ""
+	if err := h.Users.UpdateUser(ctx, uid, store.UserUpdate{Status: &status, SuspendedReason: &reason}); err != nil {
+		log.Printf("Failed to reactivate user %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User reactivated successfully", "uid": uid})
+}
+
+// GrantAdmin ให้สิทธิ์แอดมินกับผู้ใช้ที่มีอยู่แล้ว (แอดมินเท่านั้นที่ทำได้)
+func (h *AuthHandler) GrantAdmin(c *gin.Context) {
+	uid := c.Param("uid")
+	if _, ok := h.adminGetUser(c, uid); !ok {
+		return
+	}
+	if !h.setUserRole(c, uid, model.RoleAdmin) {
+		return
+	}
+	log.Printf("Admin %s granted admin role to %s", c.GetString("uid"), uid)
+	// role ใหม่มีผลเมื่อผู้ใช้ได้ Token ใบใหม่ (ล็อกอินใหม่หรือ refresh)
+	c.JSON(http.StatusOK, gin.H{"message": "Admin role granted, it takes effect on the user's next sign-in", "uid": uid})
+}
+
+// RevokeAdmin ถอนสิทธิ์แอดมิน ผู้ใช้จะกลับไปเป็น "rider" ถ้ามีข้อมูลไรเดอร์ ไม่เช่นนั้นเป็น "customer"
+func (h *AuthHandler) RevokeAdmin(c *gin.Context) {
+	uid := c.Param("uid")
+	if uid == c.GetString("uid") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot revoke your own admin role"})
+		return
+	}
+	profile, ok := h.adminGetUser(c, uid)
+	if !ok {
+		return
+	}
+	if profile.Role != model.RoleAdmin {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is not an admin"})
+		return
+	}
+
+	role := model.RoleCustomer
+	if _, err := h.Riders.GetRider(context.Background(), uid); err == nil {
+		role = model.RoleRider
+	}
+	if !h.setUserRole(c, uid, role) {
+		return
+	}
+	// บังคับให้ล็อกอินใหม่เพื่อรับ Token ที่มี role ใหม่ (Token เดิมที่ยังมี role "admin" ใช้ /api/admin ไม่ได้แล้ว
+	// เพราะ AdminOnly ตรวจ role ล่าสุดใน "users" แต่เส้นทางอื่นยังใช้ได้จนหมดอายุ ถ้าไม่ได้เปิด AUTH_CHECK_REVOKED)
+	if err := h.AuthClient.RevokeRefreshTokens(context.Background(), uid); err != nil {
+		log.Printf("Failed to revoke tokens for %s: %v", uid, err)
+	}
+	log.Printf("Admin %s revoked admin role from %s", c.GetString("uid"), uid)
+	c.JSON(http.StatusOK, gin.H{"message": "Admin role revoked", "uid": uid, "role": role})
+}
+
+// adminGetUser ดึงข้อมูลผู้ใช้ ถ้าไม่พบหรือผิดพลาดจะตอบกลับ error ให้เองและคืนค่า false
+func (h *AuthHandler) adminGetUser(c *gin.Context, uid string) (*model.UserProfile, bool) {
+	profile, err := h.Users.GetUser(context.Background(), uid)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Failed to get user %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return nil, false
+	}
+	return profile, true
+}
+
+// setUserRole เปลี่ยน role ของผู้ใช้ทั้งใน custom claims และใน "users"
+// ถ้าผิดพลาดจะตอบกลับ error ให้เองและคืนค่า false
+func (h *AuthHandler) setUserRole(c *gin.Context, uid, role string) bool {
+	if err := h.AuthClient.SetCustomUserClaims(context.Background(), uid, middleware.RoleClaims(role)); err != nil {
+		log.Printf("Failed to set role claim of %s to %s: %v", uid, role, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user role"})
+		return false
+	}
+	if err := h.Users.UpdateUser(context.Background(), uid, store.UserUpdate{Role: &role}); err != nil {
+		log.Printf("Failed to set role of %s to %s: %v", uid, role, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user role"})
+		return false
+	}
+	return true
+}
+
+// --- การจัดส่ง ---
+
+// ListDeliveriesForAdmin ค้นหา delivery ทั้งหมด
+// Query: ?status=pending,accepted &senderUID= &receiverUID= &riderUID= &limit=100
+func (h *AuthHandler) ListDeliveriesForAdmin(c *gin.Context) {
+	limit := defaultAdminListLimit
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 || parsed > maxAdminListLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a number between 1 and 500"})
+			return
+		}
+		limit = parsed
+	}
+	filter := store.DeliveryFilter{
+		SenderUID:   c.Query("senderUID"),
+		ReceiverUID: c.Query("receiverUID"),
+		RiderUID:    c.Query("riderUID"),
+		Limit:       limit,
+	}
+	if raw := c.Query("status"); raw != "" {
+		filter.Statuses = strings.Split(raw, ",")
+	}
+
+	deliveries, err := h.queryDeliveries(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve deliveries"})
+		return
+	}
+	if deliveries == nil {
+		deliveries = []model.Delivery{}
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries, "count": len(deliveries)})
+}
+
+// GetDeliveryForAdmin ดึง delivery 1 รายการพร้อมประวัติการเปลี่ยนสถานะ
+func (h *AuthHandler) GetDeliveryForAdmin(c *gin.Context) {
+	ctx := context.Background()
+	deliveryId := c.Param("deliveryId")
+
+	delivery, err := h.Deliveries.GetDelivery(ctx, deliveryId)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get delivery %s: %v", deliveryId, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get delivery"})
+		return
+	}
+	h.enrichDelivery(ctx, delivery)
+
+	history, err := h.Deliveries.ListStatusHistory(ctx, deliveryId)
+	if err != nil {
+		log.Printf("Failed to get history of delivery %s: %v", deliveryId, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get delivery timeline"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"delivery": delivery, "timeline": history})
+}
+
+// ForceCancelDelivery ให้แอดมินยกเลิก delivery ที่ยังไม่จบ (รวมถึงที่รับของไปแล้ว) โดยต้องระบุเหตุผล
+func (h *AuthHandler) ForceCancelDelivery(c *gin.Context) {
+	ctx := context.Background()
+	deliveryId := c.Param("deliveryId")
+	adminUID := c.GetString("uid")
+
+	var req AdminActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	cancelled, err := h.applyTransition(ctx, deliveryId, lifecycle.EventForceCancel, lifecycle.Input{
+		Actor:  lifecycle.Actor{UID: adminUID, Role: lifecycle.RoleAdmin},
+		Reason: req.Reason,
+	})
+	if err != nil {
+		log.Printf("Admin %s failed to cancel delivery %s: %v", adminUID, deliveryId, err)
+		respondTransitionError(c, err, "Failed to cancel delivery")
+		return
+	}
+
+	// แจ้งทุกฝ่ายที่เกี่ยวข้อง
+	notification := model.Notification{
+		Type:       "delivery_cancelled_by_admin",
+		DeliveryID: deliveryId,
+		Message:    "การจัดส่งถูกยกเลิกโดยผู้ดูแลระบบ: " + req.Reason,
+	}
+	h.notify(ctx, cancelled.SenderUID, notification)
+	h.notify(ctx, cancelled.ReceiverUID, notification)
+	if cancelled.RiderUID != nil {
+		h.notify(ctx, *cancelled.RiderUID, notification)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Delivery cancelled successfully",
+		"deliveryId": deliveryId,
+		"newStatus":  lifecycle.StatusCancelled,
+	})
+}
+
+// ReassignDelivery ให้แอดมินมอบงานให้ไรเดอร์คนใหม่ (ไรเดอร์คนใหม่ต้องไม่มีงานค้างอยู่)
+func (h *AuthHandler) ReassignDelivery(c *gin.Context) {
+	ctx := context.Background()
+	deliveryId := c.Param("deliveryId")
+	adminUID := c.GetString("uid")
+
+	// 1. รับข้อมูล
+	var req ReassignDeliveryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	// 2. ไรเดอร์คนใหม่ต้องมีอยู่จริง ไม่ถูกระงับ และไม่มีงานที่ทำค้างอยู่
+	profile, err := h.Users.GetUser(ctx, req.RiderUID)
+	if err != nil || profile.Role != model.RoleRider || profile.IsSuspended() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "riderUID is not an active rider"})
+		return
+	}
+	if rider, err := h.Riders.GetRider(ctx, req.RiderUID); err != nil || !rider.IsVerified() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "riderUID is not a verified rider"})
+		return
+	}
+	active, err := h.Deliveries.ListDeliveries(ctx, store.DeliveryFilter{
+		RiderUID: req.RiderUID,
+		Statuses: []string{lifecycle.StatusAccepted, lifecycle.StatusPickedUp},
+		Limit:    1,
+	})
+	if err != nil {
+		log.Printf("Failed to check active deliveries of rider %s: %v", req.RiderUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check rider availability"})
+		return
+	}
+	if len(active) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Rider already has an active delivery", "activeDeliveryId": active[0].ID})
+		return
+	}
+
+	// 3. เปลี่ยนไรเดอร์ภายใน Transaction (จำไรเดอร์คนเดิมไว้เพื่อแจ้งเตือน)
+	previous, err := h.Deliveries.GetDelivery(ctx, deliveryId)
+	if err != nil {
+		respondTransitionError(c, err, "Failed to get delivery")
+		return
+	}
+	reassigned, err := h.applyTransition(ctx, deliveryId, lifecycle.EventReassign, lifecycle.Input{
+		Actor:          lifecycle.Actor{UID: adminUID, Role: lifecycle.RoleAdmin},
+		Reason:         req.Reason,
+		AssignRiderUID: req.RiderUID,
+	})
+	if err != nil {
+		log.Printf("Admin %s failed to reassign delivery %s: %v", adminUID, deliveryId, err)
+		respondTransitionError(c, err, "Failed to reassign delivery")
+		return
+	}
+
+	// 4. แจ้งไรเดอร์ทั้งคนเดิมและคนใหม่
+	if previous.RiderUID != nil && *previous.RiderUID != req.RiderUID {
+		h.notify(ctx, *previous.RiderUID, model.Notification{
+			Type:       "delivery_reassigned",
+			DeliveryID: deliveryId,
+			Message:    "งานนี้ถูกย้ายไปให้ไรเดอร์คนอื่นโดยผู้ดูแลระบบ: " + req.Reason,
+		})
+	}
+	h.notify(ctx, req.RiderUID, model.Notification{
+		Type:       "delivery_assigned",
+		DeliveryID: deliveryId,
+		Message:    "คุณได้รับมอบหมายงานใหม่จากผู้ดูแลระบบ",
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Delivery reassigned successfully",
+		"deliveryId": deliveryId,
+		"riderUID":   *reassigned.RiderUID,
+		"newStatus":  reassigned.Status,
+	})
+}
+
+// --- ไรเดอร์ ---
+
+// GetRiderDocumentsForAdmin ดึงข้อมูลและเอกสารของไรเดอร์ (รูปรถ ทะเบียนรถ ฯลฯ)
+func (h *AuthHandler) GetRiderDocumentsForAdmin(c *gin.Context) {
+	riderUID := c.Param("riderId")
+	profile, ok := h.adminGetUser(c, riderUID)
+	if !ok {
+		return
+	}
+	rider, err := h.Riders.GetRider(context.Background(), riderUID)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rider not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get rider %s: %v", riderUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get rider data"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"user":  adminUser{UID: riderUID, UserProfile: *profile},
+		"rider": rider,
+	})
+}
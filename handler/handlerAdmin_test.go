@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"api-flash-dash/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminOnly(t *testing.T) {
+	tests := []struct {
+		name string
+		user *model.UserProfile // nil = ไม่มีเอกสาร "users"
+		want int
+	}{
+		{name: "active admin", user: &model.UserProfile{Role: model.RoleAdmin}, want: http.StatusOK},
+		{name: "suspended admin", user: &model.UserProfile{Role: model.RoleAdmin, Status: model.AccountSuspended}, want: http.StatusForbidden},
+		// Token ยังมี role "admin" แต่ถูกถอนสิทธิ์ไปแล้ว
+		{name: "revoked admin", user: &model.UserProfile{Role: model.RoleCustomer}, want: http.StatusForbidden},
+		{name: "deleted user", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const uid = "+66811111111"
+			h, _ := newTestHandler()
+			if tt.user != nil {
+				if err := h.Users.CreateUser(context.Background(), uid, *tt.user); err != nil {
+					t.Fatal(err)
+				}
+			}
+			router := gin.New()
+			router.Use(withUID)
+			router.GET("/admin", h.AdminOnly(), func(c *gin.Context) {
+				c.JSON(http.StatusOK, gin.H{"ok": true})
+			})
+			if code, body := do(t, router, http.MethodGet, "/admin", uid, nil); code != tt.want {
+				t.Errorf("status = %d, want %d (%v)", code, tt.want, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"api-flash-dash/events"
+	"api-flash-dash/lifecycle"
+	"api-flash-dash/model"
+	"api-flash-dash/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondTransitionError แปลง error ที่ได้จากการเปลี่ยนสถานะ delivery ให้เป็น HTTP Status ที่เหมาะสม
+func respondTransitionError(c *gin.Context, err error, fallbackMessage string) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+	case errors.Is(err, lifecycle.ErrInvalidTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()}) // 409 Conflict: สถานะปัจจุบันไม่อนุญาต
+	case errors.Is(err, lifecycle.ErrActorNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, lifecycle.ErrReasonRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, lifecycle.ErrInvalidPIN):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, lifecycle.ErrPINLocked):
+		c.JSON(http.StatusLocked, gin.H{"error": err.Error()})
+	case errors.Is(err, lifecycle.ErrOutOfRange):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, lifecycle.ErrLocationUnknown):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallbackMessage})
+	}
+}
+
+// applyTransition เปลี่ยนสถานะ delivery ผ่าน state machine ภายใน Transaction
+// แล้วกระจาย Event ไปยังผู้ที่ติดตาม delivery นี้อยู่ คืนค่า delivery หลังเปลี่ยนสถานะแล้ว
+// ถ้าส่งของสำเร็จ รายได้ของไรเดอร์จะถูกบันทึกใน Transaction เดียวกัน (ดู earnings.Config.DeliveryCredit)
+// ถ้าไรเดอร์คืนงาน จำนวนครั้งที่คืนงานก็จะถูกนับใน Transaction เดียวกัน
+// ถ้า PIN ผิด จะคืนค่า delivery (ที่นับจำนวนครั้งผิดแล้ว) พร้อม lifecycle.ErrInvalidPIN
+func (h *AuthHandler) applyTransition(ctx context.Context, deliveryId string, event lifecycle.Event, in lifecycle.Input) (*model.Delivery, error) {
+	var updated model.Delivery
+	var pinErr error
+	err := h.Deliveries.UpdateDelivery(ctx, deliveryId, func(delivery *model.Delivery) (*store.DeliveryWrite, error) {
+		pinErr = nil // Transaction อาจถูกเรียกซ้ำ
+		change, err := lifecycle.Apply(delivery, event, in)
+		if errors.Is(err, lifecycle.ErrInvalidPIN) {
+			// ต้องบันทึกจำนวนครั้งที่ผิดลงเอกสาร จึงไม่คืนค่า error ให้ Transaction (ไม่เช่นนั้นจะไม่ถูกบันทึก)
+			lifecycle.RecordPINFailure(delivery)
+			updated = *delivery
+			pinErr = err
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		updated = *delivery
+		write := &store.DeliveryWrite{Change: change}
+		if delivery.Status == lifecycle.StatusDelivered {
+			delivery.ID = deliveryId
+			if credit, ok := h.Earnings.DeliveryCredit(delivery, change.At); ok {
+				write.Credit = &credit
+			}
+		}
+		if event == lifecycle.EventRelease {
+			write.Release = &store.RiderRelease{RiderUID: in.Actor.UID, FlagAt: releaseFlagThreshold}
+		}
+		return write, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	updated.ID = deliveryId
+	if pinErr != nil {
+		return &updated, pinErr
+	}
+
+	statusEvent := events.Event{
+		Type:       events.TypeStatus,
+		DeliveryID: deliveryId,
+		Status:     updated.Status,
+	}
+	if updated.RiderUID != nil {
+		statusEvent.RiderUID = *updated.RiderUID
+	}
+	h.Events.Publish(events.DeliveryTopic(deliveryId), statusEvent)
+	return &updated, nil
+}
+
+// deliveryParty บอกว่าผู้ใช้ uid เกี่ยวข้องกับ delivery นี้ในบทบาทไหน (คืนค่าว่างถ้าไม่เกี่ยวข้อง)
+func deliveryParty(delivery *model.Delivery, uid string) lifecycle.Role {
+	switch {
+	case delivery.SenderUID == uid:
+		return lifecycle.RoleSender
+	case delivery.ReceiverUID == uid:
+		return lifecycle.RoleReceiver
+	case delivery.RiderUID != nil && *delivery.RiderUID == uid:
+		return lifecycle.RoleRider
+	}
+	return ""
+}
+
+// GetDeliveryTimeline ดึงประวัติการเปลี่ยนสถานะทั้งหมดของ delivery
+// เฉพาะผู้ส่ง ผู้รับ และไรเดอร์ที่รับงานเท่านั้นที่ดูได้
+func (h *AuthHandler) GetDeliveryTimeline(c *gin.Context) {
+	ctx := context.Background()
+
+	// 1. ดึง deliveryId จาก URL และ UID จาก Token
+	deliveryId := c.Param("deliveryId")
+	if deliveryId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Delivery ID is required"})
+		return
+	}
+	uid, exists := c.Get("uid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: UID not found"})
+		return
+	}
+	uidStr := uid.(string)
+
+	// 2. ดึง delivery และตรวจสอบสิทธิ์
+	delivery, err := h.Deliveries.GetDelivery(ctx, deliveryId)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get delivery %s: %v", deliveryId, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get delivery"})
+		return
+	}
+	if deliveryParty(delivery, uidStr) == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to view this delivery"})
+		return
+	}
+
+	// 3. ดึงประวัติจาก sub-collection "statusHistory"
+	timeline, err := h.Deliveries.ListStatusHistory(ctx, deliveryId)
+	if err != nil {
+		log.Printf("Failed to get status history for delivery %s: %v", deliveryId, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get delivery timeline"})
+		return
+	}
+
+	// 4. ส่งข้อมูลกลับไป
+	c.JSON(http.StatusOK, gin.H{
+		"deliveryId": deliveryId,
+		"status":     delivery.Status,
+		"timeline":   timeline,
+	})
+}
+
+// CancelDeliveryRequest คือข้อมูลที่ผู้ส่งส่งมาตอนยกเลิกการจัดส่ง
+type CancelDeliveryRequest struct {
+	Reason string `json:"reason"` // บังคับเมื่อไรเดอร์รับงานไปแล้ว
+}
+
+// CancelDelivery ให้ผู้ส่งยกเลิกการจัดส่งของตัวเอง
+// - "pending": ยกเลิกได้เลย
+// - "accepted": ต้องระบุเหตุผล และไรเดอร์ที่รับงานจะได้รับแจ้งเตือน
+// - ตั้งแต่ "picked_up" เป็นต้นไป: ยกเลิกไม่ได้
+func (h *AuthHandler) CancelDelivery(c *gin.Context) {
+	ctx := context.Background()
+
+	// 1. ดึง deliveryId จาก URL และ UID ของผู้ส่งจาก Token
+	deliveryId := c.Param("deliveryId")
+	if deliveryId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Delivery ID is required"})
+		return
+	}
+	uid, exists := c.Get("uid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: UID not found"})
+		return
+	}
+	senderUID := uid.(string)
+
+	// 2. รับเหตุผล (body ว่างได้ถ้ายังไม่มีไรเดอร์รับงาน)
+	var req CancelDeliveryRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+	}
+
+	// 3. ตรวจสอบและยกเลิกภายใน Transaction (เหมือน AcceptDelivery)
+	// เพื่อไม่ให้ไรเดอร์รับงานในจังหวะเดียวกับที่ผู้ส่งกดยกเลิก
+	cancelled, err := h.applyTransition(ctx, deliveryId, lifecycle.EventCancel, lifecycle.Input{
+		Actor:  lifecycle.Actor{UID: senderUID, Role: lifecycle.RoleSender},
+		Reason: req.Reason,
+	})
+	if err != nil {
+		log.Printf("Sender %s failed to cancel delivery %s: %v", senderUID, deliveryId, err)
+		respondTransitionError(c, err, "Failed to cancel delivery")
+		return
+	}
+
+	// 4. แจ้งเตือนไรเดอร์ที่รับงานไว้ (ถ้ามี)
+	if cancelled.RiderUID != nil {
+		h.notify(ctx, *cancelled.RiderUID, model.Notification{
+			Type:       "delivery_cancelled",
+			DeliveryID: deliveryId,
+			Message:    "ผู้ส่งได้ยกเลิกงานที่คุณรับไว้: " + req.Reason,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Delivery cancelled successfully",
+		"deliveryId": deliveryId,
+		"newStatus":  lifecycle.StatusCancelled,
+	})
+}
+
+// ResetDeliveryPIN ให้ผู้รับขอ PIN ยืนยันการรับของใหม่ (เช่น หลังจาก PIN ถูกล็อก)
+// PIN เดิมจะใช้ไม่ได้อีก และจำนวนครั้งที่ใส่ผิดจะถูกนับใหม่
+func (h *AuthHandler) ResetDeliveryPIN(c *gin.Context) {
+	ctx := context.Background()
+
+	// 1. ดึง deliveryId จาก URL และ UID ของผู้รับจาก Token
+	deliveryId := c.Param("deliveryId")
+	if deliveryId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Delivery ID is required"})
+		return
+	}
+	uid, exists := c.Get("uid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: UID not found"})
+		return
+	}
+	receiverUID := uid.(string)
+
+	// 2. ออก PIN ใหม่ภายใน Transaction (ไม่ใช่การเปลี่ยนสถานะ จึงไม่บันทึก statusHistory)
+	var newPIN string
+	err := h.Deliveries.UpdateDelivery(ctx, deliveryId, func(delivery *model.Delivery) (*store.DeliveryWrite, error) {
+		if delivery.ReceiverUID != receiverUID {
+			return nil, fmt.Errorf("%w: only the receiver can reset the delivery PIN", lifecycle.ErrActorNotAllowed)
+		}
+		if lifecycle.IsFinal(delivery.Status) {
+			return nil, fmt.Errorf("%w: delivery is already '%s'", lifecycle.ErrInvalidTransition, delivery.Status)
+		}
+		lifecycle.ResetPIN(delivery)
+		newPIN = delivery.DeliveryPIN
+		return nil, nil
+	})
+	if err != nil {
+		log.Printf("Receiver %s failed to reset PIN for delivery %s: %v", receiverUID, deliveryId, err)
+		respondTransitionError(c, err, "Failed to reset delivery PIN")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Delivery PIN reset successfully",
+		"deliveryId":  deliveryId,
+		"deliveryPin": newPIN,
+	})
+}
+
+// GetDeliveryTracking ดึงตำแหน่งล่าสุดของไรเดอร์ที่กำลังส่งของให้
+// เฉพาะผู้ส่งและผู้รับเท่านั้น และดูได้เฉพาะตอนที่สถานะเป็น "accepted" หรือ "picked_up"
+func (h *AuthHandler) GetDeliveryTracking(c *gin.Context) {
+	ctx := context.Background()
+
+	// 1. ดึง deliveryId จาก URL และ UID จาก Token
+	deliveryId := c.Param("deliveryId")
+	if deliveryId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Delivery ID is required"})
+		return
+	}
+	uid, exists := c.Get("uid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: UID not found"})
+		return
+	}
+
+	// 2. ดึง delivery และตรวจสอบสิทธิ์ (ผู้ส่งหรือผู้รับเท่านั้น)
+	delivery, err := h.Deliveries.GetDelivery(ctx, deliveryId)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get delivery %s: %v", deliveryId, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get delivery"})
+		return
+	}
+	party := deliveryParty(delivery, uid.(string))
+	if party != lifecycle.RoleSender && party != lifecycle.RoleReceiver {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to track this delivery"})
+		return
+	}
+
+	// 3. ติดตามได้เฉพาะตอนที่มีไรเดอร์กำลังทำงานอยู่
+	if delivery.Status != lifecycle.StatusAccepted && delivery.Status != lifecycle.StatusPickedUp {
+		c.JSON(http.StatusConflict, gin.H{"error": "Delivery is not in progress, tracking is unavailable"})
+		return
+	}
+	if delivery.RiderUID == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Delivery has no assigned rider"})
+		return
+	}
+	riderUID := *delivery.RiderUID
+
+	// 4. ดึงข้อมูลไรเดอร์และตำแหน่งล่าสุด
+	riderProfile, err := h.Users.GetUser(ctx, riderUID)
+	if err != nil {
+		log.Printf("Failed to get rider profile %s: %v", riderUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get rider data"})
+		return
+	}
+	rider, err := h.Riders.GetRider(ctx, riderUID)
+	if err != nil {
+		log.Printf("Failed to get rider %s: %v", riderUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get rider data"})
+		return
+	}
+
+	// 5. ส่งข้อมูลกลับไป (currentLocation อาจเป็น null ถ้าไรเดอร์ยังไม่เคยส่งพิกัด)
+	c.JSON(http.StatusOK, gin.H{
+		"deliveryId": deliveryId,
+		"status":     delivery.Status,
+		"rider": gin.H{
+			"uid":                  riderUID,
+			"name":                 riderProfile.Name,
+			"image_profile":        riderProfile.ImageProfile,
+			"image_vehicle":        rider.ImageVehicle,
+			"vehicle_registration": rider.VehicleRegistration,
+			"rating":               riderRatingSummary(rider),
+		},
+		"currentLocation": rider.CurrentLocation,
+		"updatedAt":       rider.UpdatedAt,
+	})
+}
@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"api-flash-dash/earnings"
+	"api-flash-dash/model"
+	"api-flash-dash/pricing"
+	"api-flash-dash/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// riderBalance คำนวณยอดคงเหลือจากรายการทั้งหมดในบัญชีก่อนเวลา before (zero = ทั้งหมด)
+func (h *AuthHandler) riderBalance(ctx context.Context, riderUID string, before time.Time) (int, error) {
+	entries, err := h.Ledger.ListLedgerEntries(ctx, riderUID, time.Time{}, before)
+	if err != nil {
+		return 0, err
+	}
+	return earnings.Summarize(entries).Net, nil
+}
+
+// GetRiderBalance ดึงยอดรายได้คงเหลือ (ที่ยังไม่ได้จ่าย) ของไรเดอร์
+func (h *AuthHandler) GetRiderBalance(c *gin.Context) {
+	uid, exists := c.Get("uid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: UID not found"})
+		return
+	}
+	riderUID := uid.(string)
+
+	balance, err := h.riderBalance(context.Background(), riderUID, time.Time{})
+	if err != nil {
+		log.Printf("Failed to get balance for rider %s: %v", riderUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get balance"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"balance": balance, "currency": pricing.Currency})
+}
+
+// GetRiderStatement ดึงใบแจ้งยอดรายวันหรือรายสัปดาห์ของไรเดอร์ที่ล็อกอินอยู่
+// Query: ?period=daily|weekly (ค่าเริ่มต้น daily) &date=2006-01-02 (ค่าเริ่มต้นวันนี้)
+func (h *AuthHandler) GetRiderStatement(c *gin.Context) {
+	uid, exists := c.Get("uid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: UID not found"})
+		return
+	}
+	h.respondStatement(c, uid.(string))
+}
+
+// GetRiderStatementForAdmin ให้แอดมินดูใบแจ้งยอดของไรเดอร์คนใดก็ได้ (Query เหมือน GetRiderStatement)
+func (h *AuthHandler) GetRiderStatementForAdmin(c *gin.Context) {
+	h.respondStatement(c, c.Param("riderId"))
+}
+
+// respondStatement สร้างใบแจ้งยอดของ riderUID ตาม period และ date ใน Query
+func (h *AuthHandler) respondStatement(c *gin.Context, riderUID string) {
+	ctx := context.Background()
+
+	// 1. หาช่วงเวลาของใบแจ้งยอด
+	day := time.Now()
+	if raw := c.Query("date"); raw != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", raw, earnings.Location)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date must be in YYYY-MM-DD format"})
+			return
+		}
+		day = parsed
+	}
+	period := c.DefaultQuery("period", earnings.PeriodDaily)
+	start, end, err := earnings.PeriodBounds(period, day)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 2. ยอดยกมา และรายการในช่วงเวลานั้น
+	opening, err := h.riderBalance(ctx, riderUID, start)
+	if err != nil {
+		log.Printf("Failed to get opening balance for rider %s: %v", riderUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get statement"})
+		return
+	}
+	entries, err := h.Ledger.ListLedgerEntries(ctx, riderUID, start, end)
+	if err != nil {
+		log.Printf("Failed to list ledger for rider %s: %v", riderUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get statement"})
+		return
+	}
+	if entries == nil {
+		entries = []model.LedgerEntry{}
+	}
+	summary := earnings.Summarize(entries)
+
+	c.JSON(http.StatusOK, gin.H{
+		"riderUID":       riderUID,
+		"period":         period,
+		"from":           start,
+		"to":             end,
+		"openingBalance": opening,
+		"closingBalance": opening + summary.Net,
+		"summary":        summary,
+		"entries":        entries,
+		"currency":       pricing.Currency,
+	})
+}
+
+// RecordRiderPayout ให้แอดมินบันทึกการจ่ายเงินให้ไรเดอร์ (หักออกจากยอดคงเหลือ)
+func (h *AuthHandler) RecordRiderPayout(c *gin.Context) {
+	ctx := context.Background()
+
+	// 1. รับข้อมูล (สิทธิ์แอดมินถูกตรวจสอบโดย middleware.RequireRole และ AdminOnly แล้ว)
+	adminUID := c.GetString("uid")
+	riderUID := c.Param("riderId")
+	var payload model.PayoutPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	reference := strings.TrimSpace(payload.Reference)
+	if reference == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reference is required"})
+		return
+	}
+	if !h.requireLedgerRider(c, riderUID) {
+		return
+	}
+
+	// 2. บันทึกรายการจ่ายเงิน (ค่าลบ) ถ้ายอดคงเหลือพอ (ตรวจและบันทึกใน Transaction เดียวกัน)
+	// ID มาจากเลขอ้างอิง คำขอที่ส่งซ้ำ (เช่น retry) จึงไม่หักเงินซ้ำ
+	entry := model.LedgerEntry{
+		ID:        earnings.PayoutID(reference),
+		RiderUID:  riderUID,
+		Type:      earnings.TypePayout,
+		Amount:    -payload.Amount,
+		Reference: reference,
+		Note:      strings.TrimSpace(payload.Note),
+		CreatedBy: adminUID,
+		CreatedAt: time.Now(),
+	}
+	balance, err := h.Ledger.AddPayout(ctx, entry)
+	switch {
+	case errors.Is(err, store.ErrInsufficientBalance):
+		c.JSON(http.StatusConflict, gin.H{"error": "Payout exceeds the rider's balance", "balance": balance})
+		return
+	case errors.Is(err, store.ErrAlreadyExists):
+		c.JSON(http.StatusOK, gin.H{
+			"message":  "Payout with this reference has already been recorded",
+			"balance":  balance,
+			"currency": pricing.Currency,
+		})
+		return
+	case err != nil:
+		log.Printf("Failed to record payout for rider %s: %v", riderUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record ledger entry"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"entry":    entry,
+		"balance":  balance + entry.Amount,
+		"currency": pricing.Currency,
+	})
+}
+
+// RecordRiderAdjustment ให้แอดมินบันทึกค่าปรับ (หักเงิน) หรือรายการปรับปรุงยอด (บวกหรือลบ)
+func (h *AuthHandler) RecordRiderAdjustment(c *gin.Context) {
+	ctx := context.Background()
+
+	// 1. รับข้อมูล (สิทธิ์แอดมินถูกตรวจสอบโดย middleware.RequireRole และ AdminOnly แล้ว)
+	adminUID := c.GetString("uid")
+	riderUID := c.Param("riderId")
+	var payload model.LedgerAdjustmentPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	// 2. ค่าปรับส่งมาเป็นค่าบวกเสมอ แล้วบันทึกเป็นค่าลบ
+	amount := payload.Amount
+	if payload.Type == earnings.TypePenalty {
+		if amount < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Penalty amount must be positive"})
+			return
+		}
+		amount = -amount
+	}
+
+	balance, err := h.riderBalance(ctx, riderUID, time.Time{})
+	if err != nil {
+		log.Printf("Failed to get balance for rider %s: %v", riderUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get balance"})
+		return
+	}
+
+	entry := model.LedgerEntry{
+		RiderUID:   riderUID,
+		Type:       payload.Type,
+		Amount:     amount,
+		DeliveryID: payload.DeliveryID,
+		Note:       strings.TrimSpace(payload.Note),
+		CreatedBy:  adminUID,
+		CreatedAt:  time.Now(),
+	}
+	h.respondLedgerEntry(c, entry, balance)
+}
+
+// requireLedgerRider ตรวจว่ามีไรเดอร์คนนี้อยู่จริงก่อนบันทึกรายการลงบัญชี
+// ถ้าไม่มีหรือผิดพลาดจะตอบ error กลับไปให้แล้ว และคืนค่า false
+func (h *AuthHandler) requireLedgerRider(c *gin.Context, riderUID string) bool {
+	_, err := h.Riders.GetRider(context.Background(), riderUID)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rider not found"})
+		return false
+	}
+	if err != nil {
+		log.Printf("Failed to get rider %s: %v", riderUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get rider data"})
+		return false
+	}
+	return true
+}
+
+// respondLedgerEntry บันทึกรายการลงบัญชี แล้วตอบกลับพร้อมยอดคงเหลือใหม่
+func (h *AuthHandler) respondLedgerEntry(c *gin.Context, entry model.LedgerEntry, balance int) {
+	if !h.requireLedgerRider(c, entry.RiderUID) {
+		return
+	}
+
+	id, err := h.Ledger.AddLedgerEntry(context.Background(), entry)
+	if err != nil {
+		log.Printf("Failed to add ledger entry for rider %s: %v", entry.RiderUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record ledger entry"})
+		return
+	}
+	entry.ID = id
+
+	c.JSON(http.StatusCreated, gin.H{
+		"entry":    entry,
+		"balance":  balance + entry.Amount,
+		"currency": pricing.Currency,
+	})
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"api-flash-dash/earnings"
+	"api-flash-dash/events"
+	"api-flash-dash/lifecycle"
+	"api-flash-dash/model"
+	"api-flash-dash/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// creditRider บันทึกรายได้ตั้งต้นให้ไรเดอร์
+func creditRider(t *testing.T, h *AuthHandler, uid string, amount int) {
+	t.Helper()
+	entry := model.LedgerEntry{RiderUID: uid, Type: earnings.TypeAdjustment, Amount: amount, CreatedAt: time.Now()}
+	if _, err := h.Ledger.AddLedgerEntry(context.Background(), entry); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecordRiderPayout(t *testing.T) {
+	const riderUID = "+66888888888"
+	h, _ := newTestHandler()
+	newTestRider(t, h, riderUID)
+	creditRider(t, h, riderUID, 100)
+	router := gin.New()
+	router.Use(withUID)
+	router.POST("/admin/riders/:riderId/payouts", h.RecordRiderPayout)
+	path := "/admin/riders/" + riderUID + "/payouts"
+
+	steps := []struct {
+		name        string
+		body        gin.H
+		wantCode    int
+		wantBalance float64
+	}{
+		{name: "payout", body: gin.H{"amount": 60, "reference": "TRF-001"}, wantCode: http.StatusCreated, wantBalance: 40},
+		// ส่งซ้ำด้วยเลขอ้างอิงเดิม (เช่น retry) ต้องไม่หักเงินซ้ำ
+		{name: "retried payout", body: gin.H{"amount": 60, "reference": "TRF-001"}, wantCode: http.StatusOK, wantBalance: 40},
+		{name: "payout over balance", body: gin.H{"amount": 50, "reference": "TRF-002"}, wantCode: http.StatusConflict, wantBalance: 40},
+		{name: "payout of whole balance", body: gin.H{"amount": 40, "reference": "TRF-002"}, wantCode: http.StatusCreated, wantBalance: 0},
+	}
+	for _, step := range steps {
+		code, body := do(t, router, http.MethodPost, path, "admin", step.body)
+		if code != step.wantCode {
+			t.Fatalf("%s: status = %d, want %d (%v)", step.name, code, step.wantCode, body)
+		}
+		if body["balance"] != step.wantBalance {
+			t.Errorf("%s: balance = %v, want %v", step.name, body["balance"], step.wantBalance)
+		}
+	}
+
+	if code, body := do(t, router, http.MethodPost, "/admin/riders/+66800000000/payouts", "admin", gin.H{"amount": 1, "reference": "TRF-003"}); code != http.StatusNotFound {
+		t.Errorf("unknown rider: status = %d, want %d (%v)", code, http.StatusNotFound, body)
+	}
+}
+
+func TestAddPayoutConcurrent(t *testing.T) {
+	const riderUID = "+66888888888"
+	h, _ := newTestHandler()
+	creditRider(t, h, riderUID, 100)
+
+	// ยอดคงเหลือพอจ่ายได้แค่ 3 ครั้ง ไม่ว่าคำขอจะมาพร้อมกันกี่คำขอ
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	recorded := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reference := fmt.Sprintf("TRF-%03d", i)
+			_, err := h.Ledger.AddPayout(context.Background(), model.LedgerEntry{
+				ID:        earnings.PayoutID(reference),
+				RiderUID:  riderUID,
+				Type:      earnings.TypePayout,
+				Amount:    -30,
+				Reference: reference,
+			})
+			if err != nil && !errors.Is(err, store.ErrInsufficientBalance) {
+				t.Errorf("AddPayout(%s) error = %v", reference, err)
+			}
+			if err == nil {
+				mu.Lock()
+				recorded++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if recorded != 3 {
+		t.Errorf("recorded %d payouts, want 3", recorded)
+	}
+	balance, err := h.riderBalance(context.Background(), riderUID, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != 10 {
+		t.Errorf("balance = %d, want 10", balance)
+	}
+}
+
+func TestDeliverCreditsRider(t *testing.T) {
+	const riderUID = "+66888888888"
+	ctx := context.Background()
+	h, _ := newTestHandler()
+	h.Events = events.NewBus()
+	h.Earnings = earnings.Config{RiderSharePercent: 80}
+	rider := riderUID
+	dropoff := model.Coordinates{Latitude: 13.7465, Longitude: 100.5348}
+	deliveryID, err := h.Deliveries.CreateDelivery(ctx, model.Delivery{
+		SenderUID:       "+66811111111",
+		ReceiverUID:     "+66822222222",
+		ReceiverAddress: model.Address{Coordinates: dropoff},
+		Status:          lifecycle.StatusPickedUp,
+		RiderUID:        &rider,
+		DeliveryPIN:     "123456",
+		Fare:            &model.Fare{Total: 50},
+	}, model.StatusChange{To: lifecycle.StatusPickedUp, At: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := lifecycle.Input{Actor: lifecycle.Actor{UID: riderUID, Role: lifecycle.RoleRider}, Position: &dropoff, DeliveryPIN: "123456"}
+	if _, err := h.applyTransition(ctx, deliveryID, lifecycle.EventDeliver, in); err != nil {
+		t.Fatalf("applyTransition() error = %v", err)
+	}
+
+	entries, err := h.Ledger.ListLedgerEntries(ctx, riderUID, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ID != earnings.CreditID(deliveryID) || entries[0].Amount != 40 {
+		t.Errorf("ledger after delivery = %+v, want one credit of 40 for %s", entries, deliveryID)
+	}
+}
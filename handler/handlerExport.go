@@ -0,0 +1,292 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"api-flash-dash/export"
+	"api-flash-dash/model"
+	"api-flash-dash/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportSaveTimeout คือเวลาที่ให้ runDataExport บันทึกผลหลังจากงานเสร็จหรือหมดเวลา
+const exportSaveTimeout = 30 * time.Second
+
+// RequestDataExport เริ่มงานส่งออกข้อมูลส่วนบุคคลทั้งหมดของผู้ใช้ (สิทธิ์ขอเข้าถึงข้อมูลตาม PDPA)
+// งานทำในเบื้องหลังเพราะผู้ใช้ที่มีประวัติยาวอาจใช้เวลานาน แอปต้อง poll สถานะจาก GET /api/user/exports/{exportId}
+// ถ้ามีงานที่ยังไม่เสร็จอยู่แล้วจะคืนค่างานเดิมแทนการสร้างใหม่
+// Endpoint: POST /api/user/exports
+func (h *AuthHandler) RequestDataExport(c *gin.Context) {
+	ctx := c.Request.Context()
+	uid := c.GetString("uid")
+
+	// body เป็นค่าว่างได้ (ใช้รูปแบบ JSON)
+	var payload model.DataExportPayload
+	if err := c.ShouldBindJSON(&payload); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if payload.Format == "" {
+		payload.Format = export.FormatJSON
+	}
+
+	// 1. ตรวจงานเดิม: คืนค่างานที่ยังทำอยู่ และลบไฟล์ที่หมดอายุแล้ว
+	exports, err := h.Exports.ListExports(ctx, uid)
+	if err != nil {
+		log.Printf("Error listing data exports of %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start data export"})
+		return
+	}
+	now := time.Now()
+	for _, job := range exports {
+		h.failStaleDataExport(ctx, &job, now)
+		if job.Status == model.ExportPending {
+			c.JSON(http.StatusAccepted, gin.H{"message": "A data export is already in progress", "export": job})
+			return
+		}
+		if job.IsExpired(now) {
+			h.deleteDataExport(ctx, job.ID)
+		}
+	}
+
+	// 2. สร้างงานใหม่ แล้วให้ goroutine ทำต่อ (ไม่ผูกกับ context ของ request ที่จะจบไปก่อน)
+	job := model.DataExport{
+		UID:       uid,
+		Format:    payload.Format,
+		Status:    model.ExportPending,
+		CreatedAt: now,
+	}
+	job.ID, err = h.Exports.CreateExport(ctx, job)
+	if err != nil {
+		log.Printf("Error creating data export for %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start data export"})
+		return
+	}
+	go h.runDataExport(job)
+
+	c.Header("Location", "/api/user/exports/"+job.ID)
+	c.JSON(http.StatusAccepted, gin.H{"message": "Data export started", "export": job})
+}
+
+// ListDataExports ดึงงานส่งออกข้อมูลทั้งหมดของผู้ใช้ เรียงจากใหม่ไปเก่า
+// Endpoint: GET /api/user/exports
+func (h *AuthHandler) ListDataExports(c *gin.Context) {
+	uid := c.GetString("uid")
+	exports, err := h.Exports.ListExports(c.Request.Context(), uid)
+	if err != nil {
+		log.Printf("Error listing data exports of %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get data exports"})
+		return
+	}
+	if exports == nil {
+		exports = []model.DataExport{}
+	}
+	now := time.Now()
+	for i := range exports {
+		h.failStaleDataExport(c.Request.Context(), &exports[i], now)
+	}
+	c.JSON(http.StatusOK, gin.H{"exports": exports})
+}
+
+// GetDataExport ดูสถานะของงานส่งออกข้อมูล
+// Endpoint: GET /api/user/exports/{exportId}
+func (h *AuthHandler) GetDataExport(c *gin.Context) {
+	job, ok := h.ownDataExport(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"export": job})
+}
+
+// DownloadDataExport ดาวน์โหลดไฟล์ที่สร้างเสร็จแล้ว (JSON หรือ ZIP ตามที่ขอไว้)
+// Endpoint: GET /api/user/exports/{exportId}/download
+func (h *AuthHandler) DownloadDataExport(c *gin.Context) {
+	ctx := c.Request.Context()
+	job, ok := h.ownDataExport(c)
+	if !ok {
+		return
+	}
+
+	switch {
+	case job.Status == model.ExportPending:
+		c.JSON(http.StatusConflict, gin.H{"error": "Data export is not ready yet", "export": job})
+		return
+	case job.Status == model.ExportFailed:
+		c.JSON(http.StatusConflict, gin.H{"error": "Data export failed, please request a new one", "export": job})
+		return
+	case job.IsExpired(time.Now()):
+		h.deleteDataExport(ctx, job.ID)
+		c.JSON(http.StatusGone, gin.H{"error": "Data export has expired, please request a new one"})
+		return
+	}
+
+	file, err := h.ExportFiles.Open(job.ID)
+	if errors.Is(err, export.ErrNotFound) {
+		c.JSON(http.StatusGone, gin.H{"error": "Data export file is no longer available, please request a new one"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error opening data export %s: %v", job.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to download data export"})
+		return
+	}
+	defer file.Close()
+
+	filename := export.Filename(job.Format, job.CreatedAt)
+	c.DataFromReader(http.StatusOK, job.SizeBytes, export.ContentType(job.Format), file, map[string]string{
+		"Content-Disposition": `attachment; filename="` + filename + `"`,
+		"Cache-Control":       "no-store",
+	})
+}
+
+// ownDataExport ดึงงานส่งออกข้อมูลจาก path parameter และตรวจว่าเป็นของผู้ใช้ที่ล็อกอินอยู่
+// งานของคนอื่นจะตอบ 404 เหมือนไม่มีอยู่ ถ้าไม่พบจะตอบกลับ error ให้เองและคืนค่า false
+func (h *AuthHandler) ownDataExport(c *gin.Context) (*model.DataExport, bool) {
+	exportId := c.Param("exportId")
+	job, err := h.Exports.GetExport(c.Request.Context(), exportId)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("Error getting data export %s: %v", exportId, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get data export"})
+		return nil, false
+	}
+	if err != nil || job.UID != c.GetString("uid") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Data export not found"})
+		return nil, false
+	}
+	h.failStaleDataExport(c.Request.Context(), job, time.Now())
+	return job, true
+}
+
+// failStaleDataExport เปลี่ยนงานที่ค้าง pending เกินเวลา (goroutine หายไปพร้อมเซิร์ฟเวอร์ที่ restart) เป็น failed
+// ไม่อย่างนั้นงานนี้จะค้างตลอดไป และ RequestDataExport จะไม่ยอมสร้างงานใหม่ให้ผู้ใช้คนนี้อีก
+// เผื่อเวลาบันทึกผลของ runDataExport ไว้ด้วย (ถ้าบันทึกไม่สำเร็จจะบันทึก log และคืนค่าที่เปลี่ยนแล้วให้แอปเห็น)
+func (h *AuthHandler) failStaleDataExport(ctx context.Context, job *model.DataExport, now time.Time) {
+	if !job.IsStale(now, h.Export.Timeout+exportSaveTimeout) {
+		return
+	}
+	job.Status = model.ExportFailed
+	job.Error = "Data export was interrupted, please request a new one"
+	job.CompletedAt = &now
+	if err := h.Exports.SaveExport(ctx, *job); err != nil {
+		log.Printf("Error marking stale data export %s as failed: %v", job.ID, err)
+		return
+	}
+	log.Printf("Data export %s for %s was still pending after %s, marked as failed", job.ID, job.UID, h.Export.Timeout)
+}
+
+// runDataExport รวบรวมข้อมูล เขียนไฟล์ แล้วบันทึกผลลงเอกสารของงาน (ทำงานใน goroutine)
+func (h *AuthHandler) runDataExport(job model.DataExport) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.Export.Timeout)
+	defer cancel()
+
+	size, err := func() (int64, error) {
+		data, err := h.collectPersonalData(ctx, job.UID)
+		if err != nil {
+			return 0, err
+		}
+		return h.ExportFiles.Save(job.ID, func(w io.Writer) error {
+			return export.Write(w, job.Format, data)
+		})
+	}()
+
+	completedAt := time.Now()
+	job.CompletedAt = &completedAt
+	if err != nil {
+		log.Printf("Data export %s for %s failed: %v", job.ID, job.UID, err)
+		job.Status = model.ExportFailed
+		job.Error = "Failed to assemble personal data"
+	} else {
+		expiresAt := completedAt.Add(h.Export.TTL)
+		job.Status = model.ExportReady
+		job.SizeBytes = size
+		job.ExpiresAt = &expiresAt
+	}
+	// ใช้ context ใหม่ เผื่อ ctx ด้านบนหมดเวลาไปแล้ว
+	saveCtx, cancelSave := context.WithTimeout(context.Background(), exportSaveTimeout)
+	defer cancelSave()
+	if err := h.Exports.SaveExport(saveCtx, job); err != nil {
+		log.Printf("Error saving result of data export %s: %v", job.ID, err)
+		return
+	}
+	if job.Status == model.ExportReady {
+		h.notify(saveCtx, job.UID, model.Notification{
+			Type:    "data_export_ready",
+			Message: "ไฟล์ข้อมูลส่วนบุคคลของคุณพร้อมให้ดาวน์โหลดแล้ว",
+		})
+	}
+}
+
+// collectPersonalData รวบรวมข้อมูลทั้งหมดที่ระบบเก็บเกี่ยวกับผู้ใช้ uid
+func (h *AuthHandler) collectPersonalData(ctx context.Context, uid string) (*model.PersonalData, error) {
+	data := &model.PersonalData{GeneratedAt: time.Now()}
+
+	// 1. โปรไฟล์ ที่อยู่ และการแจ้งเตือน
+	profile, err := h.Users.GetUser(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	data.Profile = profile
+	if data.Addresses, err = h.Addresses.ListAddresses(ctx, uid); err != nil {
+		return nil, err
+	}
+	if data.Notifications, err = h.Notifications.ListNotifications(ctx, uid); err != nil {
+		return nil, err
+	}
+
+	// ให้หมวดที่ไม่มีข้อมูลเป็น [] ในไฟล์ ไม่ใช่ null
+	if data.Addresses == nil {
+		data.Addresses = []model.Address{}
+	}
+	if data.Notifications == nil {
+		data.Notifications = []model.Notification{}
+	}
+
+	// 2. ข้อมูลไรเดอร์ (รวมตำแหน่งล่าสุด) และบัญชีรายได้
+	isRider := profile.Role == model.RoleRider
+	if isRider {
+		rider, err := h.Riders.GetRider(ctx, uid)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return nil, err
+		}
+		data.Rider = rider
+		if data.Ledger, err = h.Ledger.ListLedgerEntries(ctx, uid, time.Time{}, time.Time{}); err != nil {
+			return nil, err
+		}
+	}
+
+	// 3. delivery ทุกรายการที่เป็นผู้ส่ง ผู้รับ หรือไรเดอร์ พร้อมประวัติสถานะ
+	// (ข้อมูลของคู่กรณีอื่นถูกลบออก ดู model.NewDeliveryRecord)
+	deliveries, err := h.accountDeliveries(ctx, uid, isRider)
+	if err != nil {
+		return nil, err
+	}
+	data.Deliveries = make([]model.DeliveryRecord, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		history, err := h.Deliveries.ListStatusHistory(ctx, delivery.ID)
+		if err != nil {
+			return nil, err
+		}
+		role := string(deliveryParty(&delivery, uid))
+		data.Deliveries = append(data.Deliveries, model.NewDeliveryRecord(uid, role, delivery, history))
+	}
+	return data, nil
+}
+
+// deleteDataExport ลบไฟล์และเอกสารของงานส่งออกข้อมูล (ข้อผิดพลาดจะถูกบันทึก log ไว้ด้วย)
+func (h *AuthHandler) deleteDataExport(ctx context.Context, exportId string) error {
+	if err := h.ExportFiles.Delete(exportId); err != nil {
+		log.Printf("Error deleting data export file %s: %v", exportId, err)
+		return err
+	}
+	if err := h.Exports.DeleteExport(ctx, exportId); err != nil {
+		log.Printf("Error deleting data export %s: %v", exportId, err)
+		return err
+	}
+	return nil
+}
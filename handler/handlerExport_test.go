@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"api-flash-dash/lifecycle"
+	"api-flash-dash/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStaleDataExportIsFailed(t *testing.T) {
+	const uid = "+66844444444"
+	h, _ := newTestHandler()
+	h.Export.Timeout = time.Minute
+	ctx := context.Background()
+
+	// งานที่ค้างอยู่เพราะเซิร์ฟเวอร์ถูก restart และงานที่เพิ่งเริ่ม
+	staleID, err := h.Exports.CreateExport(ctx, model.DataExport{UID: uid, Format: "json", Status: model.ExportPending, CreatedAt: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	freshID, err := h.Exports.CreateExport(ctx, model.DataExport{UID: uid, Format: "json", Status: model.ExportPending, CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(withUID)
+	router.GET("/exports", h.ListDataExports)
+	router.GET("/exports/:exportId", h.GetDataExport)
+
+	code, body := do(t, router, http.MethodGet, "/exports", uid, nil)
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (%v)", code, http.StatusOK, body)
+	}
+	statuses := map[string]string{}
+	for _, item := range body["exports"].([]interface{}) {
+		job := item.(map[string]interface{})
+		statuses[job["id"].(string)] = job["status"].(string)
+	}
+	if statuses[staleID] != model.ExportFailed || statuses[freshID] != model.ExportPending {
+		t.Errorf("statuses = %v, want %s failed and %s pending", statuses, staleID, freshID)
+	}
+
+	saved, err := h.Exports.GetExport(ctx, staleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != model.ExportFailed || saved.CompletedAt == nil || saved.Error == "" {
+		t.Errorf("stale export was not saved as failed: %+v", saved)
+	}
+
+	code, body = do(t, router, http.MethodGet, "/exports/"+freshID, uid, nil)
+	if code != http.StatusOK || body["export"].(map[string]interface{})["status"] != model.ExportPending {
+		t.Errorf("fresh export = %d %v, want it still pending", code, body)
+	}
+}
+
+func TestCollectPersonalDataRedactsOtherParties(t *testing.T) {
+	const (
+		senderUID   = "+66811111111"
+		receiverUID = "+66822222222"
+		riderUID    = "+66888888888"
+	)
+	ctx := context.Background()
+	h, _ := newTestHandler()
+	newTestRider(t, h, riderUID)
+	if err := h.Users.CreateUser(ctx, senderUID, model.UserProfile{Phone: senderUID, Role: model.RoleCustomer}); err != nil {
+		t.Fatal(err)
+	}
+	rider := riderUID
+	address := func(detail, phone string) model.Address {
+		return model.Address{
+			Detail:       detail,
+			Coordinates:  model.Coordinates{Latitude: 13.756331, Longitude: 100.501765},
+			ContactName:  "คุณสมชาย",
+			ContactPhone: phone,
+			AccessNotes:  "รหัสประตู 1234",
+		}
+	}
+	deliveryID, err := h.Deliveries.CreateDelivery(ctx, model.Delivery{
+		SenderUID:       senderUID,
+		ReceiverUID:     receiverUID,
+		SenderAddress:   address("99/1 ถนนพระราม 4", senderUID),
+		ReceiverAddress: address("12 ซอยสุขุมวิท 11", receiverUID),
+		Status:          lifecycle.StatusDelivered,
+		RiderUID:        &rider,
+		DeliveryCheck:   &model.LocationCheck{Position: &model.Coordinates{Latitude: 13.74, Longitude: 100.55}, WithinRange: true},
+	}, model.StatusChange{To: lifecycle.StatusPending, ActorUID: senderUID, ActorRole: string(lifecycle.RoleSender), At: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		uid        string
+		wantSender string
+		wantRider  string
+		wantActor  string // actorUID ของรายการแรกในประวัติสถานะ (ผู้ส่งเป็นผู้สร้าง)
+	}{
+		{uid: riderUID, wantSender: "sender", wantRider: riderUID, wantActor: string(lifecycle.RoleSender)},
+		{uid: senderUID, wantSender: senderUID, wantRider: "rider", wantActor: senderUID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uid, func(t *testing.T) {
+			data, err := h.collectPersonalData(ctx, tt.uid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data.Deliveries) != 1 {
+				t.Fatalf("got %d deliveries, want 1", len(data.Deliveries))
+			}
+			record := data.Deliveries[0]
+			delivery := record.Delivery
+			if delivery.ID != deliveryID || delivery.SenderUID != tt.wantSender || *delivery.RiderUID != tt.wantRider || delivery.ReceiverUID != "receiver" {
+				t.Errorf("parties = %s/%s/%s, want %s/receiver/%s", delivery.SenderUID, delivery.ReceiverUID, *delivery.RiderUID, tt.wantSender, tt.wantRider)
+			}
+			// ที่อยู่ของผู้รับไม่ใช่ข้อมูลของผู้ใช้คนนี้ เหลือแค่พิกัดโดยประมาณ
+			if got := delivery.ReceiverAddress; got.Detail != "" || got.ContactName != "" || got.ContactPhone != "" || got.AccessNotes != "" || got.Coordinates.Latitude != 13.76 {
+				t.Errorf("receiver address = %+v, want redacted", got)
+			}
+			ownSender := tt.uid == senderUID
+			if got := delivery.SenderAddress; (got.ContactPhone == senderUID) != ownSender || (got.AccessNotes != "") != ownSender {
+				t.Errorf("sender address = %+v, want kept only for the sender", got)
+			}
+			if got := delivery.DeliveryCheck; got == nil || !got.WithinRange || (got.Position != nil) != (tt.uid == riderUID) {
+				t.Errorf("delivery check = %+v, want rider position kept only for the rider", got)
+			}
+			if got := record.StatusHistory[0].ActorUID; got != tt.wantActor {
+				t.Errorf("history actorUID = %q, want %q", got, tt.wantActor)
+			}
+		})
+	}
+
+	// ข้อมูลที่เก็บไว้ต้องไม่ถูกแก้ไข
+	stored, err := h.Deliveries.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.DeliveryCheck.Position == nil || stored.ReceiverAddress.ContactPhone != receiverUID {
+		t.Errorf("stored delivery was modified: %+v", stored)
+	}
+}
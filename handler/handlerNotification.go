@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"api-flash-dash/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// notify บันทึกการแจ้งเตือนให้ผู้ใช้ uid
+// ถ้าบันทึกไม่สำเร็จจะแค่ log ไว้ ไม่ทำให้ request หลักล้มเหลว
+func (h *AuthHandler) notify(ctx context.Context, uid string, notification model.Notification) {
+	notification.CreatedAt = time.Now()
+	if err := h.Notifications.AddNotification(ctx, uid, notification); err != nil {
+		log.Printf("Failed to notify %s (%s): %v", uid, notification.Type, err)
+	}
+}
+
+// GetUserNotifications ดึงการแจ้งเตือนทั้งหมดของผู้ใช้ที่ล็อกอินอยู่
+func (h *AuthHandler) GetUserNotifications(c *gin.Context) {
+	uid, exists := c.Get("uid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User UID not found in context"})
+		return
+	}
+
+	notifications, err := h.Notifications.ListNotifications(context.Background(), uid.(string))
+	if err != nil {
+		log.Printf("Failed to list notifications for %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notifications": notifications})
+}
@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"api-flash-dash/model"
+	"api-flash-dash/otp"
+	"api-flash-dash/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestRegistrationOTP ส่งรหัส OTP ไปยังเบอร์ที่ต้องการสมัคร
+// Endpoint: POST /auth/register/otp
+func (h *AuthHandler) RequestRegistrationOTP(c *gin.Context) {
+	var payload model.OTPRequestPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	phoneE164, ok := normalizePhone(c, payload.Phone)
+	if !ok {
+		return
+	}
+
+	// เบอร์ที่สมัครแล้วไม่ต้องส่ง SMS (ประหยัดค่า SMS และกันการยิงใส่เบอร์คนอื่น)
+	if _, err := h.Users.GetUser(c.Request.Context(), phoneE164); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "This phone number is already registered."})
+		return
+	} else if !errors.Is(err, store.ErrNotFound) {
+		log.Printf("Error checking existing user %s: %v", phoneE164, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification code"})
+		return
+	}
+
+	h.sendOTP(c, otp.PurposeRegister, phoneE164)
+}
+
+// VerifyRegistrationOTP ตรวจรหัส OTP และคืนค่า verificationTicket สำหรับใช้สมัครสมาชิก
+// Endpoint: POST /auth/register/otp/verify
+func (h *AuthHandler) VerifyRegistrationOTP(c *gin.Context) {
+	var payload model.OTPVerifyPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	phoneE164, ok := normalizePhone(c, payload.Phone)
+	if !ok {
+		return
+	}
+
+	ticket, ok := h.verifyOTP(c, otp.PurposeRegister, phoneE164, payload.Code)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":            "Phone number verified",
+		"verificationTicket": ticket,
+		"expiresInSeconds":   int(h.OTP.TicketTTLFor(otp.PurposeRegister).Seconds()),
+	})
+}
+
+// sendOTP สร้างรหัสใหม่ (ถ้าไม่ติดการจำกัดการส่ง) แล้วส่ง SMS ไปยังเบอร์ และตอบกลับแอป
+func (h *AuthHandler) sendOTP(c *gin.Context, purpose, phoneE164 string) {
+	// 1. สร้างรหัส
+	code, ok := h.issueOTP(c, purpose, phoneE164)
+	if !ok {
+		return
+	}
+
+	// 2. ส่ง SMS (ถ้าส่งไม่สำเร็จ ผู้ใช้ขอใหม่ได้หลังครบ ResendInterval)
+	if err := h.SMS.Send(c.Request.Context(), phoneE164, otp.Message(code, h.OTP.CodeTTL)); err != nil {
+		log.Printf("Error sending OTP SMS to %s: %v", phoneE164, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send verification code, please try again shortly"})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.otpSentResponse(phoneE164))
+}
+
+// issueOTP สร้างรหัสใหม่ภายใน Transaction เพื่อให้การจำกัดการส่งถูกต้องแม้มีคำขอพร้อมกัน
+// ถ้าติดการจำกัดหรือผิดพลาดจะตอบ error กลับไปให้แล้ว และคืนค่า false
+func (h *AuthHandler) issueOTP(c *gin.Context, purpose, phoneE164 string) (string, bool) {
+	now := time.Now()
+	var code string
+	var retryAfter time.Duration
+	err := h.Verifications.UpdatePhoneVerification(c.Request.Context(), purpose, phoneE164, func(v *model.PhoneVerification) error {
+		var err error
+		code, err = otp.Issue(v, h.OTP, now)
+		if err != nil {
+			retryAfter = otp.RetryAfter(v, h.OTP, now)
+		}
+		return err
+	})
+	if errors.Is(err, otp.ErrResendTooSoon) || errors.Is(err, otp.ErrTooManySends) {
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error(), "retryAfterSeconds": seconds})
+		return "", false
+	}
+	if err != nil {
+		log.Printf("Error issuing OTP for %s: %v", phoneE164, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification code"})
+		return "", false
+	}
+	return code, true
+}
+
+// otpSentResponse คือ response หลังส่งรหัสแล้ว
+func (h *AuthHandler) otpSentResponse(phoneE164 string) gin.H {
+	return gin.H{
+		"message":            "Verification code sent",
+		"phone":              phoneE164,
+		"expiresInSeconds":   int(h.OTP.CodeTTL.Seconds()),
+		"resendAfterSeconds": int(h.OTP.ResendInterval.Seconds()),
+	}
+}
+
+// verifyOTP ตรวจรหัสและคืนค่า ticket ถ้าไม่ผ่านจะตอบ error กลับไปให้แล้ว และคืนค่า false
+func (h *AuthHandler) verifyOTP(c *gin.Context, purpose, phoneE164, code string) (string, bool) {
+	now := time.Now()
+	var ticket string
+	var verifyErr error
+	var remaining int
+	err := h.Verifications.UpdatePhoneVerification(c.Request.Context(), purpose, phoneE164, func(v *model.PhoneVerification) error {
+		ticket, verifyErr = otp.Verify(v, code, h.OTP, now)
+		remaining = otp.AttemptsRemaining(v, h.OTP)
+		// รหัสผิดต้องบันทึกจำนวนครั้งที่ลองไว้ด้วย จึงไม่คืนค่า error ให้ store
+		if errors.Is(verifyErr, otp.ErrInvalidCode) || errors.Is(verifyErr, otp.ErrTooManyAttempts) {
+			return nil
+		}
+		return verifyErr
+	})
+	if err == nil {
+		err = verifyErr
+	}
+
+	switch {
+	case err == nil:
+		return ticket, true
+	case errors.Is(err, otp.ErrInvalidCode):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "attemptsRemaining": remaining})
+	case errors.Is(err, otp.ErrTooManyAttempts):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	case errors.Is(err, otp.ErrNoCode):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, otp.ErrCodeExpired):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Error verifying OTP for %s: %v", phoneE164, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+	}
+	return "", false
+}
+
+// redeemTicketUntil ใช้ ticket ที่ได้จาก verifyOTP (ครั้งเดียว) ถ้าไม่ผ่านจะตอบ error กลับไปให้แล้ว และคืนค่า false
+// คืนค่าเวลาหมดอายุเดิมของ ticket ด้วย (ใช้คืน ticket ด้วย restoreTicket)
+func (h *AuthHandler) redeemTicketUntil(c *gin.Context, purpose, phoneE164, ticket string) (time.Time, bool) {
+	var expiresAt time.Time
+	err := h.Verifications.UpdatePhoneVerification(c.Request.Context(), purpose, phoneE164, func(v *model.PhoneVerification) error {
+		expiresAt = v.TicketExpiresAt
+		return otp.Redeem(v, ticket, time.Now())
+	})
+	switch {
+	case err == nil:
+		return expiresAt, true
+	case errors.Is(err, otp.ErrInvalidTicket), errors.Is(err, otp.ErrTicketExpired):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Error redeeming verification ticket for %s: %v", phoneE164, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check verification ticket"})
+	}
+	return time.Time{}, false
+}
+
+// restoreTicket คืน ticket ที่ใช้ไปแล้วด้วย otp.Restore เมื่อขั้นตอนหลังจากนั้นล้มเหลว (ผู้ใช้ไม่ต้องขอ OTP ใหม่)
+func (h *AuthHandler) restoreTicket(ctx context.Context, purpose, phoneE164, ticket string, expiresAt time.Time) error {
+	return h.Verifications.UpdatePhoneVerification(ctx, purpose, phoneE164, func(v *model.PhoneVerification) error {
+		otp.Restore(v, ticket, expiresAt)
+		return nil
+	})
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"api-flash-dash/model"
+	"api-flash-dash/otp"
+	"api-flash-dash/store"
+
+	"firebase.google.com/go/v4/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// ระบบใช้อีเมลสังเคราะห์ (@flashdash.app) การรีเซ็ตรหัสผ่านทางอีเมลของ Firebase จึงส่งไม่ถึงผู้ใช้
+// ขั้นตอนจึงเป็น: ขอ OTP ทาง SMS -> ยืนยัน OTP ได้ resetTicket (อายุสั้น) -> ตั้งรหัสผ่านใหม่
+
+// RequestPasswordReset ส่งรหัส OTP สำหรับรีเซ็ตรหัสผ่าน
+// ตอบกลับเหมือนกันไม่ว่าจะมีบัญชีหรือไม่ (รวมถึงการจำกัดการส่งซ้ำ) เพื่อไม่ให้ใช้ endpoint นี้ไล่เช็กว่าเบอร์ไหนสมัครไว้
+// Endpoint: POST /auth/password/reset/request
+func (h *AuthHandler) RequestPasswordReset(c *gin.Context) {
+	var payload model.OTPRequestPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	phoneE164, ok := normalizePhone(c, payload.Phone)
+	if !ok {
+		return
+	}
+
+	user, err := h.Users.GetUser(c.Request.Context(), phoneE164)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("Error checking user %s for password reset: %v", phoneE164, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification code"})
+		return
+	}
+	// ไม่มีบัญชี หรือบัญชีถูกระงับ: ไม่ส่ง SMS แต่สร้างรหัสตามขั้นตอนปกติ (ไม่มีใครได้รับรหัสนี้)
+	// เพื่อให้ตอบเหมือนส่งแล้วทุกประการ ทั้ง 429 เมื่อขอซ้ำเร็วเกินไป และผลของการยืนยันรหัสภายหลัง
+	if err != nil || user.IsSuspended() {
+		if _, ok := h.issueOTP(c, otp.PurposePasswordReset, phoneE164); ok {
+			c.JSON(http.StatusOK, h.otpSentResponse(phoneE164))
+		}
+		return
+	}
+
+	h.sendOTP(c, otp.PurposePasswordReset, phoneE164)
+}
+
+// VerifyPasswordResetOTP ตรวจรหัส OTP และคืนค่า resetTicket สำหรับตั้งรหัสผ่านใหม่
+// Endpoint: POST /auth/password/reset/verify
+func (h *AuthHandler) VerifyPasswordResetOTP(c *gin.Context) {
+	var payload model.OTPVerifyPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	phoneE164, ok := normalizePhone(c, payload.Phone)
+	if !ok {
+		return
+	}
+
+	ticket, ok := h.verifyOTP(c, otp.PurposePasswordReset, phoneE164, payload.Code)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Phone number verified, set a new password before the ticket expires",
+		"resetTicket":      ticket,
+		"expiresInSeconds": int(h.OTP.TicketTTLFor(otp.PurposePasswordReset).Seconds()),
+	})
+}
+
+// ResetPassword ตั้งรหัสผ่านใหม่ด้วย resetTicket แล้วเพิกถอน session เดิมทุกอุปกรณ์
+// Endpoint: POST /auth/password/reset
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var payload model.PasswordResetPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	phoneE164, ok := normalizePhone(c, payload.Phone)
+	if !ok {
+		return
+	}
+
+	// 1. ใช้ ticket (ครั้งเดียว)
+	expiresAt, ok := h.redeemTicketUntil(c, otp.PurposePasswordReset, phoneE164, payload.ResetTicket)
+	if !ok {
+		return
+	}
+
+	// 2. ตั้งรหัสผ่านใหม่ใน Firebase Authentication
+	// ถ้าไม่สำเร็จจะคืน ticket ให้ลองใหม่ได้จนหมดอายุเดิม (ไม่ใช้ context ของ request เพราะอาจถูกยกเลิกไปแล้ว)
+	ctx := c.Request.Context()
+	if _, err := h.AuthClient.UpdateUser(ctx, phoneE164, (&auth.UserToUpdate{}).Password(payload.NewPassword)); err != nil {
+		restoreCtx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+		if restoreErr := h.restoreTicket(restoreCtx, otp.PurposePasswordReset, phoneE164, payload.ResetTicket, expiresAt); restoreErr != nil {
+			log.Printf("Error restoring password reset ticket of %s: %v", phoneE164, restoreErr)
+		}
+		cancel()
+		if auth.IsUserNotFound(err) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+			return
+		}
+		log.Printf("Error resetting password of %s: %v", phoneE164, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	// 3. เพิกถอน session เดิม (อาจเป็นคนที่รู้รหัสผ่านเก่าอยู่)
+	if err := h.AuthClient.RevokeRefreshTokens(ctx, phoneE164); err != nil {
+		log.Printf("Password of %s was reset but revoking sessions failed: %v", phoneE164, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password was reset but existing sessions could not be signed out, please log in and log out again"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset, please log in with your new password"})
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"api-flash-dash/model"
+	"api-flash-dash/otp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestRequestPasswordResetParity ตรวจว่าผู้เรียกแยกไม่ออกว่าเบอร์ไหนมีบัญชี
+// (ตอบเหมือนกันทั้งครั้งแรกและตอนขอซ้ำเร็วเกินไป) แต่ส่ง SMS ให้เฉพาะบัญชีที่ใช้งานได้
+func TestRequestPasswordResetParity(t *testing.T) {
+	const (
+		known     = "+66855555555"
+		unknown   = "+66866666666"
+		suspended = "+66877777777"
+	)
+	h, sms := newTestHandler()
+	ctx := context.Background()
+	h.Users.CreateUser(ctx, known, model.UserProfile{Phone: known, Role: model.RoleCustomer})
+	h.Users.CreateUser(ctx, suspended, model.UserProfile{Phone: suspended, Role: model.RoleCustomer, Status: model.AccountSuspended})
+
+	router := gin.New()
+	router.POST("/reset", h.RequestPasswordReset)
+
+	type result struct {
+		Code int
+		Keys []string
+	}
+	request := func(p string) result {
+		code, body := do(t, router, http.MethodPost, "/reset", "", gin.H{"phone": p})
+		keys := make([]string, 0, len(body))
+		for key := range body {
+			if key != "phone" {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		return result{code, keys}
+	}
+
+	for _, attempt := range []string{"first request", "resend too soon"} {
+		want := request(known)
+		for _, p := range []string{unknown, suspended} {
+			if got := request(p); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: %s got %+v, known account got %+v", attempt, p, got, want)
+			}
+		}
+	}
+	if first := request(known); first.Code != http.StatusTooManyRequests {
+		t.Errorf("resend status = %d, want %d", first.Code, http.StatusTooManyRequests)
+	}
+
+	if !reflect.DeepEqual(sms.sent, []string{known}) {
+		t.Errorf("SMS sent to %v, want only %s", sms.sent, known)
+	}
+}
+
+// TestResetPasswordRestoresTicket ตรวจว่าถ้าตั้งรหัสผ่านใน Firebase ไม่สำเร็จ ticket จะถูกคืนให้ลองใหม่ได้
+func TestResetPasswordRestoresTicket(t *testing.T) {
+	const phone = "+66855555555"
+	h, _ := newTestHandler()
+	auth := newFakeAuth(t, h, "")
+	var ticket string
+	err := h.Verifications.UpdatePhoneVerification(context.Background(), otp.PurposePasswordReset, phone, func(v *model.PhoneVerification) error {
+		code, err := otp.Issue(v, h.OTP, time.Now())
+		if err != nil {
+			return err
+		}
+		ticket, err = otp.Verify(v, code, h.OTP, time.Now())
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.POST("/reset", h.ResetPassword)
+	body := gin.H{"phone": phone, "resetTicket": ticket, "newPassword": "new-secret"}
+
+	auth.setFail("accounts:update", true)
+	if code, resp := do(t, router, http.MethodPost, "/reset", "", body); code != http.StatusInternalServerError {
+		t.Fatalf("failed update: status = %d, want %d (%v)", code, http.StatusInternalServerError, resp)
+	}
+	auth.setFail("accounts:update", false)
+	if code, resp := do(t, router, http.MethodPost, "/reset", "", body); code != http.StatusOK {
+		t.Fatalf("retry: status = %d, want %d (%v)", code, http.StatusOK, resp)
+	}
+	// ใช้สำเร็จแล้ว ใช้ซ้ำไม่ได้
+	if code, resp := do(t, router, http.MethodPost, "/reset", "", body); code != http.StatusForbidden {
+		t.Errorf("reuse: status = %d, want %d (%v)", code, http.StatusForbidden, resp)
+	}
+}
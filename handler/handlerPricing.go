@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"api-flash-dash/model"
+	"api-flash-dash/pricing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// quoteFare คำนวณค่าส่งระหว่างที่อยู่ 2 แห่ง
+// ถ้าคำนวณไม่ได้จะตอบกลับ error ให้แอปเอง และคืนค่า nil
+func (h *AuthHandler) quoteFare(c *gin.Context, from, to model.Address, vehicleType string) *model.Fare {
+	fare, err := h.Pricing.Quote(from.Coordinates, to.Coordinates, vehicleType)
+	if errors.Is(err, pricing.ErrUnknownVehicleType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "vehicleTypes": h.Pricing.VehicleTypes()})
+		return nil
+	}
+	if err != nil {
+		log.Printf("Failed to quote fare: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate fare"})
+		return nil
+	}
+	fare.QuotedAt = time.Now()
+	return &fare
+}
+
+// QuoteDelivery คำนวณค่าส่งล่วงหน้าก่อนเรียก CreateDeliveryHandler
+// ราคาที่ได้เป็นเพียงการประเมิน ราคาจริงจะถูกคำนวณใหม่และล็อกไว้ตอนสร้างการจัดส่ง
+func (h *AuthHandler) QuoteDelivery(c *gin.Context) {
+	// 1. ดึง UID ของผู้ส่งจาก Context
+	senderUID, exists := c.Get("uid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Sender UID not found"})
+		return
+	}
+	senderUIDStr := senderUID.(string)
+
+	// 2. รับข้อมูล JSON จากแอป
+	var payload model.QuotePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	var ok bool
+	if payload.ReceiverPhone, ok = normalizePhone(c, payload.ReceiverPhone); !ok {
+		return
+	}
+
+	// 3. ดึงพิกัดของที่อยู่ผู้ส่งและผู้รับ
+	senderAddress, err := h.Addresses.GetAddress(context.Background(), senderUIDStr, payload.SenderAddressID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve sender address"})
+		return
+	}
+	receiverAddress, err := h.Addresses.GetAddress(context.Background(), payload.ReceiverPhone, payload.ReceiverAddressID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve receiver address"})
+		return
+	}
+
+	// 4. คำนวณค่าส่งแล้วส่งกลับไป
+	fare := h.quoteFare(c, *senderAddress, *receiverAddress, payload.VehicleType)
+	if fare == nil {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"fare": fare})
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"api-flash-dash/lifecycle"
+	"api-flash-dash/model"
+	"api-flash-dash/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// riderRatingSummary ดึงคะแนนเฉลี่ยและจำนวนรีวิวจากข้อมูลไรเดอร์
+func riderRatingSummary(rider *model.Rider) model.RatingSummary {
+	return model.RatingSummary{Average: rider.RatingAverage, Count: rider.RatingCount}
+}
+
+// RateRider ให้ผู้ส่งหรือผู้รับให้คะแนนไรเดอร์ (1-5 ดาว) หลังจากส่งของสำเร็จ
+// แต่ละคนให้คะแนนได้ครั้งเดียวต่อ 1 delivery
+func (h *AuthHandler) RateRider(c *gin.Context) {
+	ctx := context.Background()
+
+	// 1. ดึง deliveryId จาก URL และ UID จาก Token
+	deliveryId := c.Param("deliveryId")
+	if deliveryId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Delivery ID is required"})
+		return
+	}
+	uid, exists := c.Get("uid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: UID not found"})
+		return
+	}
+	raterUID := uid.(string)
+
+	// 2. รับคะแนนและความคิดเห็น
+	var payload model.RatingPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	// 3. ตรวจสอบว่าเป็นผู้ส่งหรือผู้รับ และงานส่งสำเร็จแล้ว
+	delivery, err := h.Deliveries.GetDelivery(ctx, deliveryId)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get delivery %s: %v", deliveryId, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get delivery"})
+		return
+	}
+	role := deliveryParty(delivery, raterUID)
+	if role != lifecycle.RoleSender && role != lifecycle.RoleReceiver {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the sender or receiver can rate this delivery"})
+		return
+	}
+	if delivery.Status != lifecycle.StatusDelivered || delivery.RiderUID == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only delivered deliveries can be rated"})
+		return
+	}
+
+	// 4. บันทึกรีวิวและอัปเดตคะแนนเฉลี่ยของไรเดอร์ (Transaction)
+	rider, err := h.Riders.AddRating(ctx, model.Rating{
+		DeliveryID: deliveryId,
+		RiderUID:   *delivery.RiderUID,
+		RaterUID:   raterUID,
+		RaterRole:  string(role),
+		Score:      payload.Score,
+		Comment:    strings.TrimSpace(payload.Comment),
+		CreatedAt:  time.Now(),
+	})
+	if errors.Is(err, store.ErrAlreadyExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "You have already rated this delivery"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to rate rider for delivery %s: %v", deliveryId, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save rating"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":     "Rating saved successfully",
+		"riderRating": riderRatingSummary(rider),
+	})
+}
+
+// GetRiderRatings ดึงคะแนนเฉลี่ยและรีวิวทั้งหมดของไรเดอร์
+// ผู้ใช้ที่ล็อกอินแล้วทุกคนเรียกได้ จึงส่งเฉพาะข้อมูลที่ไม่ระบุตัวผู้ให้คะแนน (ดู model.PublicRating)
+func (h *AuthHandler) GetRiderRatings(c *gin.Context) {
+	ctx := context.Background()
+
+	riderUID := c.Param("riderId")
+	rider, err := h.Riders.GetRider(ctx, riderUID)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rider not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get rider %s: %v", riderUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get rider data"})
+		return
+	}
+
+	ratings, err := h.Riders.ListRatings(ctx, riderUID)
+	if err != nil {
+		log.Printf("Failed to list ratings for rider %s: %v", riderUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get ratings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"riderRating": riderRatingSummary(rider),
+		"ratings":     model.PublicRatings(ratings),
+	})
+}
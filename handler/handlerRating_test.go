@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"api-flash-dash/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetRiderRatingsHidesRater(t *testing.T) {
+	const riderUID = "+66822222222"
+	h, _ := newTestHandler()
+	ctx := context.Background()
+	if err := h.Riders.CreateRider(ctx, riderUID, model.Rider{}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := h.Riders.AddRating(ctx, model.Rating{
+		DeliveryID: "delivery-1",
+		RiderUID:   riderUID,
+		RaterUID:   "+66833333333",
+		RaterRole:  "sender",
+		Score:      4,
+		Comment:    "fast",
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.GET("/riders/:riderId/ratings", h.GetRiderRatings)
+	code, body := do(t, router, http.MethodGet, "/riders/"+riderUID+"/ratings", "", nil)
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (%v)", code, http.StatusOK, body)
+	}
+	ratings := body["ratings"].([]interface{})
+	if len(ratings) != 1 {
+		t.Fatalf("got %d ratings, want 1", len(ratings))
+	}
+	rating := ratings[0].(map[string]interface{})
+	for _, field := range []string{"raterUID", "deliveryId", "id", "riderUID"} {
+		if _, ok := rating[field]; ok {
+			t.Errorf("public rating exposes %q: %v", field, rating)
+		}
+	}
+	if rating["score"] != float64(4) || rating["comment"] != "fast" || rating["raterRole"] != "sender" {
+		t.Errorf("rating = %v", rating)
+	}
+
+	if code, _ := do(t, router, http.MethodGet, "/riders/unknown/ratings", "", nil); code != http.StatusNotFound {
+		t.Errorf("unknown rider status = %d, want %d", code, http.StatusNotFound)
+	}
+}
@@ -1,18 +1,21 @@
 package handler
 
 import (
+	"api-flash-dash/events"
+	"api-flash-dash/geo"
+	"api-flash-dash/identity"
+	"api-flash-dash/lifecycle"
 	"api-flash-dash/model"
+	"api-flash-dash/store"
 	"context"
 	"errors"
 	"log"
 	"net/http"
-	"strings"
+	"sort"
+	"strconv"
 
-	"cloud.google.com/go/firestore"
 	"firebase.google.com/go/v4/auth"
 	"github.com/gin-gonic/gin"
-	"google.golang.org/api/iterator"
-	latlng "google.golang.org/genproto/googleapis/type/latlng"
 )
 
 // +++ ฟังก์ชันใหม่สำหรับอัปเดตโปรไฟล์ Rider (ฉบับปรับปรุง) +++
@@ -36,17 +39,17 @@ func (h *AuthHandler) UpdateRiderProfile(c *gin.Context) {
 
 	// 3. เตรียมข้อมูลที่จะอัปเดต
 	authParams := &auth.UserToUpdate{}
-	var firestoreUpdatesUsers []firestore.Update
-	var firestoreUpdatesRiders []firestore.Update
+	var userUpdate store.UserUpdate
+	var riderUpdate store.RiderUpdate
 
 	// --- ข้อมูลสำหรับ Collection 'users' และ Firebase Auth ---
 	if payload.Name != nil {
 		authParams.DisplayName(*payload.Name)
-		firestoreUpdatesUsers = append(firestoreUpdatesUsers, firestore.Update{Path: "name", Value: *payload.Name})
+		userUpdate.Name = payload.Name
 	}
 	if payload.ImageProfile != nil {
 		authParams.PhotoURL(*payload.ImageProfile)
-		firestoreUpdatesUsers = append(firestoreUpdatesUsers, firestore.Update{Path: "image_profile", Value: *payload.ImageProfile})
+		userUpdate.ImageProfile = payload.ImageProfile
 	}
 	if payload.Password != nil && *payload.Password != "" {
 		if len(*payload.Password) < 6 {
@@ -57,12 +60,8 @@ func (h *AuthHandler) UpdateRiderProfile(c *gin.Context) {
 	}
 
 	// --- ข้อมูลสำหรับ Collection 'riders' ---
-	if payload.ImageVehicle != nil {
-		firestoreUpdatesRiders = append(firestoreUpdatesRiders, firestore.Update{Path: "image_vehicle", Value: *payload.ImageVehicle})
-	}
-	if payload.VehicleRegistration != nil {
-		firestoreUpdatesRiders = append(firestoreUpdatesRiders, firestore.Update{Path: "vehicle_registration", Value: *payload.VehicleRegistration})
-	}
+	riderUpdate.ImageVehicle = payload.ImageVehicle
+	riderUpdate.VehicleRegistration = payload.VehicleRegistration
 
 	// 4. อัปเดตข้อมูลใน Firebase Authentication (ถ้ามี)
 	// ตรวจสอบว่ามีข้อมูลที่ต้องอัปเดตใน Auth หรือไม่ เพื่อลดการเรียก API ที่ไม่จำเป็น
@@ -72,30 +71,25 @@ func (h *AuthHandler) UpdateRiderProfile(c *gin.Context) {
 			return
 		}
 	}
-
-	// 5. [ปรับปรุง] ใช้ BATCH WRITE เพื่ออัปเดต Firestore ทั้ง 2 Collections ในครั้งเดียว
-	batch := h.FirestoreClient.Batch()
-
-	// เพิ่มการอัปเดตสำหรับ 'users' collection เข้าไปใน batch
-	if len(firestoreUpdatesUsers) > 0 {
-		userRef := h.FirestoreClient.Collection("users").Doc(uidStr)
-		batch.Update(userRef, firestoreUpdatesUsers)
-	}
-
-	// เพิ่มการอัปเดตสำหรับ 'riders' collection เข้าไปใน batch
-	if len(firestoreUpdatesRiders) > 0 {
-		riderRef := h.FirestoreClient.Collection("riders").Doc(uidStr)
-		batch.Update(riderRef, firestoreUpdatesRiders)
-	}
-
-	// สั่งทำงาน batch (ถ้ามีอะไรให้อัปเดต)
-	if len(firestoreUpdatesUsers) > 0 || len(firestoreUpdatesRiders) > 0 {
-		if _, err := batch.Commit(ctx); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit Firestore batch update: " + err.Error()})
+	// เปลี่ยนรหัสผ่านแล้ว ต้องเพิกถอน session เดิมทั้งหมด
+	passwordChanged := payload.Password != nil && *payload.Password != ""
+	var session *identity.Token
+	if passwordChanged {
+		var err error
+		if session, err = h.revokeSessions(ctx, uidStr, *payload.Password); err != nil {
+			log.Printf("Error revoking sessions of %s: %v", uidStr, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Password was changed but other sessions could not be signed out, please log out manually"})
 			return
 		}
 	}
 
+	// 5. [ปรับปรุง] อัปเดตทั้ง 2 Collections ในครั้งเดียว (Firestore ใช้ Transaction)
+	// ถ้าเปลี่ยนข้อมูลรถหลังผ่านการตรวจสอบแล้ว จะกลับไปรอตรวจสอบใหม่ (รับงานไม่ได้จนกว่าแอดมินจะอนุมัติอีกครั้ง)
+	if err := h.Riders.UpdateRiderProfile(ctx, uidStr, userUpdate, riderUpdate); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit Firestore batch update: " + err.Error()})
+		return
+	}
+
 	// 6. [ปรับปรุง] ดึงข้อมูลล่าสุดทั้งหมดด้วยฟังก์ชันช่วย
 	updatedData, err := h.getRiderDataByUID(uidStr)
 	if err != nil {
@@ -103,17 +97,14 @@ func (h *AuthHandler) UpdateRiderProfile(c *gin.Context) {
 		return
 	}
 
-	// 7. [ปรับปรุง] ดึง ID Token เดิมจาก Header
-	authHeader := c.GetHeader("Authorization")
-	idToken := strings.Replace(authHeader, "Bearer ", "", 1)
-
-	// 8. ส่ง Response กลับในโครงสร้างที่สมบูรณ์
-	c.JSON(http.StatusOK, gin.H{
+	// 7. ส่ง Response กลับในโครงสร้างที่สมบูรณ์
+	// idToken คือ Token เดิมจาก Header หรือ Token ใหม่ถ้าเปลี่ยนรหัสผ่าน (ดู sessionResponse)
+	c.JSON(http.StatusOK, sessionResponse(c, gin.H{
 		"message":          "อัปเดตโปรไฟล์ Rider สำเร็จ",
-		"idToken":          idToken, // <-- เพิ่ม idToken
 		"userProfile":      updatedData["userProfile"],
 		"roleSpecificData": updatedData["roleSpecificData"],
-	})
+		"rating":           updatedData["rating"],
+	}, passwordChanged, session))
 }
 
 // +++ ฟังก์ชันช่วยสำหรับดึงข้อมูล Rider (ปรับปรุงตามตัวอย่าง) +++
@@ -121,25 +112,24 @@ func (h *AuthHandler) getRiderDataByUID(uid string) (map[string]interface{}, err
 	ctx := context.Background()
 
 	// 1. ดึงข้อมูลจาก 'users' collection
-	userDoc, err := h.FirestoreClient.Collection("users").Doc(uid).Get(ctx)
+	userProfile, err := h.Users.GetUser(ctx, uid)
 	if err != nil {
-		log.Printf("Error getting user from Firestore: %v\n", err)
+		log.Printf("Error getting user from store: %v\n", err)
 		return nil, err
 	}
-	userProfile := userDoc.Data()
 
 	// 2. ดึงข้อมูลจาก 'riders' collection
-	riderDoc, err := h.FirestoreClient.Collection("riders").Doc(uid).Get(ctx)
+	riderDetails, err := h.Riders.GetRider(ctx, uid)
 	if err != nil {
-		log.Printf("Error getting rider data from Firestore: %v\n", err)
+		log.Printf("Error getting rider data from store: %v\n", err)
 		return nil, err
 	}
-	riderDetails := riderDoc.Data()
 
 	// 3. สร้างข้อมูลที่จะส่งกลับ
 	fullResponse := map[string]interface{}{
 		"userProfile":      userProfile,
 		"roleSpecificData": riderDetails,
+		"rating":           riderRatingSummary(riderDetails),
 	}
 
 	return fullResponse, nil
@@ -147,66 +137,92 @@ func (h *AuthHandler) getRiderDataByUID(uid string) (map[string]interface{}, err
 
 //yesss
 
-// GetPendingDeliveries ดึงรายการจัดส่งทั้งหมดที่มีสถานะเป็น "pending" สำหรับ Rider
+// ค่ารัศมีค้นหางาน (กม.) ที่ใช้เมื่อแอปไม่ได้ส่ง radiusKm มา และค่าสูงสุดที่อนุญาต
+const (
+	defaultPendingRadiusKm = 5.0
+	maxPendingRadiusKm     = 50.0
+)
+
+// GetPendingDeliveries ดึงรายการจัดส่งที่มีสถานะเป็น "pending" ที่อยู่ในรัศมีรอบตัว Rider
+// โดยใช้ currentLocation ล่าสุดของไรเดอร์ และเรียงจากจุดรับสินค้าที่ใกล้ที่สุดก่อน
+// Query: ?radiusKm=5 (ไม่บังคับ)
 func (h *AuthHandler) GetPendingDeliveries(c *gin.Context) {
-	var deliveries []model.Delivery
 	ctx := context.Background()
 
-	// 1. สร้าง Query เพื่อดึงข้อมูล delivery ที่มี status เป็น "pending"
-	//    และเรียงลำดับจากเก่าที่สุดไปใหม่ที่สุด (เพื่อให้ Rider รับงานที่ค้างนานที่สุดก่อน)
-	iter := h.FirestoreClient.Collection("deliveries").
-		Where("status", "==", "pending").
-		Documents(ctx)
-
-	// 2. วนลูปเพื่ออ่านข้อมูลแต่ละรายการ (เหมือนโค้ดเดิม)
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
+	uid, exists := c.Get("uid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: UID not found"})
+		return
+	}
+	riderUID := uid.(string)
+
+	// 1. อ่านรัศมีที่ต้องการค้นหา
+	radiusKm := defaultPendingRadiusKm
+	if raw := c.Query("radiusKm"); raw != "" {
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil || parsed <= 0 || parsed > maxPendingRadiusKm {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "radiusKm must be a number between 0 and 50"})
+			return
 		}
+		radiusKm = parsed
+	}
+
+	// 2. ดึงตำแหน่งล่าสุดของไรเดอร์ (ส่งมาผ่าน POST /api/rider/location)
+	// ไรเดอร์ที่ยังไม่ผ่านการตรวจสอบเอกสารดูงานไม่ได้
+	rider, ok := h.requireVerifiedRider(c, riderUID)
+	if !ok {
+		return
+	}
+	if rider.CurrentLocation == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Rider location is unknown, please update your location first"})
+		return
+	}
+	riderLat, riderLng := rider.CurrentLocation.Latitude, rider.CurrentLocation.Longitude
+
+	// 3. ค้นหางาน "pending" ตามช่วง geohash ที่ครอบคลุมรัศมี แล้วกรองด้วยระยะทางจริงอีกครั้ง
+	// (งานที่สร้างก่อนมี senderGeohash จะไม่ถูกพบ จนกว่าจะรัน cmd/backfill-sender-geohash)
+	var deliveries []model.Delivery
+	for _, r := range geo.QueryRanges(riderLat, riderLng, radiusKm) {
+		candidates, err := h.Deliveries.ListDeliveries(ctx, store.DeliveryFilter{
+			Statuses:           []string{lifecycle.StatusPending},
+			SenderGeohashStart: r.Start,
+			SenderGeohashEnd:   r.End,
+		})
 		if err != nil {
 			log.Printf("Failed to iterate pending deliveries: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get pending deliveries"})
 			return
 		}
 
-		var delivery model.Delivery
-		if err := doc.DataTo(&delivery); err != nil {
-			log.Printf("Failed to convert delivery data: %v", err)
-			continue // ข้ามเอกสารที่มีปัญหาไป
-		}
-		delivery.ID = doc.Ref.ID
-
-		// 3. ดึงข้อมูลโปรไฟล์ของผู้ส่งและผู้รับ (Enrichment - โค้ดส่วนนี้ยังคงมีประโยชน์)
-		// เพื่อให้ Rider เห็นว่าใครเป็นผู้ส่งและผู้รับ
-		senderProfile, _ := h.FirestoreClient.Collection("users").Doc(delivery.SenderUID).Get(ctx)
-		if senderProfile != nil {
-			senderData := senderProfile.Data()
-			if name, ok := senderData["name"].(string); ok {
-				delivery.SenderName = name
-			}
-			if img, ok := senderData["image_profile"].(string); ok {
-				delivery.SenderImageProfile = img
+		for _, delivery := range candidates {
+			pickup := delivery.SenderAddress.Coordinates
+			dropoff := delivery.ReceiverAddress.Coordinates
+			distanceToPickup := geo.DistanceKm(riderLat, riderLng, pickup.Latitude, pickup.Longitude)
+			if distanceToPickup > radiusKm {
+				continue // อยู่ในช่อง geohash เดียวกันแต่ไกลเกินรัศมี
 			}
+			pickupToDropoff := geo.DistanceKm(pickup.Latitude, pickup.Longitude, dropoff.Latitude, dropoff.Longitude)
+			delivery.DistanceToPickupKm = &distanceToPickup
+			delivery.PickupToDropoffKm = &pickupToDropoff
+			deliveries = append(deliveries, delivery)
 		}
+	}
 
-		receiverProfile, _ := h.FirestoreClient.Collection("users").Doc(delivery.ReceiverUID).Get(ctx)
-		if receiverProfile != nil {
-			receiverData := receiverProfile.Data()
-			if name, ok := receiverData["name"].(string); ok {
-				delivery.ReceiverName = name
-			}
-			if img, ok := receiverData["image_profile"].(string); ok {
-				delivery.ReceiverImageProfile = img
-			}
-		}
+	// 4. เรียงจากจุดรับสินค้าที่ใกล้ที่สุดก่อน
+	sort.Slice(deliveries, func(i, j int) bool {
+		return *deliveries[i].DistanceToPickupKm < *deliveries[j].DistanceToPickupKm
+	})
 
-		deliveries = append(deliveries, delivery)
+	// 5. ดึงข้อมูลโปรไฟล์ของผู้ส่งและผู้รับ (Enrichment)
+	// เพื่อให้ Rider เห็นว่าใครเป็นผู้ส่งและผู้รับ
+	for i := range deliveries {
+		h.enrichDelivery(ctx, &deliveries[i])
 	}
 
-	// 4. ส่งข้อมูลทั้งหมดกลับไป
+	// 6. ส่งข้อมูลทั้งหมดกลับไป
 	c.JSON(http.StatusOK, gin.H{
 		"pendingDeliveries": deliveries,
+		"radiusKm":          radiusKm,
 	})
 }
 
@@ -233,60 +249,26 @@ func (h *AuthHandler) AcceptDelivery(c *gin.Context) {
 		return
 	}
 
-	// 2. อัปเดตข้อมูลใน Firestore โดยใช้ Transaction เพื่อความปลอดภัย
-	deliveryRef := h.FirestoreClient.Collection("deliveries").Doc(deliveryId)
-
-	err := h.FirestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
-		doc, err := tx.Get(deliveryRef) // อ่านข้อมูลล่าสุดภายใน Transaction
-		if err != nil {
-			return err
-		}
-
-		var delivery model.Delivery
-		if err := doc.DataTo(&delivery); err != nil {
-			return err
-		}
-
-		// 3. **ตรวจสอบเงื่อนไขสำคัญ:** งานนี้ต้องมีสถานะเป็น "pending" เท่านั้น
-		if delivery.Status != "pending" {
-			return errors.New("delivery is not pending, it may have already been accepted")
-		}
-
-		// +++ 4. เพิ่มการตรวจสอบ RiderUID ต้องเป็น nil เท่านั้น +++
-		// เนื่องจาก model ของเรา RiderUID เป็น *string (pointer) มันจึงสามารถเป็น nil ได้
-		// ถ้า riderUID มีค่าอยู่แล้ว (แม้ status จะเป็น pending) แสดงว่ามีบางอย่างผิดปกติ
-		// หรือเป็นงานที่เคยมีคนรับไปแล้ว เราจะไม่อนุญาตให้รับงานนี้ซ้ำซ้อน
-		if delivery.RiderUID != nil {
-			return errors.New("delivery has already been assigned, cannot be accepted again")
-		}
+	// ไรเดอร์ที่ยังไม่ผ่านการตรวจสอบเอกสารรับงานไม่ได้
+	if _, ok := h.requireVerifiedRider(c, riderUIDStr); !ok {
+		return
+	}
 
-		// 5. ถ้าเงื่อนไขทั้งหมดถูกต้อง, ทำการอัปเดตข้อมูล
-		return tx.Update(deliveryRef, []firestore.Update{
-			{Path: "status", Value: "accepted"},   // เปลี่ยน status เป็น "accepted"
-			{Path: "riderUID", Value: riderUIDStr}, // อัปเดต riderUID ของคนที่รับงาน
-		})
+	// 2. อัปเดตข้อมูลโดยใช้ Transaction เพื่อความปลอดภัย (store อ่านข้อมูลล่าสุดภายใน Transaction ให้)
+	// 3. ให้ state machine ตรวจสอบเงื่อนไข (ต้องเป็น "pending" และยังไม่มี riderUID)
+	//    แล้วเปลี่ยน status เป็น "accepted" พร้อมบันทึก riderUID ของคนที่รับงาน
+	_, err := h.applyTransition(ctx, deliveryId, lifecycle.EventAccept, lifecycle.Input{
+		Actor: lifecycle.Actor{UID: riderUIDStr, Role: lifecycle.RoleRider},
 	})
 
-	// 6. ตรวจสอบผลลัพธ์ของ Transaction
+	// 4. ตรวจสอบผลลัพธ์ของ Transaction
 	if err != nil {
-		// ตรวจสอบว่าเป็น error ที่เราสร้างขึ้นเองหรือไม่
-		if err.Error() == "delivery is not pending, it may have already been accepted" {
-			log.Printf("Rider %s failed to accept delivery %s: %v", riderUIDStr, deliveryId, err)
-			c.JSON(http.StatusConflict, gin.H{"error": err.Error()}) // 409 Conflict เหมาะสมกับสถานการณ์นี้
-		
-		// +++ 7. เพิ่มการจัดการสำหรับ Error ใหม่ที่เราสร้างขึ้น +++
-		} else if err.Error() == "delivery has already been assigned, cannot be accepted again" {
-			log.Printf("Rider %s failed to accept delivery %s: %v", riderUIDStr, deliveryId, err)
-			c.JSON(http.StatusConflict, gin.H{"error": err.Error()}) // 409 Conflict เช่นกัน
-
-		} else {
-			log.Printf("Transaction failed for accepting delivery %s: %v", deliveryId, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept delivery"})
-		}
+		log.Printf("Rider %s failed to accept delivery %s: %v", riderUIDStr, deliveryId, err)
+		respondTransitionError(c, err, "Failed to accept delivery")
 		return
 	}
 
-	// 8. หากสำเร็จ ส่งข้อความกลับไป
+	// 5. หากสำเร็จ ส่งข้อความกลับไป
 	log.Printf("Rider %s successfully accepted delivery %s", riderUIDStr, deliveryId)
 	c.JSON(http.StatusOK, gin.H{
 		"message":    "Delivery accepted successfully",
@@ -311,20 +293,10 @@ func (h *AuthHandler) UpdateRiderLocation(c *gin.Context) {
 		return
 	}
 
-	// 3. เตรียมข้อมูลที่จะอัปเดตใน Firestore
-	// เราจะใช้ GeoPoint ซึ่งเป็นชนิดข้อมูลสำหรับพิกัดของ Firestore โดยเฉพาะ
-	locationData := &latlng.LatLng{
-		Latitude:  request.Latitude,
-		Longitude: request.Longitude,
-	}
-
-	// 4. อัปเดตข้อมูลใน collection "riders"
+	// 3. อัปเดตข้อมูลใน collection "riders"
 	// โดยใช้ riderUID (เบอร์โทร) เป็น ID ของ document
-	// ใช้ Set กับ MergeAll เพื่อสร้าง document ถ้ายังไม่มี หรืออัปเดต field ถ้ามีอยู่แล้ว
-	_, err := h.FirestoreClient.Collection("riders").Doc(riderUID).Set(context.Background(), map[string]interface{}{
-		"currentLocation": locationData,
-		"updatedAt":       firestore.ServerTimestamp, // บันทึกเวลาที่อัปเดตล่าสุด
-	}, firestore.MergeAll)
+	// store จะสร้าง document ถ้ายังไม่มี หรืออัปเดต field ถ้ามีอยู่แล้ว พร้อมบันทึกเวลาที่อัปเดตล่าสุด
+	err := h.Riders.UpdateRiderLocation(context.Background(), riderUID, request.Latitude, request.Longitude)
 
 	if err != nil {
 		log.Printf("Failed to update rider location for %s: %v", riderUID, err)
@@ -332,11 +304,34 @@ func (h *AuthHandler) UpdateRiderLocation(c *gin.Context) {
 		return
 	}
 
-	// 5. ส่งสถานะสำเร็จกลับไป
+	// กระจายตำแหน่งใหม่ไปยังผู้ที่กำลังติดตามไรเดอร์คนนี้อยู่ (ดู StreamDelivery)
+	h.Events.Publish(events.RiderTopic(riderUID), events.Event{
+		Type:     events.TypeLocation,
+		RiderUID: riderUID,
+		Location: &model.Coordinates{Latitude: request.Latitude, Longitude: request.Longitude},
+	})
+
+	// 4. ส่งสถานะสำเร็จกลับไป
 	c.JSON(http.StatusOK, gin.H{"message": "Location updated successfully"})
 }
 
 
+// riderPosition เลือกตำแหน่งที่ใช้ตรวจสอบ geofence
+// ใช้พิกัดที่ส่งมากับ request ก่อน ถ้าไม่มีจะใช้ currentLocation ล่าสุดของไรเดอร์
+func (h *AuthHandler) riderPosition(ctx context.Context, riderUID string, reported *model.Coordinates) (*model.Coordinates, string) {
+	if reported != nil {
+		return reported, lifecycle.PositionFromRequest
+	}
+	rider, err := h.Riders.GetRider(ctx, riderUID)
+	if err != nil || rider.CurrentLocation == nil {
+		return nil, lifecycle.PositionUnknown
+	}
+	return &model.Coordinates{
+		Latitude:  rider.CurrentLocation.Latitude,
+		Longitude: rider.CurrentLocation.Longitude,
+	}, lifecycle.PositionFromRider
+}
+
 // +++ ฟังก์ชันใหม่: ยืนยันการรับสินค้า +++
 func (h *AuthHandler) ConfirmPickup(c *gin.Context) {
     ctx := context.Background()
@@ -359,54 +354,35 @@ func (h *AuthHandler) ConfirmPickup(c *gin.Context) {
 
     // 3. รับข้อมูล JSON payload ที่มี URL รูปภาพ
     var payload struct {
-        PickupImageURL string `json:"pickupImageURL" binding:"required,url"`
+        PickupImageURL string             `json:"pickupImageURL" binding:"required,url"`
+        Location       *model.Coordinates `json:"location"` // ถ้าไม่ส่งมา จะใช้ currentLocation ล่าสุดของไรเดอร์
     }
     if err := c.ShouldBindJSON(&payload); err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
         return
     }
 
-    // 4. อัปเดตข้อมูลใน Firestore
-    deliveryRef := h.FirestoreClient.Collection("deliveries").Doc(deliveryId)
-
+    // 4. อัปเดตข้อมูล
     // ใช้ Transaction เพื่อความปลอดภัยในการตรวจสอบข้อมูลก่อนอัปเดต
-    err := h.FirestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
-        doc, err := tx.Get(deliveryRef)
-        if err != nil {
-            return err
-        }
-
-        var delivery model.Delivery
-        if err := doc.DataTo(&delivery); err != nil {
-            return err
-        }
-
-        // ตรวจสอบเงื่อนไข:
-        // - สถานะต้องเป็น "accepted" เท่านั้น
-        // - RiderUID ที่อยู่ในเอกสารต้องตรงกับ Rider ที่ส่ง request มา
-        if delivery.Status != "accepted" {
-            return errors.New("delivery status is not 'accepted'")
-        }
-        if delivery.RiderUID == nil || *delivery.RiderUID != riderUID {
-            return errors.New("you are not the assigned rider for this delivery")
-        }
-
-        // 5. ถ้าเงื่อนไขถูกต้อง, ทำการอัปเดต
-        return tx.Update(deliveryRef, []firestore.Update{
-            {Path: "status", Value: "picked_up"}, // <-- เปลี่ยนสถานะเป็น "picked_up"
-            {Path: "pickupImage", Value: payload.PickupImageURL}, // <-- เพิ่ม field ใหม่สำหรับเก็บรูป
-        })
+    // state machine ตรวจสอบเงื่อนไข:
+    // - สถานะต้องเป็น "accepted" เท่านั้น
+    // - RiderUID ที่อยู่ในเอกสารต้องตรงกับ Rider ที่ส่ง request มา
+    // - ไรเดอร์ต้องอยู่ในรัศมีของที่อยู่ผู้ส่ง (ตาม h.Geofence)
+    // แล้วเปลี่ยนสถานะเป็น "picked_up" พร้อมเก็บรูปและระยะทางที่วัดได้
+    position, source := h.riderPosition(ctx, riderUID, payload.Location)
+    _, err := h.applyTransition(ctx, deliveryId, lifecycle.EventPickup, lifecycle.Input{
+        Actor:          lifecycle.Actor{UID: riderUID, Role: lifecycle.RoleRider},
+        PickupImage:    payload.PickupImageURL,
+        Position:       position,
+        PositionSource: source,
+        Fence:          h.Geofence,
     })
 
 
     if err != nil {
         log.Printf("Failed to confirm pickup for delivery %s by rider %s: %v", deliveryId, riderUID, err)
         // ส่ง HTTP Status ที่เหมาะสมกลับไป
-        if strings.Contains(err.Error(), "not the assigned rider") || strings.Contains(err.Error(), "not 'accepted'"){
-             c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
-        } else {
-             c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update delivery status"})
-        }
+        respondTransitionError(c, err, "Failed to update delivery status")
         return
     }
 
@@ -435,48 +411,53 @@ func (h *AuthHandler) ConfirmDelivery(c *gin.Context) {
 	}
 	riderUID := uid.(string)
 
-	// รับ URL ของรูปภาพที่ถ่ายตอนส่งของ
+	// รับ URL ของรูปภาพที่ถ่ายตอนส่งของ และ PIN ที่ได้จากผู้รับ
 	var payload struct {
 		DeliveredImageURL string `json:"deliveredImageURL" binding:"required,url"`
+		DeliveryPIN       string             `json:"deliveryPin"`
+		Location          *model.Coordinates `json:"location"` // ถ้าไม่ส่งมา จะใช้ currentLocation ล่าสุดของไรเดอร์
 	}
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
 		return
 	}
 
-	deliveryRef := h.FirestoreClient.Collection("deliveries").Doc(deliveryId)
-
-	err := h.FirestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
-		doc, err := tx.Get(deliveryRef)
-		if err != nil {
-			return err
-		}
-
-		var delivery model.Delivery
-		if err := doc.DataTo(&delivery); err != nil {
-			return err
-		}
+	// state machine ตรวจสอบเงื่อนไข:
+	// - สถานะต้องเป็น "picked_up"
+	// - RiderUID ต้องตรงกัน
+	// - ไรเดอร์ต้องอยู่ในรัศมีของที่อยู่ผู้รับ (ตาม h.Geofence)
+	// - PIN ต้องตรงกับที่ผู้รับได้รับ (และยังไม่ถูกล็อก)
+	// แล้วเปลี่ยนสถานะเป็น "delivered" พร้อมเก็บรูปตอนส่งและระยะทางที่วัดได้
+	position, source := h.riderPosition(ctx, riderUID, payload.Location)
+	delivery, err := h.applyTransition(ctx, deliveryId, lifecycle.EventDeliver, lifecycle.Input{
+		Actor:          lifecycle.Actor{UID: riderUID, Role: lifecycle.RoleRider},
+		DeliveredImage: payload.DeliveredImageURL,
+		DeliveryPIN:    payload.DeliveryPIN,
+		Position:       position,
+		PositionSource: source,
+		Fence:          h.Geofence,
+	})
 
-		// ตรวจสอบเงื่อนไข:
-		// - สถานะต้องเป็น "picked_up"
-		// - RiderUID ต้องตรงกัน
-		if delivery.Status != "picked_up" {
-			return errors.New("delivery status is not 'picked_up'")
-		}
-		if delivery.RiderUID == nil || *delivery.RiderUID != riderUID {
-			return errors.New("you are not the assigned rider for this delivery")
+	if errors.Is(err, lifecycle.ErrInvalidPIN) {
+		if delivery.PINLocked {
+			// ใส่ผิดครบจำนวนครั้งแล้ว แจ้งผู้รับให้ขอ PIN ใหม่
+			h.notify(ctx, delivery.ReceiverUID, model.Notification{
+				Type:       "delivery_pin_locked",
+				DeliveryID: deliveryId,
+				Message:    "PIN ยืนยันการรับของถูกล็อกเนื่องจากใส่ผิดหลายครั้ง กรุณาขอ PIN ใหม่",
+			})
+			respondTransitionError(c, lifecycle.ErrPINLocked, "Failed to update delivery status")
+			return
 		}
-
-		// ทำการอัปเดต
-		return tx.Update(deliveryRef, []firestore.Update{
-			{Path: "status", Value: "delivered"}, // <-- เปลี่ยนสถานะเป็น "delivered"
-			{Path: "deliveredImage", Value: payload.DeliveredImageURL}, // <-- เพิ่ม field ใหม่สำหรับรูปตอนส่ง
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":             err.Error(),
+			"attemptsRemaining": lifecycle.MaxPINAttempts - delivery.PINAttempts,
 		})
-	})
-
+		return
+	}
 	if err != nil {
 		log.Printf("Failed to confirm delivery for %s: %v", deliveryId, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update delivery status"})
+		respondTransitionError(c, err, "Failed to update delivery status")
 		return
 	}
 
@@ -500,64 +481,101 @@ func (h *AuthHandler) GetCurrentDelivery(c *gin.Context) {
 	}
 	riderUID := uid.(string)
 
-	var activeDelivery model.Delivery
-
-	// 2. สร้าง Query เพื่อค้นหางานที่ Active อยู่
+	// 2. ค้นหางานที่ Active อยู่
 	// เราจะค้นหางานที่ riderUID ตรงกัน และ status เป็น 'accepted' หรือ 'picked_up'
-	// ใช้ Limit(1) เพราะไรเดอร์ควรจะมีงานที่ทำค้างอยู่ได้แค่งานเดียว
-	query := h.FirestoreClient.Collection("deliveries").
-		Where("riderUID", "==", riderUID).
-		Where("status", "in", []string{"accepted", "picked_up"}).
-		Limit(1)
-
-	iter := query.Documents(ctx)
-	doc, err := iter.Next()
+	// ใช้ Limit 1 เพราะไรเดอร์ควรจะมีงานที่ทำค้างอยู่ได้แค่งานเดียว
+	deliveries, err := h.Deliveries.ListDeliveries(ctx, store.DeliveryFilter{
+		RiderUID: riderUID,
+		Statuses: []string{lifecycle.StatusAccepted, lifecycle.StatusPickedUp},
+		Limit:    1,
+	})
 
 	// 3. ตรวจสอบผลลัพธ์
-	if err == iterator.Done {
-		// iterator.Done หมายถึง วนลูปจนสุดแล้ว แต่ไม่เจอข้อมูลเลย
+	if err != nil {
+		log.Printf("Failed to query for active delivery for rider %s: %v", riderUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get active delivery"})
+		return
+	}
+	if len(deliveries) == 0 {
+		// ไม่เจอข้อมูลเลย
 		log.Printf("No active delivery found for rider %s", riderUID)
 		c.Status(http.StatusNoContent) // 204 No Content: สำเร็จแต่ไม่มีข้อมูลจะส่งกลับ
 		return
 	}
-	if err != nil {
-		log.Printf("Failed to query for active delivery for rider %s: %v", riderUID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get active delivery"})
+
+	// 4. ถ้าเจอข้อมูล, ดึงข้อมูลเพิ่มเติมเหมือนตอนดึง Pending
+	// เพื่อให้ข้อมูลที่ส่งกลับไปครบถ้วนสมบูรณ์
+	activeDelivery := deliveries[0]
+	h.enrichDelivery(ctx, &activeDelivery)
+
+	// 5. ส่งข้อมูลของงานที่ค้างอยู่กลับไป
+	c.JSON(http.StatusOK, activeDelivery)
+}
+
+// releaseFlagThreshold คือจำนวนครั้งที่คืนงานแล้วถือว่าควรตรวจสอบพฤติกรรมของไรเดอร์
+const releaseFlagThreshold = 3
+
+// ReleaseDeliveryRequest คือข้อมูลที่ไรเดอร์ต้องส่งมาตอนคืนงาน
+type ReleaseDeliveryRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// ReleaseDelivery ให้ไรเดอร์คืนงานที่รับไว้แล้ว (ก่อนรับสินค้า)
+// งานจะกลับไปเป็น "pending" และ riderUID ถูกล้างออก เพื่อให้ไรเดอร์คนอื่นรับต่อได้
+func (h *AuthHandler) ReleaseDelivery(c *gin.Context) {
+	ctx := context.Background()
+
+	// 1. ดึง deliveryId จาก URL และ riderUID จาก Token
+	deliveryId := c.Param("deliveryId")
+	if deliveryId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Delivery ID is required"})
+		return
+	}
+	uid, exists := c.Get("uid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: UID not found"})
 		return
 	}
+	riderUID := uid.(string)
 
-	// 4. ถ้าเจอข้อมูล, แปลงข้อมูลและส่งกลับ
-	if err := doc.DataTo(&activeDelivery); err != nil {
-		log.Printf("Failed to convert active delivery data: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process delivery data"})
+	// 2. รับเหตุผลที่คืนงาน (บังคับ)
+	var req ReleaseDeliveryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
 		return
 	}
-	activeDelivery.ID = doc.Ref.ID
 
-	// 5. (Optional but Recommended) ดึงข้อมูลเพิ่มเติมเหมือนตอนดึง Pending
-	// เพื่อให้ข้อมูลที่ส่งกลับไปครบถ้วนสมบูรณ์
-	senderProfile, _ := h.FirestoreClient.Collection("users").Doc(activeDelivery.SenderUID).Get(ctx)
-	if senderProfile != nil {
-		senderData := senderProfile.Data()
-		if name, ok := senderData["name"].(string); ok {
-			activeDelivery.SenderName = name
-		}
-		if img, ok := senderData["image_profile"].(string); ok {
-			activeDelivery.SenderImageProfile = img
-		}
+	// 3. คืนงานภายใน Transaction: status -> "pending", riderUID -> nil พร้อมบันทึกเหตุผลลง statusHistory
+	// และนับจำนวนครั้งที่ไรเดอร์คืนงาน (ถ้าถึง releaseFlagThreshold จะถูกทำเครื่องหมายให้แอดมินตรวจสอบ)
+	released, err := h.applyTransition(ctx, deliveryId, lifecycle.EventRelease, lifecycle.Input{
+		Actor:  lifecycle.Actor{UID: riderUID, Role: lifecycle.RoleRider},
+		Reason: req.Reason,
+	})
+	if err != nil {
+		log.Printf("Rider %s failed to release delivery %s: %v", riderUID, deliveryId, err)
+		respondTransitionError(c, err, "Failed to release delivery")
+		return
 	}
 
-	receiverProfile, _ := h.FirestoreClient.Collection("users").Doc(activeDelivery.ReceiverUID).Get(ctx)
-	if receiverProfile != nil {
-		receiverData := receiverProfile.Data()
-		if name, ok := receiverData["name"].(string); ok {
-			activeDelivery.ReceiverName = name
-		}
-		if img, ok := receiverData["image_profile"].(string); ok {
-			activeDelivery.ReceiverImageProfile = img
-		}
+	// 4. อ่านจำนวนครั้งที่คืนงานล่าสุดเพื่อตอบกลับ (งานถูกคืนไปแล้ว ถ้าอ่านไม่สำเร็จจึงแค่ log ไว้)
+	releaseCount := 0
+	if rider, err := h.Riders.GetRider(ctx, riderUID); err != nil {
+		log.Printf("Failed to get rider %s after release: %v", riderUID, err)
+	} else {
+		releaseCount = rider.ReleaseCount
 	}
 
-	// 6. ส่งข้อมูลของงานที่ค้างอยู่กลับไป
-	c.JSON(http.StatusOK, activeDelivery)
+	// 5. แจ้งผู้ส่งว่างานกลับไปรอไรเดอร์คนใหม่
+	h.notify(ctx, released.SenderUID, model.Notification{
+		Type:       "delivery_released",
+		DeliveryID: deliveryId,
+		Message:    "ไรเดอร์ได้คืนงานของคุณ กำลังหาไรเดอร์คนใหม่",
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Delivery released successfully",
+		"deliveryId":   deliveryId,
+		"newStatus":    lifecycle.StatusPending,
+		"releaseCount": releaseCount,
+	})
 }
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"api-flash-dash/events"
+	"api-flash-dash/lifecycle"
+	"api-flash-dash/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestRider สร้างไรเดอร์ที่ผ่านการตรวจสอบแล้ว
+func newTestRider(t *testing.T, h *AuthHandler, uid string) {
+	t.Helper()
+	ctx := context.Background()
+	if err := h.Users.CreateUser(ctx, uid, model.UserProfile{Phone: uid, Role: model.RoleRider}); err != nil {
+		t.Fatal(err)
+	}
+	rider := model.Rider{
+		ImageVehicle:        "https://example.com/bike.jpg",
+		VehicleRegistration: "1กข 1234",
+		VerificationStatus:  model.RiderApproved,
+	}
+	if err := h.Riders.CreateRider(ctx, uid, rider); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdateRiderProfileVehicleChangeNeedsReview(t *testing.T) {
+	const uid = "+66888888888"
+	tests := []struct {
+		name       string
+		body       gin.H
+		wantStatus string
+		wantFeed   int
+	}{
+		{name: "new registration", body: gin.H{"vehicle_registration": "2ขค 5678"}, wantStatus: model.RiderPendingVerification, wantFeed: http.StatusForbidden},
+		{name: "new vehicle image", body: gin.H{"image_vehicle": "https://example.com/car.jpg"}, wantStatus: model.RiderPendingVerification, wantFeed: http.StatusForbidden},
+		// ส่งค่าเดิมมา ไม่ถือว่าเปลี่ยนรถ (ยังรับงานได้ แต่ไม่มีตำแหน่งจึงได้ 409)
+		{name: "same vehicle", body: gin.H{"vehicle_registration": "1กข 1234"}, wantStatus: model.RiderApproved, wantFeed: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandler()
+			newTestRider(t, h, uid)
+			router := gin.New()
+			router.Use(withUID)
+			router.PUT("/rider/profile", h.UpdateRiderProfile)
+			router.GET("/rider/deliveries/pending", h.GetPendingDeliveries)
+
+			code, body := do(t, router, http.MethodPut, "/rider/profile", uid, tt.body)
+			if code != http.StatusOK {
+				t.Fatalf("status = %d, want %d (%v)", code, http.StatusOK, body)
+			}
+			if got := body["roleSpecificData"].(map[string]interface{})["verificationStatus"]; got != tt.wantStatus {
+				t.Errorf("verificationStatus = %v, want %s", got, tt.wantStatus)
+			}
+			if _, ok := body["rating"].(map[string]interface{}); !ok {
+				t.Errorf("rating = %v, want the rider's rating summary", body["rating"])
+			}
+			if code, body := do(t, router, http.MethodGet, "/rider/deliveries/pending", uid, nil); code != tt.wantFeed {
+				t.Errorf("pending feed status = %d, want %d (%v)", code, tt.wantFeed, body)
+			}
+		})
+	}
+}
+
+func TestReleaseDeliveryFlagsRider(t *testing.T) {
+	const riderUID = "+66888888888"
+	ctx := context.Background()
+	h, _ := newTestHandler()
+	h.Events = events.NewBus()
+	newTestRider(t, h, riderUID)
+	router := gin.New()
+	router.Use(withUID)
+	router.POST("/rider/deliveries/:deliveryId/release", h.ReleaseDelivery)
+	router.GET("/admin/riders/:riderId", h.GetRiderDocumentsForAdmin)
+
+	for i := 1; i <= releaseFlagThreshold; i++ {
+		rider := riderUID
+		deliveryID, err := h.Deliveries.CreateDelivery(ctx, model.Delivery{
+			SenderUID:   "+66811111111",
+			ReceiverUID: "+66822222222",
+			Status:      lifecycle.StatusAccepted,
+			RiderUID:    &rider,
+		}, model.StatusChange{To: lifecycle.StatusAccepted, At: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, body := do(t, router, http.MethodPost, "/rider/deliveries/"+deliveryID+"/release", riderUID, gin.H{"reason": "รถเสีย"})
+		if code != http.StatusOK {
+			t.Fatalf("release %d: status = %d, want %d (%v)", i, code, http.StatusOK, body)
+		}
+		if body["releaseCount"] != float64(i) {
+			t.Errorf("release %d: releaseCount = %v, want %d", i, body["releaseCount"], i)
+		}
+
+		// แอดมินเห็นเครื่องหมายให้ตรวจสอบเมื่อคืนงานครบ releaseFlagThreshold ครั้งเท่านั้น
+		code, body = do(t, router, http.MethodGet, "/admin/riders/"+riderUID, "admin", nil)
+		if code != http.StatusOK {
+			t.Fatalf("admin rider: status = %d, want %d (%v)", code, http.StatusOK, body)
+		}
+		_, flagged := body["rider"].(map[string]interface{})["releaseFlaggedAt"]
+		if want := i >= releaseFlagThreshold; flagged != want {
+			t.Errorf("after %d releases: flagged = %v, want %v", i, flagged, want)
+		}
+	}
+}
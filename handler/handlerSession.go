@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"api-flash-dash/identity"
+
+	"github.com/gin-gonic/gin"
+)
+
+// syntheticEmail คืออีเมลที่ใช้แทนเบอร์โทรใน Firebase Auth (ผู้ใช้ไม่เคยเห็นอีเมลนี้)
+func syntheticEmail(phoneE164 string) string {
+	return phoneE164 + "@flashdash.app"
+}
+
+// LogoutHandler ออกจากระบบทุกอุปกรณ์ โดยเพิกถอน refresh token ทั้งหมดของผู้ใช้
+// idToken ที่ออกไปแล้วจะใช้ต่อไม่ได้เฉพาะเมื่อเปิด AUTH_CHECK_REVOKED (ดู middleware.AuthMiddleware)
+// Endpoint: POST /api/logout
+func (h *AuthHandler) LogoutHandler(c *gin.Context) {
+	uid := c.GetString("uid")
+	if err := h.AuthClient.RevokeRefreshTokens(c.Request.Context(), uid); err != nil {
+		log.Printf("Error revoking refresh tokens for %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out from all devices"})
+}
+
+// revokeSessions เพิกถอนทุก session หลังเปลี่ยนรหัสผ่าน แล้วล็อกอินใหม่ด้วยรหัสผ่านใหม่
+// เพื่อให้อุปกรณ์ที่เปลี่ยนรหัสผ่านใช้งานต่อได้ (อุปกรณ์อื่นต้องล็อกอินใหม่)
+// ถ้าล็อกอินใหม่ไม่สำเร็จจะคืนค่า Token เป็น nil และแอปต้องพาผู้ใช้ไปล็อกอินเอง
+func (h *AuthHandler) revokeSessions(ctx context.Context, uid, newPassword string) (*identity.Token, error) {
+	if err := h.AuthClient.RevokeRefreshTokens(ctx, uid); err != nil {
+		return nil, err
+	}
+	token, err := h.Identity.SignInWithPassword(ctx, syntheticEmail(uid), newPassword)
+	if err != nil {
+		log.Printf("Sessions of %s were revoked but signing in again failed: %v", uid, err)
+		return nil, nil
+	}
+	return token, nil
+}
+
+// sessionResponse เติมข้อมูล Token ลงใน response ของการอัปเดตโปรไฟล์
+// ถ้าเปลี่ยนรหัสผ่าน (revoked) จะส่ง Token ใหม่จาก revokeSessions แทน Token เดิมจาก Header
+func sessionResponse(c *gin.Context, response gin.H, revoked bool, session *identity.Token) gin.H {
+	if !revoked {
+		// ดึง ID Token เดิมจาก Header เพื่อส่งกลับไปให้แอปใช้ต่อ
+		response["idToken"] = strings.Replace(c.GetHeader("Authorization"), "Bearer ", "", 1)
+		return response
+	}
+	response["sessionsRevoked"] = true
+	if session != nil {
+		response["idToken"] = session.IDToken
+		response["refreshToken"] = session.RefreshToken
+		response["expiresIn"] = session.ExpiresIn
+	}
+	return response
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"api-flash-dash/events"
+	"api-flash-dash/lifecycle"
+	"api-flash-dash/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamHeartbeat คือช่วงเวลาที่ส่ง ping เพื่อไม่ให้ proxy ตัดการเชื่อมต่อที่เงียบนานเกินไป
+const streamHeartbeat = 15 * time.Second
+
+// StreamDelivery ส่งข้อมูลแบบ Server-Sent Events ให้ผู้ส่ง ผู้รับ และไรเดอร์ของ delivery นี้
+//   - event "status":   เมื่อสถานะของ delivery เปลี่ยน (ส่งสถานะปัจจุบันให้ทันทีที่เชื่อมต่อ)
+//   - event "location": เมื่อไรเดอร์ที่รับงานอยู่ส่งตำแหน่งใหม่มา
+//   - event "ping":     ทุกๆ 15 วินาที
+//
+// stream จะปิดเองเมื่อ delivery ถึงสถานะสุดท้าย ("delivered" หรือ "cancelled")
+// หรือเมื่อผู้ใช้ไม่ได้เป็นคู่กรณีของ delivery แล้ว (เช่น ไรเดอร์ที่คืนงานไป)
+func (h *AuthHandler) StreamDelivery(c *gin.Context) {
+	// 1. ดึง deliveryId จาก URL และ UID จาก Token
+	deliveryId := c.Param("deliveryId")
+	if deliveryId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Delivery ID is required"})
+		return
+	}
+	uid, exists := c.Get("uid")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: UID not found"})
+		return
+	}
+
+	// 2. เริ่มติดตามก่อนอ่านสถานะปัจจุบัน เพื่อไม่ให้พลาด Event ที่เกิดขึ้นระหว่างนั้น
+	deliveryEvents, unsubscribeDelivery := h.Events.Subscribe(events.DeliveryTopic(deliveryId))
+	defer unsubscribeDelivery()
+
+	// 3. ดึง delivery และตรวจสอบสิทธิ์
+	delivery, err := h.Deliveries.GetDelivery(context.Background(), deliveryId)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get delivery %s: %v", deliveryId, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get delivery"})
+		return
+	}
+	if deliveryParty(delivery, uid.(string)) == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to view this delivery"})
+		return
+	}
+
+	// 4. ติดตามตำแหน่งของไรเดอร์ที่รับงานอยู่ (เปลี่ยนตามเมื่อมีการรับงาน/คืนงาน)
+	var riderEvents <-chan events.Event
+	unsubscribeRider := func() {}
+	defer func() { unsubscribeRider() }()
+	currentRider := ""
+	followRider := func(riderUID string) {
+		if riderUID == currentRider {
+			return
+		}
+		unsubscribeRider()
+		riderEvents, unsubscribeRider = nil, func() {}
+		currentRider = riderUID
+		if riderUID != "" {
+			riderEvents, unsubscribeRider = h.Events.Subscribe(events.RiderTopic(riderUID))
+		}
+	}
+
+	// 5. ตั้งค่า Header สำหรับ SSE แล้วส่งสถานะปัจจุบันไปก่อน
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // ปิด buffer ของ nginx
+
+	initial := events.Event{
+		Type:       events.TypeStatus,
+		DeliveryID: deliveryId,
+		Status:     delivery.Status,
+		At:         time.Now(),
+	}
+	if delivery.RiderUID != nil {
+		initial.RiderUID = *delivery.RiderUID
+	}
+	c.SSEvent(events.TypeStatus, initial)
+	c.Writer.Flush()
+	if lifecycle.IsFinal(delivery.Status) {
+		return
+	}
+	followRider(initial.RiderUID)
+
+	// 6. ส่งต่อ Event จนกว่าผู้ใช้จะตัดการเชื่อมต่อ หรือ delivery จบงาน
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+
+		case event, ok := <-deliveryEvents:
+			if !ok {
+				return
+			}
+			// ไรเดอร์อาจเปลี่ยนไปแล้ว (คืนงาน/ถูกเปลี่ยนตัว) ถ้าผู้ใช้ไม่ได้เป็นคู่กรณีอีกต่อไป
+			// ให้ปิด stream ทันที ไม่เช่นนั้นจะเห็นตำแหน่งของไรเดอร์คนถัดไป
+			delivery.RiderUID = nil
+			if event.RiderUID != "" {
+				riderUID := event.RiderUID
+				delivery.RiderUID = &riderUID
+			}
+			if deliveryParty(delivery, uid.(string)) == "" {
+				return
+			}
+			c.SSEvent(events.TypeStatus, event)
+			c.Writer.Flush()
+			if lifecycle.IsFinal(event.Status) {
+				return
+			}
+			followRider(event.RiderUID)
+
+		case event, ok := <-riderEvents:
+			if !ok {
+				riderEvents = nil
+				continue
+			}
+			event.DeliveryID = deliveryId
+			c.SSEvent(events.TypeLocation, event)
+			c.Writer.Flush()
+
+		case now := <-heartbeat.C:
+			c.SSEvent("ping", now.Unix())
+			c.Writer.Flush()
+		}
+	}
+}
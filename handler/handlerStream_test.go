@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"api-flash-dash/events"
+	"api-flash-dash/lifecycle"
+	"api-flash-dash/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readEvent อ่าน Server-Sent Event ถัดไป คืนค่า false เมื่อ stream ถูกปิด
+func readEvent(t *testing.T, r *bufio.Reader) (string, events.Event, bool) {
+	t.Helper()
+	var name string
+	var event events.Event
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			return "", event, false
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if name != "" {
+				return name, event, true
+			}
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimPrefix(line, "event:")
+		case strings.HasPrefix(line, "data:"):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &event); err != nil {
+				t.Fatalf("invalid event data %q: %v", line, err)
+			}
+		}
+	}
+}
+
+func TestStreamDeliveryRiderChange(t *testing.T) {
+	const (
+		senderUID   = "+66811111111"
+		receiverUID = "+66822222222"
+		oldRider    = "+66833333333"
+		newRider    = "+66844444444"
+	)
+	tests := []struct {
+		name       string
+		uid        string
+		wantStatus bool // ยังได้รับ Event สถานะใหม่หลังเปลี่ยนไรเดอร์
+	}{
+		{name: "sender keeps streaming", uid: senderUID, wantStatus: true},
+		// ไรเดอร์คนเดิมไม่ใช่คู่กรณีแล้ว stream ต้องปิด ไม่ให้เห็นไรเดอร์คนใหม่
+		{name: "replaced rider is cut off", uid: oldRider, wantStatus: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandler()
+			h.Events = events.NewBus()
+			rider := oldRider
+			deliveryID, err := h.Deliveries.CreateDelivery(context.Background(), model.Delivery{
+				SenderUID:   senderUID,
+				ReceiverUID: receiverUID,
+				Status:      lifecycle.StatusAccepted,
+				RiderUID:    &rider,
+			}, model.StatusChange{To: lifecycle.StatusAccepted, At: time.Now()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			router := gin.New()
+			router.Use(withUID)
+			router.GET("/deliveries/:deliveryId/stream", h.StreamDelivery)
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/deliveries/"+deliveryID+"/stream", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("X-Test-UID", tt.uid)
+			client := &http.Client{Timeout: 5 * time.Second}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body := bufio.NewReader(resp.Body)
+
+			if name, event, ok := readEvent(t, body); !ok || name != events.TypeStatus || event.RiderUID != oldRider {
+				t.Fatalf("initial event = %q %+v (open=%v), want status with rider %s", name, event, ok, oldRider)
+			}
+
+			// แอดมินเปลี่ยนไรเดอร์ (Subscribe เกิดก่อนส่ง Event แรก จึงไม่พลาด Event นี้)
+			h.Events.Publish(events.DeliveryTopic(deliveryID), events.Event{
+				Type:       events.TypeStatus,
+				DeliveryID: deliveryID,
+				Status:     lifecycle.StatusAccepted,
+				RiderUID:   newRider,
+			})
+
+			name, event, ok := readEvent(t, body)
+			if !tt.wantStatus {
+				if ok {
+					t.Errorf("got %q %+v after rider change, want stream closed", name, event)
+				}
+				return
+			}
+			if !ok || name != events.TypeStatus || event.RiderUID != newRider {
+				t.Errorf("event after rider change = %q %+v (open=%v), want status with rider %s", name, event, ok, newRider)
+			}
+		})
+	}
+}
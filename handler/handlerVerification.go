@@ -0,0 +1,262 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"api-flash-dash/model"
+	"api-flash-dash/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// errDocumentsMissing ถูกส่งกลับเมื่อแอดมินอนุมัติไรเดอร์ที่ยังส่งเอกสารไม่ครบ
+	errDocumentsMissing = errors.New("rider has not uploaded all required documents")
+	// errAlreadyApproved ถูกส่งกลับเมื่อไรเดอร์ผ่านการตรวจสอบไปแล้ว
+	errAlreadyApproved = errors.New("rider is already approved")
+)
+
+// requireVerifiedRider ตรวจสอบว่าไรเดอร์ผ่านการตรวจสอบเอกสารแล้ว และคืนข้อมูลไรเดอร์กลับไปใช้ต่อ
+// ถ้ายังไม่ผ่านจะตอบกลับ error ให้เองและคืนค่า false
+func (h *AuthHandler) requireVerifiedRider(c *gin.Context, riderUID string) (*model.Rider, bool) {
+	rider, err := h.Riders.GetRider(context.Background(), riderUID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("Failed to get rider %s: %v", riderUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get rider data"})
+		return nil, false
+	}
+	if rider == nil || !rider.IsVerified() {
+		status := model.RiderPendingVerification
+		if rider != nil && rider.VerificationStatus != "" {
+			status = rider.VerificationStatus
+		}
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":              "Rider account is not verified yet",
+			"verificationStatus": status,
+		})
+		return nil, false
+	}
+	return rider, true
+}
+
+// GetRiderVerification ดึงสถานะการตรวจสอบและเอกสารของไรเดอร์ที่ล็อกอินอยู่
+func (h *AuthHandler) GetRiderVerification(c *gin.Context) {
+	riderUID := c.GetString("uid")
+	rider, err := h.Riders.GetRider(context.Background(), riderUID)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rider not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get rider %s: %v", riderUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get rider data"})
+		return
+	}
+	c.JSON(http.StatusOK, verificationResponse(rider))
+}
+
+// UploadRiderDocuments บันทึก URL ของใบขับขี่ บัตรประชาชน และเล่มทะเบียนรถ
+// ส่งมาเฉพาะชิ้นที่ต้องการอัปเดตได้ ถ้าเคยถูกปฏิเสธ การส่งเอกสารใหม่จะกลับไปรอตรวจสอบอีกครั้ง
+func (h *AuthHandler) UploadRiderDocuments(c *gin.Context) {
+	riderUID := c.GetString("uid")
+
+	// 1. รับ URL ของเอกสาร
+	var payload model.RiderDocumentsPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if payload.DrivingLicenceURL == nil && payload.IDCardURL == nil && payload.VehicleRegistrationURL == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No documents to upload"})
+		return
+	}
+
+	// 2. อัปเดตเอกสารภายใน Transaction
+	var updated model.Rider
+	err := h.Riders.UpdateRider(context.Background(), riderUID, func(rider *model.Rider) error {
+		if rider.IsVerified() {
+			return errAlreadyApproved
+		}
+		now := time.Now()
+		if payload.DrivingLicenceURL != nil {
+			rider.Documents.DrivingLicence = &model.RiderDocument{URL: *payload.DrivingLicenceURL, UploadedAt: now}
+		}
+		if payload.IDCardURL != nil {
+			rider.Documents.IDCard = &model.RiderDocument{URL: *payload.IDCardURL, UploadedAt: now}
+		}
+		if payload.VehicleRegistrationURL != nil {
+			rider.Documents.VehicleRegistration = &model.RiderDocument{URL: *payload.VehicleRegistrationURL, UploadedAt: now}
+		}
+
+		// เอกสารครบแล้ว: ส่งเข้าคิวให้แอดมินตรวจ (รวมถึงกรณีที่เคยถูกปฏิเสธ)
+		rider.VerificationStatus = model.RiderPendingVerification
+		if len(rider.Documents.Missing()) == 0 {
+			rider.SubmittedAt = &now
+			rider.RejectionReason = ""
+		}
+		updated = *rider
+		return nil
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rider not found"})
+		return
+	}
+	if errors.Is(err, errAlreadyApproved) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to upload documents for rider %s: %v", riderUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save documents"})
+		return
+	}
+
+	c.JSON(http.StatusOK, verificationResponse(&updated))
+}
+
+// verificationResponse สร้างข้อมูลสถานะการตรวจสอบที่ส่งกลับให้แอป
+func verificationResponse(rider *model.Rider) gin.H {
+	status := rider.VerificationStatus
+	if status == "" {
+		status = model.RiderPendingVerification
+	}
+	missing := rider.Documents.Missing()
+	if missing == nil {
+		missing = []string{}
+	}
+	return gin.H{
+		"verificationStatus": status,
+		"rejectionReason":    rider.RejectionReason,
+		"documents":          rider.Documents,
+		"missingDocuments":   missing,
+		"submittedAt":        rider.SubmittedAt,
+	}
+}
+
+// --- สำหรับแอดมิน ---
+
+// ListRidersForVerification ดึงรายชื่อไรเดอร์ตามสถานะการตรวจสอบ
+// Query: ?verificationStatus=pending_verification (ค่าเริ่มต้น) | approved | rejected
+func (h *AuthHandler) ListRidersForVerification(c *gin.Context) {
+	ctx := context.Background()
+	status := c.DefaultQuery("verificationStatus", model.RiderPendingVerification)
+
+	riders, err := h.Riders.ListRidersByVerificationStatus(ctx, status)
+	if err != nil {
+		log.Printf("Failed to list riders with status %s: %v", status, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve riders"})
+		return
+	}
+
+	result := []gin.H{}
+	for _, uid := range sortedRiderUIDs(riders) {
+		rider := riders[uid]
+		item := gin.H{"uid": uid, "rider": rider}
+		if profile, err := h.Users.GetUser(ctx, uid); err == nil {
+			item["user"] = adminUser{UID: uid, UserProfile: *profile}
+		}
+		result = append(result, item)
+	}
+	c.JSON(http.StatusOK, gin.H{"riders": result, "count": len(result)})
+}
+
+// sortedRiderUIDs เรียงไรเดอร์ตามเวลาที่ส่งเอกสาร (ส่งก่อนได้ตรวจก่อน)
+func sortedRiderUIDs(riders map[string]model.Rider) []string {
+	uids := make([]string, 0, len(riders))
+	for uid := range riders {
+		uids = append(uids, uid)
+	}
+	submittedAt := func(uid string) time.Time {
+		if at := riders[uid].SubmittedAt; at != nil {
+			return *at
+		}
+		return time.Time{}
+	}
+	sort.Slice(uids, func(i, j int) bool {
+		return submittedAt(uids[i]).Before(submittedAt(uids[j]))
+	})
+	return uids
+}
+
+// ApproveRider อนุมัติไรเดอร์ (ต้องส่งเอกสารครบแล้ว) หลังจากนี้ไรเดอร์จะรับงานได้
+func (h *AuthHandler) ApproveRider(c *gin.Context) {
+	riderUID := c.Param("riderId")
+	adminUID := c.GetString("uid")
+
+	err := h.Riders.UpdateRider(context.Background(), riderUID, func(rider *model.Rider) error {
+		if rider.IsVerified() {
+			return errAlreadyApproved
+		}
+		if len(rider.Documents.Missing()) > 0 {
+			return errDocumentsMissing
+		}
+		now := time.Now()
+		rider.VerificationStatus = model.RiderApproved
+		rider.RejectionReason = ""
+		rider.ReviewedBy = adminUID
+		rider.ReviewedAt = &now
+		return nil
+	})
+	if !h.respondVerificationError(c, riderUID, err) {
+		return
+	}
+
+	h.notify(context.Background(), riderUID, model.Notification{
+		Type:    "rider_approved",
+		Message: "บัญชีไรเดอร์ของคุณผ่านการตรวจสอบแล้ว เริ่มรับงานได้เลย",
+	})
+	c.JSON(http.StatusOK, gin.H{"message": "Rider approved", "riderUID": riderUID})
+}
+
+// RejectRider ปฏิเสธเอกสารของไรเดอร์พร้อมเหตุผล ไรเดอร์ส่งเอกสารใหม่ได้ผ่าน UploadRiderDocuments
+func (h *AuthHandler) RejectRider(c *gin.Context) {
+	riderUID := c.Param("riderId")
+	adminUID := c.GetString("uid")
+
+	var req AdminActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+
+	err := h.Riders.UpdateRider(context.Background(), riderUID, func(rider *model.Rider) error {
+		now := time.Now()
+		rider.VerificationStatus = model.RiderRejected
+		rider.RejectionReason = reason
+		rider.ReviewedBy = adminUID
+		rider.ReviewedAt = &now
+		return nil
+	})
+	if !h.respondVerificationError(c, riderUID, err) {
+		return
+	}
+
+	h.notify(context.Background(), riderUID, model.Notification{
+		Type:    "rider_rejected",
+		Message: "เอกสารของคุณไม่ผ่านการตรวจสอบ: " + reason,
+	})
+	c.JSON(http.StatusOK, gin.H{"message": "Rider rejected", "riderUID": riderUID})
+}
+
+// respondVerificationError ตอบกลับ error จากการอนุมัติ/ปฏิเสธไรเดอร์ คืนค่า true ถ้าไม่มี error
+func (h *AuthHandler) respondVerificationError(c *gin.Context, riderUID string, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, store.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rider not found"})
+	case errors.Is(err, errAlreadyApproved), errors.Is(err, errDocumentsMissing):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Failed to update verification of rider %s: %v", riderUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update rider"})
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"api-flash-dash/identity"
+	"api-flash-dash/otp"
+	"api-flash-dash/store"
+
+	firebase "firebase.google.com/go/v4"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	os.Exit(m.Run())
+}
+
+// recordingSender เก็บ SMS ที่ถูกส่งไว้แทนการส่งจริง
+type recordingSender struct {
+	mu   sync.Mutex
+	sent []string // เบอร์ปลายทาง
+}
+
+func (s *recordingSender) Send(ctx context.Context, to, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, to)
+	return nil
+}
+
+// newTestHandler สร้าง AuthHandler ที่ใช้ memory store (ไม่ต้องต่อ Firebase)
+func newTestHandler() (*AuthHandler, *recordingSender) {
+	db := store.NewMemory()
+	sms := &recordingSender{}
+	return &AuthHandler{
+		Users:         db.Users,
+		Addresses:     db.Addresses,
+		Riders:        db.Riders,
+		Deliveries:    db.Deliveries,
+		Notifications: db.Notifications,
+		Ledger:        db.Ledger,
+		Verifications: db.Verifications,
+		Exports:       db.Exports,
+		OTP: otp.Config{
+			CodeTTL:        5 * time.Minute,
+			MaxAttempts:    5,
+			ResendInterval: time.Minute,
+			MaxSends:       5,
+			TicketTTL:      15 * time.Minute,
+			ResetTicketTTL: 5 * time.Minute,
+		},
+		SMS: sms,
+	}, sms
+}
+
+// withUID จำลอง middleware.AuthMiddleware ด้วยการตั้ง uid จาก header X-Test-UID
+func withUID(c *gin.Context) {
+	c.Set("uid", c.GetHeader("X-Test-UID"))
+	c.Next()
+}
+
+// do ส่งคำขอไปที่ router แล้วคืนค่า status และ JSON body
+func do(t *testing.T, router http.Handler, method, path, uid string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(raw)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Test-UID", uid)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var decoded map[string]interface{}
+	if rec.Body.Len() > 0 {
+		if err := json.Unmarshal(rec.Body.Bytes(), &decoded); err != nil {
+			t.Fatalf("%s %s: invalid JSON response %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code, decoded
+}
+
+// fakeAuth จำลอง Firebase Auth ทั้ง REST API ฝั่ง client (identity) และ Admin SDK (ผ่าน Auth Emulator host)
+type fakeAuth struct {
+	mu       sync.Mutex
+	password string          // รหัสผ่านที่ถูกต้องของทุกบัญชี
+	fail     map[string]bool // method ที่ให้ตอบ error เช่น "accounts:update"
+	calls    []string        // method ที่ถูกเรียก ตามลำดับ
+}
+
+// newFakeAuth ตั้งค่า h.AuthClient และ h.Identity ให้เรียก fakeAuth แทน Firebase จริง
+func newFakeAuth(t *testing.T, h *AuthHandler, password string) *fakeAuth {
+	t.Helper()
+	fake := &fakeAuth{password: password, fail: make(map[string]bool)}
+	server := httptest.NewServer(http.HandlerFunc(fake.serve))
+	t.Cleanup(server.Close)
+
+	t.Setenv("FIREBASE_AUTH_EMULATOR_HOST", strings.TrimPrefix(server.URL, "http://"))
+	app, err := firebase.NewApp(context.Background(), &firebase.Config{ProjectID: "test-project"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.AuthClient, err = app.Auth(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	h.Identity = &identity.Client{
+		IdentityToolkitURL: server.URL + "/identitytoolkit.googleapis.com",
+		SecureTokenURL:     server.URL + "/securetoken.googleapis.com",
+		HTTP:               server.Client(),
+	}
+	return fake
+}
+
+func (f *fakeAuth) serve(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	var body struct {
+		Password string `json:"password"`
+		LocalID  string `json:"localId"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	f.mu.Lock()
+	f.calls = append(f.calls, method)
+	fail := f.fail[method]
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	reply := func(status int, v interface{}) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+	switch {
+	case fail:
+		reply(http.StatusInternalServerError, gin.H{"error": gin.H{"message": "INTERNAL_ERROR"}})
+	case method == "accounts:signInWithPassword" && body.Password != f.password:
+		reply(http.StatusBadRequest, gin.H{"error": gin.H{"message": "INVALID_PASSWORD"}})
+	case method == "accounts:signInWithPassword":
+		reply(http.StatusOK, gin.H{"idToken": "id-token", "refreshToken": "refresh-token", "expiresIn": "3600"})
+	case method == "accounts:lookup":
+		reply(http.StatusOK, gin.H{"users": []gin.H{{"localId": "uid"}}})
+	default: // accounts:update, accounts:delete
+		reply(http.StatusOK, gin.H{"localId": body.LocalID})
+	}
+}
+
+// setFail กำหนดให้ method นี้ตอบ error หรือไม่
+func (f *fakeAuth) setFail(method string, fail bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail[method] = fail
+}
+
+// called บอกว่า method นี้ถูกเรียกแล้วหรือยัง
+func (f *fakeAuth) called(method string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, call := range f.calls {
+		if call == method {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"api-flash-dash/otp"
+
+	"firebase.google.com/go/v4/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// rollbackTimeout คือเวลาสูงสุดที่ใช้ย้อนกลับการสมัคร 1 ครั้ง
+const rollbackTimeout = 30 * time.Second
+
+// registration คือการสมัครสมาชิกแบบ saga: ทุกขั้นตอนที่เขียนข้อมูลจะลงทะเบียนขั้นตอนชดเชย (compensation) ไว้
+// ถ้าขั้นตอนใดล้มเหลว rollback จะเรียกขั้นตอนชดเชยย้อนหลังทั้งหมด (ลบผู้ใช้ใน Auth, ลบเอกสาร, คืน ticket)
+// ไม่เช่นนั้นผู้ใช้ใน Auth ที่ค้างอยู่จะทำให้เบอร์นี้สมัครใหม่ไม่ได้อีก ("already registered")
+// ถ้าขั้นตอนชดเชยล้มเหลวเอง จะบันทึก log ไว้ให้ซ่อมด้วย cmd/repair-registrations
+type registration struct {
+	h     *AuthHandler
+	phone string
+	undo  []compensation
+}
+
+type compensation struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+func (h *AuthHandler) newRegistration(phoneE164 string) *registration {
+	return &registration{h: h, phone: phoneE164}
+}
+
+// onRollback ลงทะเบียนขั้นตอนชดเชย (ถูกเรียกย้อนลำดับกับที่ลงทะเบียน)
+func (r *registration) onRollback(name string, fn func(ctx context.Context) error) {
+	r.undo = append(r.undo, compensation{name: name, fn: fn})
+}
+
+// rollback ย้อนกลับทุกขั้นตอนที่ทำไปแล้ว ไม่ใช้ context ของ request เพราะอาจถูกยกเลิกไปแล้ว (เช่น client ตัดการเชื่อมต่อ)
+func (r *registration) rollback(cause error) {
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	log.Printf("Registration of %s failed, rolling back %d step(s): %v", r.phone, len(r.undo), cause)
+	for i := len(r.undo) - 1; i >= 0; i-- {
+		step := r.undo[i]
+		if err := step.fn(ctx); err != nil {
+			log.Printf("ORPHAN: rollback step %q for %s failed: %v (run cmd/repair-registrations)", step.name, r.phone, err)
+		}
+	}
+	r.undo = nil
+}
+
+// redeemTicket ใช้ verification ticket และลงทะเบียนการคืน ticket ไว้ ถ้าการสมัครล้มเหลวผู้ใช้จะไม่ต้องขอ OTP ใหม่
+func (r *registration) redeemTicket(c *gin.Context, ticket string) bool {
+	expiresAt, ok := r.h.redeemTicketUntil(c, otp.PurposeRegister, r.phone, ticket)
+	if !ok {
+		return false
+	}
+	r.onRollback("restore verification ticket", func(ctx context.Context) error {
+		return r.h.restoreTicket(ctx, otp.PurposeRegister, r.phone, ticket, expiresAt)
+	})
+	return true
+}
+
+// createAuthUser สร้างผู้ใช้ใน Firebase Authentication
+// ขั้นตอนชดเชยถูกลงทะเบียนหลังสร้างสำเร็จเท่านั้น (ถ้ามีบัญชีอยู่แล้ว ห้ามลบบัญชีของคนอื่น)
+func (r *registration) createAuthUser(ctx context.Context, params *auth.UserToCreate) (*auth.UserRecord, error) {
+	record, err := r.h.AuthClient.CreateUser(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	r.onRollback("delete auth user", func(ctx context.Context) error {
+		if err := r.h.AuthClient.DeleteUser(ctx, record.UID); err != nil && !auth.IsUserNotFound(err) {
+			return err
+		}
+		return nil
+	})
+	return record, nil
+}
+
+// createDocument เขียนเอกสารด้วย write และลงทะเบียน remove เป็นขั้นตอนชดเชยก่อนเขียน
+// เพราะการเขียนที่คืนค่า error (เช่น timeout) อาจบันทึกสำเร็จไปแล้วก็ได้ (remove ต้องเรียกซ้ำได้)
+func (r *registration) createDocument(ctx context.Context, name string, write, remove func(ctx context.Context) error) error {
+	r.onRollback("delete "+name, remove)
+	return write(ctx)
+}
@@ -0,0 +1,161 @@
+// Package identity เรียก REST API ของ Firebase Auth ฝั่ง client (ล็อกอินด้วยรหัสผ่าน และต่ออายุ Token)
+// ซึ่ง Admin SDK ไม่มีให้ ตั้งค่า base URL ได้เพื่อชี้ไปที่ Auth Emulator
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ค่าเริ่มต้นของ base URL (production)
+const (
+	DefaultIdentityToolkitURL = "https://identitytoolkit.googleapis.com"
+	DefaultSecureTokenURL     = "https://securetoken.googleapis.com"
+)
+
+var (
+	// ErrInvalidCredentials เบอร์โทรหรือรหัสผ่านไม่ถูกต้อง
+	ErrInvalidCredentials = errors.New("identity: invalid phone number or password")
+	// ErrInvalidRefreshToken refresh token ไม่ถูกต้อง หมดอายุ หรือถูกเพิกถอนแล้ว
+	ErrInvalidRefreshToken = errors.New("identity: refresh token is invalid, expired or revoked")
+	// ErrUserDisabled บัญชีถูกปิดใช้งาน (เช่น แอดมินระงับบัญชี)
+	ErrUserDisabled = errors.New("identity: user account is disabled")
+)
+
+// Token คือผลลัพธ์จากการล็อกอินหรือการต่ออายุ
+type Token struct {
+	IDToken      string `json:"idToken"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"` // วินาที
+	UID          string `json:"-"`
+}
+
+// Client เรียก Identity Toolkit และ Secure Token API ด้วย Web API Key ของโปรเจกต์
+type Client struct {
+	APIKey             string
+	IdentityToolkitURL string
+	SecureTokenURL     string
+	HTTP               *http.Client
+}
+
+// LoadClient อ่านการตั้งค่าจาก Environment Variable
+//   - FIREBASE_WEB_API_KEY
+//   - FIREBASE_IDENTITY_TOOLKIT_URL และ FIREBASE_SECURE_TOKEN_URL (ถ้าต้องการกำหนดเอง)
+//   - ถ้าไม่ได้กำหนดแต่มี FIREBASE_AUTH_EMULATOR_HOST จะชี้ไปที่ Emulator ให้อัตโนมัติ
+func LoadClient() *Client {
+	c := &Client{
+		APIKey:             os.Getenv("FIREBASE_WEB_API_KEY"),
+		IdentityToolkitURL: DefaultIdentityToolkitURL,
+		SecureTokenURL:     DefaultSecureTokenURL,
+		HTTP:               &http.Client{Timeout: 15 * time.Second},
+	}
+	// Emulator ใช้ path แบบ http://host/identitytoolkit.googleapis.com/v1/...
+	if host := os.Getenv("FIREBASE_AUTH_EMULATOR_HOST"); host != "" {
+		c.IdentityToolkitURL = "http://" + host + "/identitytoolkit.googleapis.com"
+		c.SecureTokenURL = "http://" + host + "/securetoken.googleapis.com"
+	}
+	if v := os.Getenv("FIREBASE_IDENTITY_TOOLKIT_URL"); v != "" {
+		c.IdentityToolkitURL = strings.TrimSuffix(v, "/")
+	}
+	if v := os.Getenv("FIREBASE_SECURE_TOKEN_URL"); v != "" {
+		c.SecureTokenURL = strings.TrimSuffix(v, "/")
+	}
+	return c
+}
+
+// SignInWithPassword ล็อกอินด้วยอีเมล (สังเคราะห์จากเบอร์โทร) และรหัสผ่าน
+func (c *Client) SignInWithPassword(ctx context.Context, email, password string) (*Token, error) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"email":             email,
+		"password":          password,
+		"returnSecureToken": true,
+	})
+	endpoint := c.IdentityToolkitURL + "/v1/accounts:signInWithPassword?key=" + url.QueryEscape(c.APIKey)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(string(body)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp struct {
+		IDToken      string `json:"idToken"`
+		RefreshToken string `json:"refreshToken"`
+		ExpiresIn    string `json:"expiresIn"`
+		LocalID      string `json:"localId"`
+	}
+	if err := c.do(req, &resp, ErrInvalidCredentials); err != nil {
+		return nil, err
+	}
+	return &Token{IDToken: resp.IDToken, RefreshToken: resp.RefreshToken, ExpiresIn: atoi(resp.ExpiresIn), UID: resp.LocalID}, nil
+}
+
+// Refresh แลก refresh token เป็น ID Token ใหม่
+func (c *Client) Refresh(ctx context.Context, refreshToken string) (*Token, error) {
+	form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}}
+	endpoint := c.SecureTokenURL + "/v1/token?key=" + url.QueryEscape(c.APIKey)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// Secure Token API ตอบกลับเป็น snake_case ต่างจาก Identity Toolkit
+	var resp struct {
+		IDToken      string `json:"id_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    string `json:"expires_in"`
+		UserID       string `json:"user_id"`
+	}
+	if err := c.do(req, &resp, ErrInvalidRefreshToken); err != nil {
+		return nil, err
+	}
+	return &Token{IDToken: resp.IDToken, RefreshToken: resp.RefreshToken, ExpiresIn: atoi(resp.ExpiresIn), UID: resp.UserID}, nil
+}
+
+// do ส่ง request และแปลง error ของ Firebase (เช่น "INVALID_PASSWORD") เป็น error ของแพ็กเกจนี้
+// error ฝั่งผู้ใช้ทั้งหมด (4xx) จะถูกแปลงเป็น clientErr ยกเว้นบัญชีถูกปิดใช้งาน
+func (c *Client) do(req *http.Request, out interface{}, clientErr error) error {
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(body, &apiErr)
+		// ข้อความอาจมีรายละเอียดต่อท้าย เช่น "TOO_MANY_ATTEMPTS_TRY_LATER : ..."
+		code := strings.TrimSpace(strings.SplitN(apiErr.Error.Message, ":", 2)[0])
+		switch {
+		case code == "USER_DISABLED":
+			return ErrUserDisabled
+		case resp.StatusCode >= 400 && resp.StatusCode < 500:
+			return fmt.Errorf("%w (%s)", clientErr, code)
+		default:
+			return fmt.Errorf("identity: Firebase returned status %d: %s", resp.StatusCode, string(body))
+		}
+	}
+	return json.Unmarshal(body, out)
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,405 @@
+package lifecycle
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"api-flash-dash/geo"
+	"api-flash-dash/model"
+)
+
+// สถานะทั้งหมดของ delivery
+const (
+	StatusPending   = "pending"
+	StatusAccepted  = "accepted"
+	StatusPickedUp  = "picked_up"
+	StatusDelivered = "delivered"
+	StatusCancelled = "cancelled"
+)
+
+// Event คือการกระทำที่ทำให้สถานะของ delivery เปลี่ยน
+type Event string
+
+const (
+	EventCreate  Event = "create"
+	EventAccept  Event = "accept"
+	EventPickup  Event = "pickup"
+	EventDeliver Event = "deliver"
+	EventCancel  Event = "cancel"
+	EventRelease Event = "release"
+	// Event ที่แอดมินเท่านั้นทำได้
+	EventForceCancel Event = "force_cancel"
+	EventReassign    Event = "reassign"
+)
+
+// Role คือบทบาทของผู้กระทำเมื่อเทียบกับ delivery นั้นๆ
+type Role string
+
+const (
+	RoleSender   Role = "sender"
+	RoleReceiver Role = "receiver"
+	RoleRider    Role = "rider"
+	RoleAdmin    Role = "admin"  // แอดมิน (ไม่ได้เป็นคู่กรณีของ delivery)
+	RoleSystem   Role = "system" // ระบบทำเอง (เช่น ยกเลิกงานเมื่อผู้ใช้ลบบัญชี)
+)
+
+// Actor คือผู้ที่สั่งให้เกิดการเปลี่ยนสถานะ
+type Actor struct {
+	UID  string
+	Role Role
+}
+
+// Input คือข้อมูลที่แนบมากับ Event (แต่ละ Event ใช้ไม่เหมือนกัน)
+type Input struct {
+	Actor          Actor
+	Reason         string
+	PickupImage    string
+	DeliveredImage string
+	DeliveryPIN    string // PIN ที่ไรเดอร์ได้มาจากผู้รับตอนส่งของ
+	AssignRiderUID string // ไรเดอร์คนใหม่ (ใช้กับ EventReassign)
+
+	// ตำแหน่งของไรเดอร์ตอนยืนยันรับ/ส่งของ และการตั้งค่า geofence
+	Position       *model.Coordinates
+	PositionSource string
+	Fence          geo.Fence
+}
+
+// แหล่งที่มาของตำแหน่งไรเดอร์ที่ใช้ตรวจสอบ geofence
+const (
+	PositionFromRequest = "request"
+	PositionFromRider   = "rider_location"
+	PositionUnknown     = "unknown"
+)
+
+// MaxPINAttempts คือจำนวนครั้งที่ใส่ PIN ผิดได้ก่อน PIN จะถูกล็อก
+const MaxPINAttempts = 5
+
+// pinDigits คือความยาวของ PIN ยืนยันการรับของ
+const pinDigits = 6
+
+var (
+	// ErrInvalidTransition ถูกส่งกลับเมื่อสถานะปัจจุบันไม่อนุญาตให้เกิด Event นี้
+	ErrInvalidTransition = errors.New("invalid delivery status transition")
+	// ErrActorNotAllowed ถูกส่งกลับเมื่อผู้กระทำไม่มีสิทธิ์ทำ Event นี้
+	ErrActorNotAllowed = errors.New("actor is not allowed to perform this transition")
+	// ErrReasonRequired ถูกส่งกลับเมื่อ Event นี้ต้องระบุเหตุผลแต่ไม่ได้ส่งมา
+	ErrReasonRequired = errors.New("a reason is required for this transition")
+	// ErrInvalidPIN ถูกส่งกลับเมื่อ PIN ยืนยันการรับของไม่ถูกต้อง
+	ErrInvalidPIN = errors.New("delivery PIN is incorrect")
+	// ErrPINLocked ถูกส่งกลับเมื่อใส่ PIN ผิดเกินจำนวนครั้งที่กำหนด
+	ErrPINLocked = errors.New("delivery PIN is locked after too many wrong attempts")
+	// ErrOutOfRange ถูกส่งกลับเมื่อไรเดอร์อยู่ห่างจากจุดรับ/ส่งของเกินรัศมีที่กำหนด
+	ErrOutOfRange = errors.New("rider is too far from the address")
+	// ErrLocationUnknown ถูกส่งกลับเมื่อต้องตรวจสอบตำแหน่งแต่ไม่รู้ตำแหน่งของไรเดอร์
+	ErrLocationUnknown = errors.New("rider location is unknown")
+)
+
+// transition อธิบายการเปลี่ยนสถานะ 1 แบบ:
+// สถานะต้นทางที่อนุญาต, สถานะปลายทาง, บทบาทที่ทำได้, เงื่อนไขเพิ่มเติม และผลข้างเคียง
+type transition struct {
+	from   []string
+	to     string
+	roles  []Role
+	guard  func(d *model.Delivery, in Input) error
+	effect func(d *model.Delivery, in Input)
+}
+
+// transitions คือตารางการเปลี่ยนสถานะที่ถูกต้องทั้งหมด
+var transitions = map[Event]transition{
+	EventAccept: {
+		from:  []string{StatusPending},
+		to:    StatusAccepted,
+		roles: []Role{RoleRider},
+		guard: func(d *model.Delivery, in Input) error {
+			// ถ้า riderUID มีค่าอยู่แล้ว (แม้ status จะเป็น pending) แสดงว่ามีบางอย่างผิดปกติ
+			if d.RiderUID != nil {
+				return fmt.Errorf("%w: delivery has already been assigned, cannot be accepted again", ErrInvalidTransition)
+			}
+			return nil
+		},
+		effect: func(d *model.Delivery, in Input) {
+			uid := in.Actor.UID
+			d.RiderUID = &uid
+		},
+	},
+	EventPickup: {
+		from:  []string{StatusAccepted},
+		to:    StatusPickedUp,
+		roles: []Role{RoleRider},
+		guard: func(d *model.Delivery, in Input) error {
+			if err := assignedRider(d, in); err != nil {
+				return err
+			}
+			_, err := checkLocation(d.SenderAddress.Coordinates, in)
+			return err
+		},
+		effect: func(d *model.Delivery, in Input) {
+			d.PickupImage = in.PickupImage
+			d.PickupCheck = recordLocation(d, d.SenderAddress.Coordinates, in)
+		},
+	},
+	EventDeliver: {
+		from:  []string{StatusPickedUp},
+		to:    StatusDelivered,
+		roles: []Role{RoleRider},
+		guard: func(d *model.Delivery, in Input) error {
+			if err := assignedRider(d, in); err != nil {
+				return err
+			}
+			if _, err := checkLocation(d.ReceiverAddress.Coordinates, in); err != nil {
+				return err
+			}
+			return checkPIN(d, in)
+		},
+		effect: func(d *model.Delivery, in Input) {
+			d.DeliveredImage = in.DeliveredImage
+			d.DeliveryCheck = recordLocation(d, d.ReceiverAddress.Coordinates, in)
+		},
+	},
+	EventCancel: {
+		// ยกเลิกได้ฟรีตอน "pending" แต่ถ้าไรเดอร์รับงานแล้วต้องระบุเหตุผล
+		// หลังจาก "picked_up" แล้วยกเลิกไม่ได้
+		from:  []string{StatusPending, StatusAccepted},
+		to:    StatusCancelled,
+		roles: []Role{RoleSender},
+		guard: func(d *model.Delivery, in Input) error {
+			if d.SenderUID != in.Actor.UID {
+				return fmt.Errorf("%w: only the sender can cancel this delivery", ErrActorNotAllowed)
+			}
+			if d.Status == StatusAccepted && strings.TrimSpace(in.Reason) == "" {
+				return fmt.Errorf("%w: a rider has already accepted this delivery", ErrReasonRequired)
+			}
+			return nil
+		},
+		effect: func(d *model.Delivery, in Input) {
+			d.CancelReason = strings.TrimSpace(in.Reason)
+		},
+	},
+	EventRelease: {
+		// ไรเดอร์คืนงานที่รับไว้ (เช่น รถเสีย) งานจะกลับไปอยู่ในกลุ่ม "pending" ให้คนอื่นรับต่อ
+		from:  []string{StatusAccepted},
+		to:    StatusPending,
+		roles: []Role{RoleRider},
+		guard: func(d *model.Delivery, in Input) error {
+			if err := assignedRider(d, in); err != nil {
+				return err
+			}
+			if strings.TrimSpace(in.Reason) == "" {
+				return fmt.Errorf("%w: please tell us why you are releasing this delivery", ErrReasonRequired)
+			}
+			return nil
+		},
+		effect: func(d *model.Delivery, in Input) {
+			d.RiderUID = nil
+		},
+	},
+	EventForceCancel: {
+		// แอดมิน (หรือระบบ) ยกเลิกงานได้ทุกสถานะที่ยังไม่จบ แต่ต้องระบุเหตุผลเสมอ
+		from:  []string{StatusPending, StatusAccepted, StatusPickedUp},
+		to:    StatusCancelled,
+		roles: []Role{RoleAdmin, RoleSystem},
+		guard: reasonRequired,
+		effect: func(d *model.Delivery, in Input) {
+			d.CancelReason = strings.TrimSpace(in.Reason)
+		},
+	},
+	EventReassign: {
+		// แอดมินมอบงานให้ไรเดอร์คนอื่น (หรือมอบงานที่ยัง pending ให้ไรเดอร์โดยตรง)
+		from:  []string{StatusPending, StatusAccepted},
+		to:    StatusAccepted,
+		roles: []Role{RoleAdmin},
+		guard: func(d *model.Delivery, in Input) error {
+			if in.AssignRiderUID == "" {
+				return fmt.Errorf("%w: a rider to assign is required", ErrInvalidTransition)
+			}
+			if d.RiderUID != nil && *d.RiderUID == in.AssignRiderUID {
+				return fmt.Errorf("%w: delivery is already assigned to this rider", ErrInvalidTransition)
+			}
+			return reasonRequired(d, in)
+		},
+		effect: func(d *model.Delivery, in Input) {
+			uid := in.AssignRiderUID
+			d.RiderUID = &uid
+		},
+	},
+}
+
+// reasonRequired บังคับให้ต้องระบุเหตุผล
+func reasonRequired(d *model.Delivery, in Input) error {
+	if strings.TrimSpace(in.Reason) == "" {
+		return fmt.Errorf("%w: please provide a reason", ErrReasonRequired)
+	}
+	return nil
+}
+
+// assignedRider ตรวจสอบว่าผู้กระทำคือไรเดอร์ที่รับงานนี้อยู่จริง
+func assignedRider(d *model.Delivery, in Input) error {
+	if d.RiderUID == nil || *d.RiderUID != in.Actor.UID {
+		return fmt.Errorf("%w: you are not the assigned rider for this delivery", ErrActorNotAllowed)
+	}
+	return nil
+}
+
+// checkLocation เทียบตำแหน่งไรเดอร์กับ target ตามการตั้งค่า in.Fence
+// ในโหมด "reject" จะคืนค่า error ถ้าอยู่นอกรัศมีหรือไม่รู้ตำแหน่ง
+// ในโหมด "flag" จะคืนค่าผลการตรวจสอบที่ WithinRange เป็น false แทน
+func checkLocation(target model.Coordinates, in Input) (*model.LocationCheck, error) {
+	check := &model.LocationCheck{
+		Source:      PositionUnknown,
+		RadiusM:     in.Fence.RadiusM,
+		WithinRange: !in.Fence.Enabled(),
+		CheckedAt:   time.Now(),
+	}
+	if in.Position == nil {
+		if in.Fence.Enabled() && !in.Fence.FlagOnly() {
+			return nil, fmt.Errorf("%w: please send your current location", ErrLocationUnknown)
+		}
+		return check, nil
+	}
+
+	distanceM := geo.DistanceKm(in.Position.Latitude, in.Position.Longitude, target.Latitude, target.Longitude) * 1000
+	position := *in.Position
+	check.Position = &position
+	check.Source = in.PositionSource
+	check.DistanceM = &distanceM
+	if in.Fence.Enabled() {
+		check.WithinRange = distanceM <= in.Fence.RadiusM
+	}
+	if !check.WithinRange && !in.Fence.FlagOnly() {
+		return nil, fmt.Errorf("%w: you are %.0f m away, must be within %.0f m", ErrOutOfRange, distanceM, in.Fence.RadiusM)
+	}
+	return check, nil
+}
+
+// recordLocation เก็บผลการตรวจสอบตำแหน่ง และทำเครื่องหมายให้ตรวจสอบถ้าอยู่นอกรัศมี
+// ถูกเรียกหลังจาก guard ผ่านแล้วเท่านั้น
+func recordLocation(d *model.Delivery, target model.Coordinates, in Input) *model.LocationCheck {
+	check, _ := checkLocation(target, in)
+	if check != nil && !check.WithinRange {
+		d.NeedsReview = true
+	}
+	return check
+}
+
+// checkPIN ตรวจสอบ PIN ที่ไรเดอร์ส่งมากับ PIN ของผู้รับ
+// delivery เก่าที่สร้างก่อนมีระบบ PIN จะไม่ถูกตรวจสอบ
+func checkPIN(d *model.Delivery, in Input) error {
+	if d.DeliveryPIN == "" {
+		return nil
+	}
+	if d.PINLocked {
+		return ErrPINLocked
+	}
+	if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(in.DeliveryPIN)), []byte(d.DeliveryPIN)) != 1 {
+		return ErrInvalidPIN
+	}
+	return nil
+}
+
+// RecordPINFailure นับจำนวนครั้งที่ใส่ PIN ผิด และล็อก PIN เมื่อครบ MaxPINAttempts
+// ผู้เรียกต้องบันทึก d ลงฐานข้อมูลเอง (Apply ไม่แก้ไข d เมื่อเกิด error)
+func RecordPINFailure(d *model.Delivery) {
+	d.PINAttempts++
+	if d.PINAttempts >= MaxPINAttempts {
+		d.PINLocked = true
+	}
+}
+
+// ResetPIN ออก PIN ใหม่ให้ delivery และปลดล็อก (ใช้เมื่อผู้รับขอ PIN ใหม่)
+func ResetPIN(d *model.Delivery) {
+	d.DeliveryPIN = newPIN()
+	d.PINAttempts = 0
+	d.PINLocked = false
+}
+
+// newPIN สุ่ม PIN ตัวเลข pinDigits หลัก
+func newPIN() string {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(pinDigits), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		panic(fmt.Sprintf("lifecycle: cannot generate delivery PIN: %v", err))
+	}
+	return fmt.Sprintf("%0*d", pinDigits, n)
+}
+
+// Create ตั้งสถานะเริ่มต้นให้ delivery ใหม่ สร้าง PIN ยืนยันการรับของ และคืนค่าประวัติรายการแรก
+func Create(d *model.Delivery, actor Actor) model.StatusChange {
+	d.Status = StatusPending
+	ResetPIN(d)
+	return newChange("", StatusPending, EventCreate, Input{Actor: actor})
+}
+
+// Apply ตรวจสอบว่า Event นี้ทำได้หรือไม่ แล้วเปลี่ยนสถานะของ d พร้อมทำผลข้างเคียง
+// คืนค่าประวัติการเปลี่ยนสถานะที่ต้องบันทึกลง statusHistory
+// ถ้าทำไม่ได้ d จะไม่ถูกแก้ไขเลย
+func Apply(d *model.Delivery, event Event, in Input) (*model.StatusChange, error) {
+	t, ok := transitions[event]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown event %q", ErrInvalidTransition, event)
+	}
+	if !contains(t.from, d.Status) {
+		return nil, fmt.Errorf("%w: cannot %s a delivery with status '%s'", ErrInvalidTransition, event, d.Status)
+	}
+	if !containsRole(t.roles, in.Actor.Role) {
+		return nil, fmt.Errorf("%w: a %s cannot %s this delivery", ErrActorNotAllowed, in.Actor.Role, event)
+	}
+	if t.guard != nil {
+		if err := t.guard(d, in); err != nil {
+			return nil, err
+		}
+	}
+
+	from := d.Status
+	d.Status = t.to
+	if t.effect != nil {
+		t.effect(d, in)
+	}
+	change := newChange(from, t.to, event, in)
+	return &change, nil
+}
+
+// Can บอกว่า Event นี้เกิดขึ้นได้จากสถานะ status หรือไม่ (ไม่สนใจผู้กระทำ)
+func Can(status string, event Event) bool {
+	t, ok := transitions[event]
+	return ok && contains(t.from, status)
+}
+
+// IsFinal บอกว่าสถานะนี้เป็นสถานะสุดท้ายแล้ว (ไม่มีการเปลี่ยนสถานะต่อได้อีก)
+func IsFinal(status string) bool {
+	return status == StatusDelivered || status == StatusCancelled
+}
+
+func newChange(from, to string, event Event, in Input) model.StatusChange {
+	return model.StatusChange{
+		From:      from,
+		To:        to,
+		Event:     string(event),
+		ActorUID:  in.Actor.UID,
+		ActorRole: string(in.Actor.Role),
+		Reason:    in.Reason,
+		At:        time.Now(),
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsRole(list []Role, r Role) bool {
+	for _, item := range list {
+		if item == r {
+			return true
+		}
+	}
+	return false
+}
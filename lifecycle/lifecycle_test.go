@@ -0,0 +1,151 @@
+package lifecycle
+
+import (
+	"errors"
+	"testing"
+
+	"api-flash-dash/geo"
+	"api-flash-dash/model"
+)
+
+var (
+	pickup  = model.Coordinates{Latitude: 13.7563, Longitude: 100.5018}
+	dropoff = model.Coordinates{Latitude: 13.7465, Longitude: 100.5348}
+	// ห่างจากจุดรับของประมาณ 1 กม.
+	farFromPickup = model.Coordinates{Latitude: 13.7653, Longitude: 100.5018}
+)
+
+func strPtr(s string) *string { return &s }
+
+func delivery(status string, riderUID *string) *model.Delivery {
+	return &model.Delivery{
+		SenderUID:       "sender",
+		ReceiverUID:     "receiver",
+		SenderAddress:   model.Address{Coordinates: pickup},
+		ReceiverAddress: model.Address{Coordinates: dropoff},
+		Status:          status,
+		RiderUID:        riderUID,
+		DeliveryPIN:     "123456",
+	}
+}
+
+func TestApply(t *testing.T) {
+	rider := Actor{UID: "rider", Role: RoleRider}
+	otherRider := Actor{UID: "other", Role: RoleRider}
+	sender := Actor{UID: "sender", Role: RoleSender}
+	admin := Actor{UID: "admin", Role: RoleAdmin}
+	reject := geo.Fence{RadiusM: 200, Mode: geo.FenceReject}
+	flag := geo.Fence{RadiusM: 200, Mode: geo.FenceFlag}
+
+	tests := []struct {
+		name       string
+		delivery   *model.Delivery
+		event      Event
+		in         Input
+		err        error
+		wantStatus string
+		wantRider  string // "" = ไม่มีไรเดอร์
+		wantReview bool
+	}{
+		{name: "rider accepts pending", delivery: delivery(StatusPending, nil), event: EventAccept, in: Input{Actor: rider}, wantStatus: StatusAccepted, wantRider: "rider"},
+		{name: "accept already assigned", delivery: delivery(StatusPending, strPtr("x")), event: EventAccept, in: Input{Actor: rider}, err: ErrInvalidTransition},
+		{name: "sender cannot accept", delivery: delivery(StatusPending, nil), event: EventAccept, in: Input{Actor: sender}, err: ErrActorNotAllowed},
+		{name: "accept accepted", delivery: delivery(StatusAccepted, strPtr("rider")), event: EventAccept, in: Input{Actor: rider}, err: ErrInvalidTransition},
+		{name: "unknown event", delivery: delivery(StatusPending, nil), event: "teleport", in: Input{Actor: rider}, err: ErrInvalidTransition},
+
+		{name: "pickup at pickup point", delivery: delivery(StatusAccepted, strPtr("rider")), event: EventPickup, in: Input{Actor: rider, Position: &pickup, Fence: reject}, wantStatus: StatusPickedUp, wantRider: "rider"},
+		{name: "pickup by other rider", delivery: delivery(StatusAccepted, strPtr("rider")), event: EventPickup, in: Input{Actor: otherRider, Position: &pickup, Fence: reject}, err: ErrActorNotAllowed},
+		{name: "pickup out of range", delivery: delivery(StatusAccepted, strPtr("rider")), event: EventPickup, in: Input{Actor: rider, Position: &farFromPickup, Fence: reject}, err: ErrOutOfRange},
+		{name: "pickup out of range flagged", delivery: delivery(StatusAccepted, strPtr("rider")), event: EventPickup, in: Input{Actor: rider, Position: &farFromPickup, Fence: flag}, wantStatus: StatusPickedUp, wantRider: "rider", wantReview: true},
+		{name: "pickup without location", delivery: delivery(StatusAccepted, strPtr("rider")), event: EventPickup, in: Input{Actor: rider, Fence: reject}, err: ErrLocationUnknown},
+		{name: "pickup with fence disabled", delivery: delivery(StatusAccepted, strPtr("rider")), event: EventPickup, in: Input{Actor: rider}, wantStatus: StatusPickedUp, wantRider: "rider"},
+
+		{name: "deliver with PIN", delivery: delivery(StatusPickedUp, strPtr("rider")), event: EventDeliver, in: Input{Actor: rider, Position: &dropoff, Fence: reject, DeliveryPIN: " 123456 "}, wantStatus: StatusDelivered, wantRider: "rider"},
+		{name: "deliver with wrong PIN", delivery: delivery(StatusPickedUp, strPtr("rider")), event: EventDeliver, in: Input{Actor: rider, Position: &dropoff, Fence: reject, DeliveryPIN: "000000"}, err: ErrInvalidPIN},
+		{name: "deliver before pickup", delivery: delivery(StatusAccepted, strPtr("rider")), event: EventDeliver, in: Input{Actor: rider, Position: &dropoff, DeliveryPIN: "123456"}, err: ErrInvalidTransition},
+
+		{name: "sender cancels pending", delivery: delivery(StatusPending, nil), event: EventCancel, in: Input{Actor: sender}, wantStatus: StatusCancelled},
+		{name: "sender cancels accepted without reason", delivery: delivery(StatusAccepted, strPtr("rider")), event: EventCancel, in: Input{Actor: sender, Reason: "  "}, err: ErrReasonRequired},
+		{name: "sender cancels accepted with reason", delivery: delivery(StatusAccepted, strPtr("rider")), event: EventCancel, in: Input{Actor: sender, Reason: "changed my mind"}, wantStatus: StatusCancelled, wantRider: "rider"},
+		{name: "other sender cannot cancel", delivery: delivery(StatusPending, nil), event: EventCancel, in: Input{Actor: Actor{UID: "someone", Role: RoleSender}}, err: ErrActorNotAllowed},
+		{name: "cancel picked up", delivery: delivery(StatusPickedUp, strPtr("rider")), event: EventCancel, in: Input{Actor: sender, Reason: "late"}, err: ErrInvalidTransition},
+
+		{name: "rider releases with reason", delivery: delivery(StatusAccepted, strPtr("rider")), event: EventRelease, in: Input{Actor: rider, Reason: "flat tyre"}, wantStatus: StatusPending},
+		{name: "rider releases without reason", delivery: delivery(StatusAccepted, strPtr("rider")), event: EventRelease, in: Input{Actor: rider}, err: ErrReasonRequired},
+
+		{name: "admin force cancels picked up", delivery: delivery(StatusPickedUp, strPtr("rider")), event: EventForceCancel, in: Input{Actor: admin, Reason: "fraud"}, wantStatus: StatusCancelled, wantRider: "rider"},
+		{name: "admin force cancel without reason", delivery: delivery(StatusPending, nil), event: EventForceCancel, in: Input{Actor: admin}, err: ErrReasonRequired},
+		{name: "force cancel delivered", delivery: delivery(StatusDelivered, strPtr("rider")), event: EventForceCancel, in: Input{Actor: admin, Reason: "fraud"}, err: ErrInvalidTransition},
+		{name: "sender cannot force cancel", delivery: delivery(StatusPending, nil), event: EventForceCancel, in: Input{Actor: sender, Reason: "x"}, err: ErrActorNotAllowed},
+
+		{name: "admin reassigns", delivery: delivery(StatusAccepted, strPtr("rider")), event: EventReassign, in: Input{Actor: admin, Reason: "rider sick", AssignRiderUID: "other"}, wantStatus: StatusAccepted, wantRider: "other"},
+		{name: "admin assigns pending", delivery: delivery(StatusPending, nil), event: EventReassign, in: Input{Actor: admin, Reason: "urgent", AssignRiderUID: "other"}, wantStatus: StatusAccepted, wantRider: "other"},
+		{name: "reassign to same rider", delivery: delivery(StatusAccepted, strPtr("rider")), event: EventReassign, in: Input{Actor: admin, Reason: "x", AssignRiderUID: "rider"}, err: ErrInvalidTransition},
+		{name: "reassign without rider", delivery: delivery(StatusAccepted, strPtr("rider")), event: EventReassign, in: Input{Actor: admin, Reason: "x"}, err: ErrInvalidTransition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := *tt.delivery
+			change, err := Apply(tt.delivery, tt.event, tt.in)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Apply() error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				if tt.delivery.Status != before.Status || tt.delivery.RiderUID != before.RiderUID {
+					t.Errorf("delivery changed on error: %+v", tt.delivery)
+				}
+				return
+			}
+			if tt.delivery.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", tt.delivery.Status, tt.wantStatus)
+			}
+			gotRider := ""
+			if tt.delivery.RiderUID != nil {
+				gotRider = *tt.delivery.RiderUID
+			}
+			if gotRider != tt.wantRider {
+				t.Errorf("riderUID = %q, want %q", gotRider, tt.wantRider)
+			}
+			if tt.delivery.NeedsReview != tt.wantReview {
+				t.Errorf("needsReview = %v, want %v", tt.delivery.NeedsReview, tt.wantReview)
+			}
+			if change.From != before.Status || change.To != tt.wantStatus || change.Event != string(tt.event) || change.ActorUID != tt.in.Actor.UID {
+				t.Errorf("status change = %+v", change)
+			}
+		})
+	}
+}
+
+func TestRecordPINFailure(t *testing.T) {
+	d := delivery(StatusPickedUp, strPtr("rider"))
+	for i := 1; i < MaxPINAttempts; i++ {
+		RecordPINFailure(d)
+		if d.PINLocked {
+			t.Fatalf("locked after %d failures, want %d", i, MaxPINAttempts)
+		}
+	}
+	RecordPINFailure(d)
+	if !d.PINLocked {
+		t.Fatalf("not locked after %d failures", MaxPINAttempts)
+	}
+	_, err := Apply(d, EventDeliver, Input{Actor: Actor{UID: "rider", Role: RoleRider}, DeliveryPIN: "123456"})
+	if !errors.Is(err, ErrPINLocked) {
+		t.Errorf("Apply() with locked PIN error = %v, want %v", err, ErrPINLocked)
+	}
+
+	ResetPIN(d)
+	if d.PINLocked || d.PINAttempts != 0 || len(d.DeliveryPIN) != pinDigits {
+		t.Errorf("after ResetPIN: locked=%v attempts=%d pin=%q", d.PINLocked, d.PINAttempts, d.DeliveryPIN)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	d := &model.Delivery{}
+	change := Create(d, Actor{UID: "sender", Role: RoleSender})
+	if d.Status != StatusPending || len(d.DeliveryPIN) != pinDigits {
+		t.Errorf("after Create: status=%q pin=%q", d.Status, d.DeliveryPIN)
+	}
+	if change.From != "" || change.To != StatusPending || change.Event != string(EventCreate) {
+		t.Errorf("status change = %+v", change)
+	}
+}
@@ -4,23 +4,58 @@ import (
 	"log"
 
 	"api-flash-dash/database" // <-- import database
+	"api-flash-dash/earnings"
+	"api-flash-dash/events"
+	"api-flash-dash/export"
+	"api-flash-dash/geo"
+	"api-flash-dash/geocode"
 	"api-flash-dash/handler"
+	"api-flash-dash/identity"
+	"api-flash-dash/middleware"
+	"api-flash-dash/otp"
+	"api-flash-dash/pricing"
 	"api-flash-dash/router"
 )
 
 func main() {
-	// 1. เรียกใช้ฟังก์ชันเชื่อมต่อฐานข้อมูลจากแพ็กเกจ database
-	firestoreClient, authClient, err := database.InitFirebase()
+	// 1. เรียกใช้ฟังก์ชันเชื่อมต่อ Firebase และฐานข้อมูลจากแพ็กเกจ database
+	app, authClient, err := database.InitFirebase()
+	if err != nil {
+		log.Fatalf("Could not initialize Firebase: %v", err)
+	}
+	stores, closeStore, err := database.InitStore(app)
 	if err != nil {
 		log.Fatalf("Could not initialize database: %v", err)
 	}
-	defer firestoreClient.Close() // defer ยังคงอยู่ที่นี่
+	defer closeStore() // defer ยังคงอยู่ที่นี่
 	log.Println("Successfully connected to Firebase services!")
+	geocoder, err := geocode.LoadResolver()
+	if err != nil {
+		log.Fatalf("Could not initialize geocoder: %v", err)
+	}
 
-	// 2. สร้าง Handler (เหมือนเดิม)
+	// 2. สร้าง Handler โดยส่ง store แต่ละตัวเข้าไป
 	authHandler := &handler.AuthHandler{
-		FirestoreClient: firestoreClient,
-		AuthClient:      authClient,
+		Users:         stores.Users,
+		Addresses:     stores.Addresses,
+		Riders:        stores.Riders,
+		Deliveries:    stores.Deliveries,
+		Notifications: stores.Notifications,
+		Ledger:        stores.Ledger,
+		Events:        events.NewBus(),
+		Pricing:       pricing.NewEngine(pricing.LoadConfig(), pricing.HaversineRouter{}),
+		Geofence:      geo.LoadFence(),
+		Earnings:      earnings.LoadConfig(),
+		Verifications: stores.Verifications,
+		OTP:           otp.LoadConfig(),
+		SMS:           otp.LoadSender(),
+		Identity:      identity.LoadClient(),
+		Exports:       stores.Exports,
+		ExportFiles:   export.LoadStorage(),
+		Export:        export.LoadConfig(),
+		Geocoder:      geocoder,
+		AuthClient:    authClient,
+		CheckRevoked:  middleware.CheckRevokedFromEnv(),
 	}
 
 	// 3. เรียกใช้ฟังก์ชัน SetupRouter (เหมือนเดิม)
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"api-flash-dash/phone"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TrustedProxiesFromEnv อ่าน TRUSTED_PROXIES (IP หรือ CIDR คั่นด้วยจุลภาค) สำหรับ gin.Engine.SetTrustedProxies
+// ค่าว่าง = ไม่เชื่อ proxy ใดเลย c.ClientIP() จะเป็น IP ที่ต่อเข้ามาตรงๆ และไม่สนใจ X-Forwarded-For
+// (ถ้าเชื่อทุก proxy ผู้เรียกจะปลอม X-Forwarded-For ให้ได้ตัวนับของ RateLimit ใหม่ทุกคำขอ)
+func TrustedProxiesFromEnv() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// RateLimit คือ 'ด่านตรวจ' จำกัดจำนวนคำขอต่อ IP ภายในช่วงเวลา (fixed window)
+// ใช้กับเส้นทางที่ไม่ต้องล็อกอินแต่มีต้นทุน เช่น การส่ง SMS OTP
+// ตัวนับเก็บในหน่วยความจำของแต่ละ instance (ถ้ารันหลาย instance ขีดจำกัดจริงจะคูณตามจำนวน instance)
+// IP มาจาก c.ClientIP() จึงต้องตั้ง proxy ที่เชื่อถือได้ให้ถูกต้อง (ดู TrustedProxiesFromEnv)
+func RateLimit(limit int, window time.Duration) gin.HandlerFunc {
+	return rateLimit(limit, window, func(c *gin.Context) string { return c.ClientIP() })
+}
+
+// PhoneRateLimit จำกัดจำนวนคำขอต่อเบอร์โทรในฟิลด์ "phone" ของ JSON body (ใช้คู่กับ RateLimit)
+// กันการยิงใส่เบอร์เดียวจากหลาย IP เบอร์ถูกแปลงเป็น E.164 ก่อน เพื่อให้เขียนเบอร์ต่างรูปแบบแล้วได้ตัวนับเดียวกัน
+// คำขอที่ไม่มีเบอร์หรือเบอร์ไม่ถูกต้องผ่านไปได้ (handler จะตอบ 400 เอง)
+func PhoneRateLimit(limit int, window time.Duration) gin.HandlerFunc {
+	return rateLimit(limit, window, func(c *gin.Context) string {
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			return ""
+		}
+		// คืน body ให้ handler อ่านต่อได้
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		var payload struct {
+			Phone string `json:"phone"`
+		}
+		if json.Unmarshal(body, &payload) != nil {
+			return ""
+		}
+		normalized, err := phone.Normalize(payload.Phone)
+		if err != nil {
+			return ""
+		}
+		return normalized
+	})
+}
+
+// rateLimit คือตัวนับแบบ fixed window ตาม key ที่ได้จาก keyOf (key ว่าง = ไม่นับ)
+func rateLimit(limit int, window time.Duration, keyOf func(c *gin.Context) string) gin.HandlerFunc {
+	type bucket struct {
+		start time.Time
+		count int
+	}
+	var mu sync.Mutex
+	buckets := make(map[string]*bucket)
+	lastSweep := time.Now()
+
+	return func(c *gin.Context) {
+		now := time.Now()
+		key := keyOf(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		mu.Lock()
+		// ล้างตัวนับที่หมดช่วงเวลาแล้วเป็นระยะ ไม่ให้ map โตไม่สิ้นสุด
+		if now.Sub(lastSweep) > window {
+			for k, b := range buckets {
+				if now.Sub(b.start) >= window {
+					delete(buckets, k)
+				}
+			}
+			lastSweep = now
+		}
+		b, ok := buckets[key]
+		if !ok || now.Sub(b.start) >= window {
+			b = &bucket{start: now}
+			buckets[key] = b
+		}
+		b.count++
+		count, retryAfter := b.count, b.start.Add(window).Sub(now)
+		mu.Unlock()
+
+		if count > limit {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, please try again later", "retryAfterSeconds": seconds})
+			return
+		}
+		c.Next()
+	}
+}
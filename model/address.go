@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 // Coordinates ใช้สำหรับเก็บข้อมูลพิกัด GPS
 type Coordinates struct {
 	Latitude  float64 `json:"latitude" firestore:"latitude" binding:"required"`
@@ -8,16 +10,83 @@ type Coordinates struct {
 
 // AddressPayload คือข้อมูลที่แอปจะส่งมาเมื่อ "สร้าง" หรือ "อัปเดต" ที่อยู่
 // จะไม่มีฟิลด์ ID เพราะเราไม่ได้ส่ง ID มากับข้อมูลส่วนนี้
+// ส่งมาแค่ข้อความหรือแค่พิกัดก็ได้ถ้าเปิด geocoder ไว้ (ดู geocode.Resolver) จึงไม่บังคับด้วย binding
 type AddressPayload struct {
-	Detail      string      `json:"detail" firestore:"detail" binding:"required"`
-	Coordinates Coordinates `json:"coordinates" firestore:"coordinates" binding:"required"`
+	Detail      string      `json:"detail" firestore:"detail"`
+	Coordinates Coordinates `json:"coordinates" firestore:"coordinates" binding:"-"`
+	Label       string      `json:"label,omitempty" firestore:"label,omitempty" binding:"max=40"` // เช่น "บ้าน", "ที่ทำงาน"
+	// IsDefault ที่อยู่หลัก (มีได้ 1 ที่ต่อผู้ใช้) เปลี่ยนที่อยู่หลักผ่าน POST /api/user/addresses/{addressId}/default
+	IsDefault bool `json:"isDefault" firestore:"isDefault"`
+	// ผู้ติดต่อ ณ ที่อยู่นี้ (ถ้าไม่ใช่เจ้าของบัญชี) และคำแนะนำสำหรับไรเดอร์ เช่น รหัสประตู ตึก ชั้น
+	ContactName  string `json:"contactName,omitempty" firestore:"contactName,omitempty" binding:"max=100"`
+	ContactPhone string `json:"contactPhone,omitempty" firestore:"contactPhone,omitempty"` // เซิร์ฟเวอร์แปลงเป็น E.164
+	AccessNotes  string `json:"accessNotes,omitempty" firestore:"accessNotes,omitempty" binding:"max=500"`
+	// Geocode คือผลการตรวจของเซิร์ฟเวอร์ แอปส่งค่านี้มาเองไม่ได้
+	Geocode *GeocodeCheck `json:"-" firestore:"geocode,omitempty"`
+}
+
+// HasCoordinates บอกว่าแอปส่งพิกัดมาหรือไม่ (พิกัด 0,0 อยู่กลางทะเล จึงถือว่าไม่ได้ส่งมา)
+func (a AddressPayload) HasCoordinates() bool {
+	return a.Coordinates != (Coordinates{})
 }
 
 // Address คือโครงสร้างข้อมูลสำหรับที่อยู่ 1 แห่งแบบสมบูรณ์
 // ใช้สำหรับ "ส่งข้อมูลกลับ" ไปให้แอป (เช่น ตอน Login หรือหลังอัปเดต)
+// ถูกคัดลอกไปเก็บใน delivery ด้วย (ดู Snapshot) การแก้ไขหรือลบที่อยู่ภายหลังจึงไม่กระทบ delivery เดิม
 type Address struct {
 	// ID จะถูกดึงมาจาก Document ID ของ Firestore
-	ID          string      `json:"id" firestore:"-"` // firestore:"-" บอกให้ Firestore ไม่ต้องสนใจฟิลด์นี้
-	Detail      string      `json:"detail" firestore:"detail"`
-	Coordinates Coordinates `json:"coordinates" firestore:"coordinates"`
+	ID           string      `json:"id" firestore:"-"` // firestore:"-" บอกให้ Firestore ไม่ต้องสนใจฟิลด์นี้
+	Detail       string      `json:"detail" firestore:"detail"`
+	Coordinates  Coordinates `json:"coordinates" firestore:"coordinates"`
+	Label        string      `json:"label,omitempty" firestore:"label,omitempty"`
+	IsDefault    bool        `json:"isDefault" firestore:"isDefault,omitempty"`
+	ContactName  string      `json:"contactName,omitempty" firestore:"contactName,omitempty"`
+	ContactPhone string      `json:"contactPhone,omitempty" firestore:"contactPhone,omitempty"`
+	AccessNotes  string      `json:"accessNotes,omitempty" firestore:"accessNotes,omitempty"`
+	// Geocode คือผลการตรวจข้อความกับพิกัดตอนบันทึก (ไม่มีถ้าไม่ได้เปิด geocoder)
+	Geocode *GeocodeCheck `json:"geocode,omitempty" firestore:"geocode,omitempty"`
+}
+
+// Snapshot คือสำเนาของที่อยู่สำหรับเก็บไว้ใน delivery
+// ไม่เก็บสถานะที่อยู่หลัก เพราะเป็นสถานะของสมุดที่อยู่ ไม่ใช่ของการจัดส่ง
+func (a Address) Snapshot() Address {
+	a.IsDefault = false
+	return a
+}
+
+// PublicAddresses ตัดข้อมูลผู้ติดต่อและคำแนะนำการเข้าถึงออก ก่อนแสดงที่อยู่ให้ผู้ใช้คนอื่น (เช่น ผู้ส่งที่ค้นหาผู้รับ)
+// ไรเดอร์ยังเห็นข้อมูลเหล่านี้ครบจากสำเนาใน delivery
+func PublicAddresses(addresses []Address) []Address {
+	public := make([]Address, len(addresses))
+	for i, a := range addresses {
+		a.ContactName, a.ContactPhone, a.AccessNotes = "", "", ""
+		public[i] = a
+	}
+	return public
+}
+
+// สถานะผลการตรวจที่อยู่ (GeocodeCheck.Status)
+const (
+	GeocodeVerified          = "verified"           // ข้อความกับพิกัดตรงกัน
+	GeocodeMismatch          = "mismatch"           // พิกัดห่างจากตำแหน่งของข้อความเกินกำหนด
+	GeocodeUnmatched         = "unmatched"          // หาสถานที่จากข้อความไม่พบ จึงตรวจไม่ได้
+	GeocodeUnchecked         = "unchecked"          // ผู้ให้บริการใช้งานไม่ได้ตอนบันทึก
+	GeocodeFilledCoordinates = "filled_coordinates" // เซิร์ฟเวอร์เติมพิกัดจากข้อความ
+	GeocodeFilledDetail      = "filled_detail"      // เซิร์ฟเวอร์เติมข้อความจากพิกัด
+)
+
+// GeocodeCheck คือผลการตรวจ/เติมที่อยู่ด้วย geocoder
+// ที่อยู่ที่ Status เป็น mismatch ยังบันทึกได้ (ผู้ใช้อาจปักหมุดที่ประตูหลังของอาคาร) แต่แอปควรเตือนให้ตรวจสอบ
+type GeocodeCheck struct {
+	Status             string       `json:"status" firestore:"status"`
+	Provider           string       `json:"provider" firestore:"provider"`
+	MatchedText        string       `json:"matchedText,omitempty" firestore:"matchedText,omitempty"`
+	MatchedCoordinates *Coordinates `json:"matchedCoordinates,omitempty" firestore:"matchedCoordinates,omitempty"`
+	DistanceM          *float64     `json:"distanceMeters,omitempty" firestore:"distanceMeters,omitempty"`
+	CheckedAt          time.Time    `json:"checkedAt" firestore:"checkedAt"`
+}
+
+// Mismatch บอกว่าพิกัดไม่ตรงกับข้อความที่อยู่
+func (g *GeocodeCheck) Mismatch() bool {
+	return g != nil && g.Status == GeocodeMismatch
 }
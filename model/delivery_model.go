@@ -1,6 +1,9 @@
 package model
 
-import "time"
+import (
+	"math"
+	"time"
+)
 
 // CreateDeliveryPayload คือข้อมูลทั้งหมดที่แอปต้องส่งมาเพื่อสร้างการจัดส่งใหม่
 // ไม่จำเป็นต้องมี SenderPhone หรือ Status เพราะเซิร์ฟเวอร์จะจัดการเอง
@@ -11,6 +14,7 @@ type CreateDeliveryPayload struct {
 	ItemDescription        string `json:"itemDescription" binding:"required"`
 	ItemImageFilename      string `json:"itemImageFilename" binding:"required"`
 	RiderNoteImageFilename string `json:"riderNoteImageFilename"` // อาจจะไม่มีก็ได้ (Optional)
+	VehicleType            string `json:"vehicleType"`            // ค่าเริ่มต้นคือ "motorcycle"
 }
 
 // Delivery คือโครงสร้างข้อมูลสำหรับการจัดส่ง 1 รายการ
@@ -27,8 +31,102 @@ type Delivery struct {
 	Status          string    `json:"status" firestore:"status"`
 	CreatedAt       time.Time `json:"createdAt" firestore:"createdAt"`
 	RiderUID        *string   `json:"riderUID,omitempty" firestore:"riderUID"` // อาจเป็น nil
-	SenderName      string    `json:"senderName,omitempty"`                    // จะถูกเติมค่าทีหลัง
-	ReceiverName    string    `json:"receiverName,omitempty"`                  // จะถูกเติมค่าทีหลัง
-	SenderImageProfile   string      `json:"senderImageProfile,omitempty"`
-	ReceiverImageProfile string      `json:"receiverImageProfile,omitempty"`
+	PickupImage     string    `json:"pickupImage,omitempty" firestore:"pickupImage,omitempty"`
+	DeliveredImage  string    `json:"deliveredImage,omitempty" firestore:"deliveredImage,omitempty"`
+	CancelReason    string    `json:"cancelReason,omitempty" firestore:"cancelReason,omitempty"`
+	SenderGeohash   string    `json:"-" firestore:"senderGeohash,omitempty"` // geohash ของจุดรับสินค้า ใช้ค้นหางานใกล้ไรเดอร์
+	Fare            *Fare     `json:"fare,omitempty" firestore:"fare,omitempty"` // ค่าส่งที่ล็อกไว้ตอนสร้าง
+	// PIN ยืนยันการรับของ ห้ามส่งออกไปทาง JSON โดยตรง (ดู ReceiverPIN)
+	DeliveryPIN     string    `json:"-" firestore:"deliveryPin,omitempty"`
+	PINAttempts     int       `json:"-" firestore:"pinAttempts"`
+	PINLocked       bool      `json:"pinLocked,omitempty" firestore:"pinLocked"`
+	ReceiverPIN     string    `json:"deliveryPin,omitempty" firestore:"-"` // เติมค่าเฉพาะตอนส่งให้ผู้รับเท่านั้น
+	// ผลการตรวจสอบตำแหน่งไรเดอร์ตอนยืนยันรับ/ส่งของ (ใช้ตอนมีข้อพิพาท)
+	PickupCheck     *LocationCheck `json:"pickupCheck,omitempty" firestore:"pickupCheck,omitempty"`
+	DeliveryCheck   *LocationCheck `json:"deliveryCheck,omitempty" firestore:"deliveryCheck,omitempty"`
+	NeedsReview     bool      `json:"needsReview,omitempty" firestore:"needsReview"` // ยืนยันนอกรัศมีในโหมด "flag"
+	SenderName      string    `json:"senderName,omitempty" firestore:"-"`   // จะถูกเติมค่าทีหลัง
+	ReceiverName    string    `json:"receiverName,omitempty" firestore:"-"` // จะถูกเติมค่าทีหลัง
+	SenderImageProfile   string      `json:"senderImageProfile,omitempty" firestore:"-"`
+	ReceiverImageProfile string      `json:"receiverImageProfile,omitempty" firestore:"-"`
+	RiderName            string         `json:"riderName,omitempty" firestore:"-"`
+	RiderImageProfile    string         `json:"riderImageProfile,omitempty" firestore:"-"`
+	RiderRating          *RatingSummary `json:"riderRating,omitempty" firestore:"-"`
+	// ระยะทาง (กม.) ที่คำนวณตอนส่งข้อมูลให้ไรเดอร์ ไม่ได้เก็บลง Firestore
+	DistanceToPickupKm  *float64 `json:"distanceToPickupKm,omitempty" firestore:"-"`
+	PickupToDropoffKm   *float64 `json:"pickupToDropoffKm,omitempty" firestore:"-"`
+}
+
+// AnonymizeParty แทนที่ uid ของผู้ใช้ที่ลบบัญชีใน delivery นี้ด้วย alias (ตาม PDPA)
+// ที่อยู่ของผู้ใช้คนนั้นจะถูกลบรายละเอียด และปัดพิกัดเหลือ 2 ตำแหน่ง (~1 กม.) ไว้ใช้ทำสถิติ
+// คืนค่า false ถ้าผู้ใช้ไม่ได้เกี่ยวข้องกับ delivery นี้
+func (d *Delivery) AnonymizeParty(uid, alias string) bool {
+	changed := false
+	if d.SenderUID == uid {
+		d.SenderUID = alias
+		d.SenderAddress = anonymizeAddress(d.SenderAddress)
+		changed = true
+	}
+	if d.ReceiverUID == uid {
+		d.ReceiverUID = alias
+		d.ReceiverAddress = anonymizeAddress(d.ReceiverAddress)
+		changed = true
+	}
+	if d.RiderUID != nil && *d.RiderUID == uid {
+		d.RiderUID = &alias
+		changed = true
+	}
+	return changed
+}
+
+func anonymizeAddress(a Address) Address {
+	round := func(v float64) float64 { return math.Round(v*100) / 100 }
+	return Address{
+		ID:          a.ID,
+		Coordinates: Coordinates{Latitude: round(a.Coordinates.Latitude), Longitude: round(a.Coordinates.Longitude)},
+	}
+}
+
+// StatusChange คือประวัติการเปลี่ยนสถานะ 1 ครั้ง
+// เก็บไว้ใน sub-collection "statusHistory" ของ delivery แต่ละรายการ
+type StatusChange struct {
+	ID        string    `json:"id" firestore:"-"`
+	From      string    `json:"from" firestore:"from"` // ว่างเปล่าสำหรับรายการแรก (ตอนสร้าง)
+	To        string    `json:"to" firestore:"to"`
+	Event     string    `json:"event" firestore:"event"`
+	ActorUID  string    `json:"actorUID" firestore:"actorUID"`
+	ActorRole string    `json:"actorRole" firestore:"actorRole"`
+	Reason    string    `json:"reason,omitempty" firestore:"reason,omitempty"`
+	At        time.Time `json:"at" firestore:"at"`
+}
+
+// LocationCheck คือผลการเทียบตำแหน่งไรเดอร์กับจุดรับ/ส่งของ ณ ตอนที่กดยืนยัน
+type LocationCheck struct {
+	Position    *Coordinates `json:"position,omitempty" firestore:"position,omitempty"` // nil ถ้าไม่รู้ตำแหน่งไรเดอร์
+	Source      string       `json:"source" firestore:"source"`                         // "request", "rider_location" หรือ "unknown"
+	DistanceM   *float64     `json:"distanceM,omitempty" firestore:"distanceM,omitempty"`
+	RadiusM     float64      `json:"radiusM" firestore:"radiusM"`
+	WithinRange bool         `json:"withinRange" firestore:"withinRange"`
+	CheckedAt   time.Time    `json:"checkedAt" firestore:"checkedAt"`
+}
+
+// Fare คือค่าส่งที่คำนวณจากระยะทาง (จำนวนเงินเป็นบาทเต็ม)
+// ถูกบันทึกลงเอกสาร delivery ตอนสร้าง และไม่เปลี่ยนแปลงอีก
+type Fare struct {
+	VehicleType string    `json:"vehicleType" firestore:"vehicleType"`
+	DistanceKm  float64   `json:"distanceKm" firestore:"distanceKm"`
+	BaseFee     int       `json:"baseFee" firestore:"baseFee"`
+	DistanceFee int       `json:"distanceFee" firestore:"distanceFee"`
+	Multiplier  float64   `json:"multiplier" firestore:"multiplier"`
+	Total       int       `json:"total" firestore:"total"`
+	Currency    string    `json:"currency" firestore:"currency"`
+	QuotedAt    time.Time `json:"quotedAt" firestore:"quotedAt"`
+}
+
+// QuotePayload คือข้อมูลที่ใช้ขอราคาค่าส่งก่อนสร้างการจัดส่งจริง
+type QuotePayload struct {
+	ReceiverPhone     string `json:"receiverPhone" binding:"required"`
+	SenderAddressID   string `json:"senderAddressId" binding:"required"`
+	ReceiverAddressID string `json:"receiverAddressId" binding:"required"`
+	VehicleType       string `json:"vehicleType"` // ค่าเริ่มต้นคือ "motorcycle"
 }
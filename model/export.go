@@ -0,0 +1,97 @@
+package model
+
+import "time"
+
+// สถานะของงานส่งออกข้อมูลส่วนบุคคล
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// DataExport คืองานส่งออกข้อมูลส่วนบุคคล 1 ครั้ง (collection "dataExports")
+// ตัวไฟล์เก็บแยกไว้ที่ export.Storage เอกสารนี้เก็บเฉพาะสถานะของงาน
+type DataExport struct {
+	ID          string     `json:"id" firestore:"-"`
+	UID         string     `json:"-" firestore:"uid"`
+	Format      string     `json:"format" firestore:"format"` // "json" หรือ "zip"
+	Status      string     `json:"status" firestore:"status"`
+	Error       string     `json:"error,omitempty" firestore:"error,omitempty"`
+	SizeBytes   int64      `json:"sizeBytes,omitempty" firestore:"sizeBytes,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt" firestore:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty" firestore:"completedAt,omitempty"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty" firestore:"expiresAt,omitempty"` // หลังจากนี้ดาวน์โหลดไม่ได้
+}
+
+// IsExpired บอกว่าไฟล์หมดอายุแล้วหรือยัง ณ เวลา now
+func (e DataExport) IsExpired(now time.Time) bool {
+	return e.ExpiresAt != nil && now.After(*e.ExpiresAt)
+}
+
+// IsStale บอกว่างานค้างสถานะ pending นานเกิน timeout (เช่น เซิร์ฟเวอร์ถูก restart ระหว่างทำงาน)
+// งานที่ยังทำอยู่จริงจะถูกยกเลิกเมื่อครบ timeout อยู่แล้ว จึงถือว่างานนี้ล้มเหลว
+func (e DataExport) IsStale(now time.Time, timeout time.Duration) bool {
+	return e.Status == ExportPending && now.Sub(e.CreatedAt) > timeout
+}
+
+// DataExportPayload คือข้อมูลที่ใช้ขอส่งออกข้อมูลส่วนบุคคล
+type DataExportPayload struct {
+	Format string `json:"format" binding:"omitempty,oneof=json zip"` // ค่าเริ่มต้นคือ "json"
+}
+
+// PersonalData คือข้อมูลทั้งหมดที่ระบบเก็บเกี่ยวกับผู้ใช้ 1 คน (สิทธิ์ขอเข้าถึงข้อมูลตาม PDPA)
+type PersonalData struct {
+	GeneratedAt   time.Time        `json:"generatedAt"`
+	Profile       *UserProfile     `json:"profile"`
+	Addresses     []Address        `json:"addresses"`
+	Notifications []Notification   `json:"notifications"`
+	Rider         *Rider           `json:"rider,omitempty"`
+	Ledger        []LedgerEntry    `json:"ledger,omitempty"`
+	Deliveries    []DeliveryRecord `json:"deliveries"`
+}
+
+// DeliveryRecord คือ delivery 1 รายการพร้อมบทบาทของผู้ใช้และประวัติสถานะ
+type DeliveryRecord struct {
+	Role          string         `json:"role"` // "sender", "receiver" หรือ "rider"
+	Delivery      Delivery       `json:"delivery"`
+	StatusHistory []StatusChange `json:"statusHistory"`
+}
+
+// NewDeliveryRecord สร้าง DeliveryRecord สำหรับไฟล์ส่งออกข้อมูลของ uid
+// ไฟล์ต้องมีเฉพาะข้อมูลของผู้ใช้เอง ข้อมูลของคู่กรณีอื่นจึงถูกลบออก: uid (ซึ่งคือเบอร์โทร) ถูกแทนด้วยบทบาท
+// ที่อยู่เหลือแค่พิกัดโดยประมาณ (เหมือน AnonymizeParty) และตำแหน่งของไรเดอร์ตอนยืนยันรับ/ส่งของถูกลบ
+func NewDeliveryRecord(uid, role string, delivery Delivery, history []StatusChange) DeliveryRecord {
+	if delivery.SenderUID != uid {
+		delivery.SenderUID = "sender"
+		delivery.SenderAddress = anonymizeAddress(delivery.SenderAddress)
+	}
+	if delivery.ReceiverUID != uid {
+		delivery.ReceiverUID = "receiver"
+		delivery.ReceiverAddress = anonymizeAddress(delivery.ReceiverAddress)
+	}
+	if delivery.RiderUID != nil && *delivery.RiderUID != uid {
+		rider := "rider"
+		delivery.RiderUID = &rider
+		delivery.PickupCheck = withoutPosition(delivery.PickupCheck)
+		delivery.DeliveryCheck = withoutPosition(delivery.DeliveryCheck)
+	}
+
+	redacted := make([]StatusChange, 0, len(history))
+	for _, change := range history {
+		if change.ActorUID != uid {
+			change.ActorUID = change.ActorRole
+		}
+		redacted = append(redacted, change)
+	}
+	return DeliveryRecord{Role: role, Delivery: delivery, StatusHistory: redacted}
+}
+
+// withoutPosition คืนสำเนาของ check ที่ไม่มีตำแหน่งของไรเดอร์ (ไม่แก้ไขของเดิม)
+func withoutPosition(check *LocationCheck) *LocationCheck {
+	if check == nil {
+		return nil
+	}
+	copied := *check
+	copied.Position = nil
+	return &copied
+}
@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// LedgerEntry คือรายการเดินบัญชีรายได้ของไรเดอร์ 1 รายการ (เพิ่มได้อย่างเดียว ห้ามแก้ไขหรือลบ)
+// Amount เป็นบาท ค่าบวกคือรายได้เข้า ค่าลบคือรายการหัก (ค่าปรับ/ปรับปรุง/จ่ายเงินออก)
+type LedgerEntry struct {
+	ID         string    `json:"id" firestore:"-"`
+	RiderUID   string    `json:"riderUID" firestore:"riderUID"`
+	Type       string    `json:"type" firestore:"type"`
+	Amount     int       `json:"amount" firestore:"amount"`
+	DeliveryID string    `json:"deliveryId,omitempty" firestore:"deliveryId,omitempty"`
+	Note       string    `json:"note,omitempty" firestore:"note,omitempty"`
+	Reference  string    `json:"reference,omitempty" firestore:"reference,omitempty"` // เช่น เลขที่โอนเงิน
+	CreatedBy  string    `json:"createdBy" firestore:"createdBy"`                     // UID ของผู้บันทึก ("system" ถ้าระบบบันทึกเอง)
+	CreatedAt  time.Time `json:"createdAt" firestore:"createdAt"`
+}
+
+// LedgerAdjustmentPayload คือข้อมูลที่แอดมินส่งมาเพื่อบันทึกค่าปรับหรือรายการปรับปรุง
+type LedgerAdjustmentPayload struct {
+	Type       string `json:"type" binding:"required,oneof=penalty adjustment"`
+	Amount     int    `json:"amount" binding:"required"` // ค่าปรับต้องเป็นค่าบวก (ระบบจะหักให้เอง)
+	DeliveryID string `json:"deliveryId"`
+	Note       string `json:"note" binding:"required"`
+}
+
+// PayoutPayload คือข้อมูลที่แอดมินส่งมาเพื่อบันทึกการจ่ายเงินให้ไรเดอร์
+type PayoutPayload struct {
+	Amount    int    `json:"amount" binding:"required,min=1"`
+	Reference string `json:"reference" binding:"required"`
+	Note      string `json:"note"`
+}
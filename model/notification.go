@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// Notification คือข้อความแจ้งเตือนถึงผู้ใช้ 1 รายการ
+// เก็บไว้ใน sub-collection "notifications" ของผู้ใช้แต่ละคน
+type Notification struct {
+	ID         string    `json:"id" firestore:"-"`
+	Type       string    `json:"type" firestore:"type"` // เช่น "delivery_cancelled"
+	DeliveryID string    `json:"deliveryId,omitempty" firestore:"deliveryId,omitempty"`
+	Message    string    `json:"message" firestore:"message"`
+	CreatedAt  time.Time `json:"createdAt" firestore:"createdAt"`
+}
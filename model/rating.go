@@ -0,0 +1,47 @@
+package model
+
+import "time"
+
+// Rating คือคะแนนที่ผู้ส่งหรือผู้รับให้ไรเดอร์หลังจากส่งของสำเร็จ
+// เก็บไว้ใน sub-collection "ratings" ของ riders/{uid} โดยแต่ละคนให้ได้ครั้งเดียวต่อ 1 delivery
+type Rating struct {
+	ID         string    `json:"id" firestore:"-"`
+	DeliveryID string    `json:"deliveryId" firestore:"deliveryId"`
+	RiderUID   string    `json:"riderUID" firestore:"riderUID"`
+	RaterUID   string    `json:"raterUID" firestore:"raterUID"`
+	RaterRole  string    `json:"raterRole" firestore:"raterRole"` // "sender" หรือ "receiver"
+	Score      int       `json:"score" firestore:"score"`
+	Comment    string    `json:"comment,omitempty" firestore:"comment,omitempty"`
+	CreatedAt  time.Time `json:"createdAt" firestore:"createdAt"`
+}
+
+// PublicRating คือรีวิวที่แสดงให้ผู้ใช้คนอื่นเห็น
+// ไม่มี raterUID (เบอร์โทรของผู้ให้คะแนน) และ deliveryId เพื่อไม่ให้โยงรีวิวกลับไปหาลูกค้าได้
+// (ID ของรีวิวมี raterUID อยู่ด้วย จึงตัดออกเช่นกัน)
+type PublicRating struct {
+	RaterRole string    `json:"raterRole"`
+	Score     int       `json:"score"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// PublicRatings แปลงรีวิวเป็นรูปแบบที่แสดงต่อสาธารณะได้ (คืนค่า slice ว่างแทน nil)
+func PublicRatings(ratings []Rating) []PublicRating {
+	public := make([]PublicRating, len(ratings))
+	for i, r := range ratings {
+		public[i] = PublicRating{RaterRole: r.RaterRole, Score: r.Score, Comment: r.Comment, CreatedAt: r.CreatedAt}
+	}
+	return public
+}
+
+// RatingPayload คือข้อมูลที่แอปส่งมาเพื่อให้คะแนนไรเดอร์
+type RatingPayload struct {
+	Score   int    `json:"score" binding:"required,min=1,max=5"`
+	Comment string `json:"comment" binding:"max=500"`
+}
+
+// RatingSummary คือคะแนนเฉลี่ยและจำนวนรีวิวของไรเดอร์
+type RatingSummary struct {
+	Average float64 `json:"average"`
+	Count   int     `json:"count"`
+}
@@ -1,8 +1,122 @@
 package model
 
+import (
+	"time"
+
+	latlng "google.golang.org/genproto/googleapis/type/latlng"
+)
+
+// สถานะการตรวจสอบเอกสารของไรเดอร์
+// ไรเดอร์ที่สมัครใหม่จะเริ่มที่ "pending_verification" และรับงานได้เมื่อแอดมินอนุมัติ ("approved") แล้วเท่านั้น
+const (
+    RiderPendingVerification = "pending_verification"
+    RiderApproved            = "approved"
+    RiderRejected            = "rejected"
+)
+
 type Rider struct {
     ImageVehicle        string `json:"image_vehicle" firestore:"image_vehicle"`
     VehicleRegistration string `json:"vehicle_registration" firestore:"vehicle_registration"`
+    // ข้อมูลการยืนยันตัวตน (ตั้งค่าโดยเซิร์ฟเวอร์เท่านั้น ไม่รับจากแอป)
+    VerificationStatus string         `json:"verificationStatus" firestore:"verificationStatus"`
+    Documents          RiderDocuments `json:"documents" firestore:"documents"`
+    RejectionReason    string         `json:"rejectionReason,omitempty" firestore:"rejectionReason,omitempty"`
+    SubmittedAt        *time.Time     `json:"submittedAt,omitempty" firestore:"submittedAt,omitempty"`
+    ReviewedBy         string         `json:"reviewedBy,omitempty" firestore:"reviewedBy,omitempty"`
+    ReviewedAt         *time.Time     `json:"reviewedAt,omitempty" firestore:"reviewedAt,omitempty"`
+    // ตำแหน่งล่าสุดที่ได้จาก UpdateRiderLocation (ยังไม่มีจนกว่าไรเดอร์จะส่งพิกัดมา)
+    CurrentLocation *latlng.LatLng `json:"currentLocation,omitempty" firestore:"currentLocation,omitempty"`
+    UpdatedAt       *time.Time     `json:"updatedAt,omitempty" firestore:"updatedAt,omitempty"`
+    // จำนวนครั้งที่ไรเดอร์คืนงานหลังจากรับไปแล้ว (ใช้ตรวจจับพฤติกรรมที่ผิดปกติ)
+    ReleaseCount   int        `json:"releaseCount,omitempty" firestore:"releaseCount,omitempty"`
+    LastReleasedAt *time.Time `json:"lastReleasedAt,omitempty" firestore:"lastReleasedAt,omitempty"`
+    // เวลาที่ระบบทำเครื่องหมายให้แอดมินตรวจสอบ เพราะคืนงานบ่อยเกินไป (nil = ไม่ถูกทำเครื่องหมาย)
+    ReleaseFlaggedAt *time.Time `json:"releaseFlaggedAt,omitempty" firestore:"releaseFlaggedAt,omitempty"`
+    // คะแนนรีวิวสะสม (อัปเดตใน Transaction เดียวกับที่บันทึกรีวิว)
+    RatingAverage float64 `json:"ratingAverage" firestore:"ratingAverage"`
+    RatingCount   int     `json:"ratingCount" firestore:"ratingCount"`
+    RatingTotal   int     `json:"-" firestore:"ratingTotal"` // ผลรวมคะแนน ใช้คำนวณค่าเฉลี่ยโดยไม่สะสมความคลาดเคลื่อน
+}
+
+// IsVerified บอกว่าไรเดอร์ผ่านการตรวจสอบเอกสารแล้ว (รับงานได้)
+// ไรเดอร์ที่สมัครก่อนมีการตรวจสอบเอกสาร (สถานะว่าง) ได้รับการอนุมัติผ่าน cmd/backfill-rider-verification
+func (r *Rider) IsVerified() bool {
+    return r.VerificationStatus == RiderApproved
+}
+
+// ApplyVehicleUpdate เปลี่ยนรูปรถและทะเบียนรถ (nil = ไม่เปลี่ยน)
+// ถ้าไรเดอร์ผ่านการตรวจสอบแล้วและข้อมูลรถเปลี่ยนจริง เอกสารที่อนุมัติไว้จะไม่ตรงกับรถคันนี้แล้ว
+// จึงกลับไปรอแอดมินตรวจสอบใหม่ (รับงานไม่ได้จนกว่าจะอนุมัติอีกครั้ง) และคืนค่า true
+func (r *Rider) ApplyVehicleUpdate(imageVehicle, vehicleRegistration *string, now time.Time) bool {
+    changed := false
+    if imageVehicle != nil && *imageVehicle != r.ImageVehicle {
+        r.ImageVehicle = *imageVehicle
+        changed = true
+    }
+    if vehicleRegistration != nil && *vehicleRegistration != r.VehicleRegistration {
+        r.VehicleRegistration = *vehicleRegistration
+        changed = true
+    }
+    if !changed || !r.IsVerified() {
+        return false
+    }
+    r.VerificationStatus = RiderPendingVerification
+    r.SubmittedAt = &now
+    return true
+}
+
+// RecordRelease นับการคืนงาน 1 ครั้ง
+// ถ้าจำนวนครั้งถึง flagAt เป็นครั้งแรก จะทำเครื่องหมายให้แอดมินตรวจสอบ และคืนค่า true
+func (r *Rider) RecordRelease(now time.Time, flagAt int) bool {
+    r.ReleaseCount++
+    r.LastReleasedAt = &now
+    if r.ReleaseCount < flagAt || r.ReleaseFlaggedAt != nil {
+        return false
+    }
+    r.ReleaseFlaggedAt = &now
+    return true
+}
+
+// RiderDocument คือเอกสาร 1 ชิ้นที่ไรเดอร์อัปโหลด (เก็บเป็น URL ของรูป)
+type RiderDocument struct {
+    URL        string    `json:"url" firestore:"url"`
+    UploadedAt time.Time `json:"uploadedAt" firestore:"uploadedAt"`
+}
+
+// RiderDocuments คือเอกสารที่ต้องใช้ยืนยันตัวตนไรเดอร์
+type RiderDocuments struct {
+    DrivingLicence      *RiderDocument `json:"drivingLicence,omitempty" firestore:"drivingLicence,omitempty"`
+    IDCard              *RiderDocument `json:"idCard,omitempty" firestore:"idCard,omitempty"`
+    VehicleRegistration *RiderDocument `json:"vehicleRegistration,omitempty" firestore:"vehicleRegistration,omitempty"`
+}
+
+// Missing คืนรายชื่อเอกสารที่ยังไม่ได้อัปโหลด
+func (d RiderDocuments) Missing() []string {
+    var missing []string
+    if d.DrivingLicence == nil {
+        missing = append(missing, "drivingLicence")
+    }
+    if d.IDCard == nil {
+        missing = append(missing, "idCard")
+    }
+    if d.VehicleRegistration == nil {
+        missing = append(missing, "vehicleRegistration")
+    }
+    return missing
+}
+
+// RiderDocumentsPayload คือ URL ของเอกสารที่ไรเดอร์ส่งมา (ส่งมาเฉพาะชิ้นที่ต้องการอัปเดตได้)
+type RiderDocumentsPayload struct {
+    DrivingLicenceURL      *string `json:"drivingLicenceURL" binding:"omitempty,url"`
+    IDCardURL              *string `json:"idCardURL" binding:"omitempty,url"`
+    VehicleRegistrationURL *string `json:"vehicleRegistrationURL" binding:"omitempty,url"`
+}
+
+// AddRating รวมคะแนนใหม่เข้ากับคะแนนสะสมของไรเดอร์
+func (r *Rider) AddRating(score int) {
+    r.RatingTotal += score
+    r.RatingCount++
+    r.RatingAverage = float64(r.RatingTotal) / float64(r.RatingCount)
 }
 
 
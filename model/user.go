@@ -1,18 +1,36 @@
 package model
 
+import "time"
+
+// บทบาทของผู้ใช้ (ฟิลด์ role ใน "users")
+// "admin" ให้ได้ผ่าน cmd/bootstrap-admin หรือโดยแอดมินคนอื่นเท่านั้น
+const (
+	RoleCustomer = "customer"
+	RoleRider    = "rider"
+	RoleAdmin    = "admin"
+)
+
+// สถานะของบัญชีผู้ใช้ (ค่าว่างถือว่า "active")
+const (
+	AccountActive    = "active"
+	AccountSuspended = "suspended"
+)
+
 // UserCore เก็บข้อมูลพื้นฐานที่ทุกคนต้องมีตอนสมัคร
 // เราจะเพิ่ม ImageProfile เข้ามาในนี้ด้วย
 type UserCore struct {
 	Name         string `json:"name" binding:"required"`
-	Phone        string `json:"phone" binding:"required"` // จะใช้เป็น UID
+	Phone        string `json:"phone" binding:"required"` // จะใช้เป็น UID (เซิร์ฟเวอร์แปลงเป็น E.164 ก่อน)
 	Password     string `json:"password" binding:"required,min=6"`
 	ImageProfile string `json:"image_profile" binding:"required"`
+	// VerificationTicket ได้จาก POST /auth/register/otp/verify (ยืนยันว่าเป็นเจ้าของเบอร์)
+	VerificationTicket string `json:"verificationTicket" binding:"required"`
 }
 
 // RegisterCustomerPayload คือข้อมูลทั้งหมดที่ต้องส่งมาตอนสมัครเป็น Customer
 type RegisterCustomerPayload struct {
 	UserCore
-	Address Address `json:"address" binding:"required"`
+	Address AddressPayload `json:"address" binding:"required"`
 }
 
 // RegisterRiderPayload คือข้อมูลทั้งหมดที่ต้องส่งมาตอนสมัครเป็น Rider
@@ -24,10 +42,20 @@ type RegisterRiderPayload struct {
 // UserProfile ใช้สำหรับแสดงผลข้อมูลผู้ใช้ (ไม่มีรหัสผ่าน)
 // เหมาะสำหรับดึงข้อมูลจาก Firestore กลับมาแสดงผล
 type UserProfile struct {
+	UID          string `json:"-" firestore:"-"` // ID ของ Document
 	Name         string `json:"name" firestore:"name"`
-	Phone        string `json:"phone" firestore:"phone"` // นี่คือ UID
+	Phone        string `json:"phone" firestore:"phone"` // นี่คือ UID (รูปแบบ E.164 เช่น +66812345678)
 	ImageProfile string `json:"image_profile" firestore:"image_profile"`
 	Role         string `json:"role" firestore:"role"`
+	// ข้อมูลการระงับบัญชี (ตั้งค่าโดยแอดมิน)
+	Status          string     `json:"status,omitempty" firestore:"status,omitempty"`
+	SuspendedReason string     `json:"suspendedReason,omitempty" firestore:"suspendedReason,omitempty"`
+	SuspendedAt     *time.Time `json:"suspendedAt,omitempty" firestore:"suspendedAt,omitempty"`
+}
+
+// IsSuspended บอกว่าบัญชีนี้ถูกระงับอยู่หรือไม่
+func (u UserProfile) IsSuspended() bool {
+	return u.Status == AccountSuspended
 }
 
 type UpdateProfilePayload struct {
@@ -36,6 +64,11 @@ type UpdateProfilePayload struct {
 	ImageProfile *string `json:"image_profile"`
 }
 
+// DeleteAccountPayload คือข้อมูลที่ใช้ยืนยันการลบบัญชี (ต้องใส่รหัสผ่านอีกครั้ง)
+type DeleteAccountPayload struct {
+	Password string `json:"password" binding:"required"`
+}
+
 // FindUserResponse คือโครงสร้างข้อมูลที่จะส่งกลับไปเมื่อค้นหาผู้ใช้เจอ
 type FindUserResponse struct {
     Name         string    `json:"name"`
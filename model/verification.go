@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+// PhoneVerification คือสถานะการยืนยันเบอร์โทรด้วย OTP (collection "phoneVerifications")
+// 1 เอกสารต่อ 1 เบอร์ต่อ 1 จุดประสงค์ (ดู store.VerificationID)
+// เก็บเฉพาะค่า hash ของรหัส OTP และ ticket ไม่เก็บค่าจริง
+type PhoneVerification struct {
+	Phone   string `json:"phone" firestore:"phone"`
+	Purpose string `json:"purpose" firestore:"purpose"`
+
+	// รหัส OTP ที่ส่งล่าสุด
+	CodeHash      string    `json:"-" firestore:"codeHash"`
+	CodeExpiresAt time.Time `json:"codeExpiresAt" firestore:"codeExpiresAt"`
+	Attempts      int       `json:"attempts" firestore:"attempts"`
+
+	// การจำกัดการส่งซ้ำ
+	LastSentAt      time.Time `json:"lastSentAt" firestore:"lastSentAt"`
+	SendWindowStart time.Time `json:"sendWindowStart" firestore:"sendWindowStart"`
+	SendCount       int       `json:"sendCount" firestore:"sendCount"`
+
+	// ticket ที่ได้หลังยืนยันรหัสถูกต้อง ใช้ได้ครั้งเดียว
+	TicketHash      string    `json:"-" firestore:"ticketHash"`
+	TicketExpiresAt time.Time `json:"ticketExpiresAt" firestore:"ticketExpiresAt"`
+}
+
+// OTPRequestPayload คือข้อมูลที่ใช้ขอรหัส OTP
+type OTPRequestPayload struct {
+	Phone string `json:"phone" binding:"required"`
+}
+
+// OTPVerifyPayload คือข้อมูลที่ใช้ยืนยันรหัส OTP
+type OTPVerifyPayload struct {
+	Phone string `json:"phone" binding:"required"`
+	Code  string `json:"code" binding:"required"`
+}
+
+// PasswordResetPayload คือข้อมูลที่ใช้ตั้งรหัสผ่านใหม่ (resetTicket ได้จาก POST /auth/password/reset/verify)
+type PasswordResetPayload struct {
+	Phone       string `json:"phone" binding:"required"`
+	ResetTicket string `json:"resetTicket" binding:"required"`
+	NewPassword string `json:"newPassword" binding:"required,min=6"`
+}
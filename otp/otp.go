@@ -0,0 +1,212 @@
+// Package otp จัดการรหัสยืนยันทาง SMS (OTP) และ ticket ที่ได้หลังยืนยันสำเร็จ
+// ฟังก์ชันในแพ็กเกจนี้แก้ไข model.PhoneVerification อย่างเดียว การอ่าน/เขียนเป็นหน้าที่ของ store
+// (เรียกภายใน store.VerificationStore.UpdatePhoneVerification เพื่อให้อยู่ใน Transaction)
+package otp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"time"
+
+	"api-flash-dash/model"
+)
+
+// จุดประสงค์ของ OTP (รหัสที่ขอไว้สำหรับงานหนึ่งใช้กับอีกงานไม่ได้)
+const (
+	PurposeRegister      = "register"
+	PurposePasswordReset = "password_reset"
+)
+
+// ค่าเริ่มต้นของการตั้งค่า
+const (
+	CodeLength            = 6
+	DefaultCodeTTL        = 5 * time.Minute
+	DefaultMaxAttempts    = 5
+	DefaultResendInterval = 60 * time.Second
+	DefaultMaxSends       = 5 // ต่อ SendWindow
+	SendWindow            = time.Hour
+	DefaultTicketTTL      = 15 * time.Minute
+	DefaultResetTicketTTL = 5 * time.Minute // ticket รีเซ็ตรหัสผ่านมีอายุสั้นกว่า
+)
+
+var (
+	ErrResendTooSoon   = errors.New("otp: a code was sent recently, wait before requesting another")
+	ErrTooManySends    = errors.New("otp: too many codes requested for this phone, try again later")
+	ErrNoCode          = errors.New("otp: no code has been requested for this phone")
+	ErrCodeExpired     = errors.New("otp: the code has expired, request a new one")
+	ErrInvalidCode     = errors.New("otp: incorrect code")
+	ErrTooManyAttempts = errors.New("otp: too many incorrect attempts, request a new code")
+	ErrInvalidTicket   = errors.New("otp: verification ticket is invalid or has already been used")
+	ErrTicketExpired   = errors.New("otp: verification ticket has expired, verify the phone again")
+)
+
+// Config คือการตั้งค่าอายุรหัส จำนวนครั้งที่ลองได้ และการจำกัดการส่ง
+type Config struct {
+	CodeTTL        time.Duration
+	MaxAttempts    int
+	ResendInterval time.Duration
+	MaxSends       int
+	TicketTTL      time.Duration
+	ResetTicketTTL time.Duration
+}
+
+// LoadConfig อ่านการตั้งค่าจาก Environment Variable (OTP_CODE_TTL_SECONDS, OTP_MAX_ATTEMPTS,
+// OTP_RESEND_INTERVAL_SECONDS, OTP_MAX_SENDS_PER_HOUR, OTP_TICKET_TTL_SECONDS, OTP_RESET_TICKET_TTL_SECONDS)
+func LoadConfig() Config {
+	return Config{
+		CodeTTL:        envSeconds("OTP_CODE_TTL_SECONDS", DefaultCodeTTL),
+		MaxAttempts:    envInt("OTP_MAX_ATTEMPTS", DefaultMaxAttempts),
+		ResendInterval: envSeconds("OTP_RESEND_INTERVAL_SECONDS", DefaultResendInterval),
+		MaxSends:       envInt("OTP_MAX_SENDS_PER_HOUR", DefaultMaxSends),
+		TicketTTL:      envSeconds("OTP_TICKET_TTL_SECONDS", DefaultTicketTTL),
+		ResetTicketTTL: envSeconds("OTP_RESET_TICKET_TTL_SECONDS", DefaultResetTicketTTL),
+	}
+}
+
+// TicketTTLFor คืออายุของ ticket ตามจุดประสงค์
+func (cfg Config) TicketTTLFor(purpose string) time.Duration {
+	if purpose == PurposePasswordReset {
+		return cfg.ResetTicketTTL
+	}
+	return cfg.TicketTTL
+}
+
+func envInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return fallback
+}
+
+func envSeconds(key string, fallback time.Duration) time.Duration {
+	return time.Duration(envInt(key, int(fallback/time.Second))) * time.Second
+}
+
+// Issue สร้างรหัสใหม่ให้ v และคืนค่ารหัสจริงเพื่อส่ง SMS (ใน v เก็บแค่ hash)
+// รหัสเดิมและ ticket เดิมจะใช้ไม่ได้อีก
+// ถ้าขอถี่เกินไปจะคืนค่า ErrResendTooSoon หรือ ErrTooManySends และไม่แก้ไข v
+func Issue(v *model.PhoneVerification, cfg Config, now time.Time) (string, error) {
+	// 1. จำกัดการส่งซ้ำ: เว้นระยะขั้นต่ำ และจำนวนครั้งต่อชั่วโมง
+	if !v.LastSentAt.IsZero() && now.Sub(v.LastSentAt) < cfg.ResendInterval {
+		return "", ErrResendTooSoon
+	}
+	if now.Sub(v.SendWindowStart) >= SendWindow {
+		v.SendWindowStart = now
+		v.SendCount = 0
+	}
+	if v.SendCount >= cfg.MaxSends {
+		return "", ErrTooManySends
+	}
+
+	// 2. สุ่มรหัสตัวเลข
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	code := fmt.Sprintf("%0*d", CodeLength, n.Int64())
+
+	v.CodeHash = digest(v, code)
+	v.CodeExpiresAt = now.Add(cfg.CodeTTL)
+	v.Attempts = 0
+	v.LastSentAt = now
+	v.SendCount++
+	v.TicketHash = ""
+	v.TicketExpiresAt = time.Time{}
+	return code, nil
+}
+
+// RetryAfter คือเวลาที่ต้องรอก่อนขอรหัสใหม่ได้ (0 = ขอได้เลย)
+func RetryAfter(v *model.PhoneVerification, cfg Config, now time.Time) time.Duration {
+	if v.SendCount >= cfg.MaxSends && now.Sub(v.SendWindowStart) < SendWindow {
+		return v.SendWindowStart.Add(SendWindow).Sub(now)
+	}
+	if wait := v.LastSentAt.Add(cfg.ResendInterval).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// Verify ตรวจรหัสที่ผู้ใช้กรอก ถ้าถูกต้องจะคืนค่า ticket (ใช้ได้ครั้งเดียวภายใน TicketTTLFor)
+// ถ้ารหัสผิด v.Attempts จะเพิ่มขึ้น ผู้เรียกต้องบันทึก v แม้จะได้ error กลับไป
+func Verify(v *model.PhoneVerification, code string, cfg Config, now time.Time) (string, error) {
+	if v.CodeHash == "" {
+		return "", ErrNoCode
+	}
+	if v.Attempts >= cfg.MaxAttempts {
+		return "", ErrTooManyAttempts
+	}
+	if now.After(v.CodeExpiresAt) {
+		return "", ErrCodeExpired
+	}
+	if subtle.ConstantTimeCompare([]byte(digest(v, code)), []byte(v.CodeHash)) != 1 {
+		v.Attempts++
+		if v.Attempts >= cfg.MaxAttempts {
+			return "", ErrTooManyAttempts
+		}
+		return "", ErrInvalidCode
+	}
+
+	// รหัสถูกต้อง: ใช้ซ้ำไม่ได้ แลกเป็น ticket แทน
+	ticket, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	v.CodeHash = ""
+	v.Attempts = 0
+	v.TicketHash = digest(v, ticket)
+	v.TicketExpiresAt = now.Add(cfg.TicketTTLFor(v.Purpose))
+	return ticket, nil
+}
+
+// AttemptsRemaining คือจำนวนครั้งที่ยังกรอกรหัสผิดได้
+func AttemptsRemaining(v *model.PhoneVerification, cfg Config) int {
+	if remaining := cfg.MaxAttempts - v.Attempts; remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// Redeem ใช้ ticket (ครั้งเดียว) ถ้าถูกต้อง ticket จะถูกลบออกจาก v
+func Redeem(v *model.PhoneVerification, ticket string, now time.Time) error {
+	if ticket == "" || v.TicketHash == "" || subtle.ConstantTimeCompare([]byte(digest(v, ticket)), []byte(v.TicketHash)) != 1 {
+		return ErrInvalidTicket
+	}
+	if now.After(v.TicketExpiresAt) {
+		return ErrTicketExpired
+	}
+	v.TicketHash = ""
+	v.TicketExpiresAt = time.Time{}
+	return nil
+}
+
+// Restore คืน ticket ที่ถูกใช้ไปแล้วให้ใช้ได้อีกครั้งจนถึงเวลาหมดอายุเดิม
+// ใช้เมื่อขั้นตอนหลังจากใช้ ticket ล้มเหลวและถูกย้อนกลับ (ดู handler.registration)
+// ถ้ามี ticket ใหม่ออกไปแล้วจะไม่เขียนทับ
+func Restore(v *model.PhoneVerification, ticket string, expiresAt time.Time) {
+	if v.TicketHash != "" {
+		return
+	}
+	v.TicketHash = digest(v, ticket)
+	v.TicketExpiresAt = expiresAt
+}
+
+// digest ผูก hash กับเบอร์และจุดประสงค์ เพื่อไม่ให้นำค่าไปใช้ข้ามเอกสารได้
+func digest(v *model.PhoneVerification, secret string) string {
+	sum := sha256.Sum256([]byte(v.Purpose + ":" + v.Phone + ":" + secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
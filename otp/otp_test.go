@@ -0,0 +1,191 @@
+package otp
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"api-flash-dash/model"
+)
+
+var testConfig = Config{
+	CodeTTL:        5 * time.Minute,
+	MaxAttempts:    3,
+	ResendInterval: time.Minute,
+	MaxSends:       2,
+	TicketTTL:      15 * time.Minute,
+	ResetTicketTTL: 5 * time.Minute,
+}
+
+var t0 = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func newVerification(purpose string) *model.PhoneVerification {
+	return &model.PhoneVerification{Phone: "+66812345678", Purpose: purpose}
+}
+
+func TestIssue(t *testing.T) {
+	tests := []struct {
+		name  string
+		sends []time.Duration // เวลาที่ขอรหัสแต่ละครั้ง นับจาก t0
+		err   error           // error ของครั้งสุดท้าย
+	}{
+		{name: "first send", sends: []time.Duration{0}},
+		{name: "resend too soon", sends: []time.Duration{0, 30 * time.Second}, err: ErrResendTooSoon},
+		{name: "resend after interval", sends: []time.Duration{0, time.Minute}},
+		{name: "too many sends in window", sends: []time.Duration{0, time.Minute, 2 * time.Minute}, err: ErrTooManySends},
+		{name: "window resets", sends: []time.Duration{0, time.Minute, SendWindow}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newVerification(PurposeRegister)
+			var code string
+			var err error
+			for _, at := range tt.sends {
+				code, err = Issue(v, testConfig, t0.Add(at))
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Issue() error = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+			if len(code) != CodeLength {
+				t.Errorf("code %q has length %d, want %d", code, len(code), CodeLength)
+			}
+			if v.CodeHash == "" || v.CodeHash == code {
+				t.Errorf("CodeHash = %q, want a hash of the code", v.CodeHash)
+			}
+		})
+	}
+}
+
+func TestIssueInvalidatesTicket(t *testing.T) {
+	v := newVerification(PurposeRegister)
+	code, _ := Issue(v, testConfig, t0)
+	ticket, err := Verify(v, code, testConfig, t0)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if _, err := Issue(v, testConfig, t0.Add(time.Minute)); err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if err := Redeem(v, ticket, t0.Add(time.Minute)); !errors.Is(err, ErrInvalidTicket) {
+		t.Errorf("Redeem() after reissue error = %v, want %v", err, ErrInvalidTicket)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name     string
+		issue    bool
+		attempts []string // รหัสที่กรอกก่อนครั้งสุดท้าย ("" = รหัสจริง)
+		code     string   // ครั้งสุดท้าย ("" = รหัสจริง)
+		at       time.Duration
+		err      error
+	}{
+		{name: "correct code", issue: true},
+		{name: "no code requested", err: ErrNoCode},
+		{name: "wrong code", issue: true, code: "wrong", err: ErrInvalidCode},
+		{name: "expired", issue: true, at: 5*time.Minute + time.Second, err: ErrCodeExpired},
+		{name: "last wrong attempt locks", issue: true, attempts: []string{"bad", "bad"}, code: "bad", err: ErrTooManyAttempts},
+		{name: "locked rejects correct code", issue: true, attempts: []string{"bad", "bad", "bad"}, err: ErrTooManyAttempts},
+		{name: "correct code after wrong attempt", issue: true, attempts: []string{"bad"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newVerification(PurposeRegister)
+			var real string
+			if tt.issue {
+				real, _ = Issue(v, testConfig, t0)
+			}
+			for _, attempt := range tt.attempts {
+				Verify(v, attempt, testConfig, t0)
+			}
+			code := tt.code
+			if code == "" {
+				code = real
+			}
+			ticket, err := Verify(v, code, testConfig, t0.Add(tt.at))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+			if ticket == "" || v.TicketHash == "" || v.CodeHash != "" {
+				t.Errorf("after Verify: ticket=%q TicketHash=%q CodeHash=%q", ticket, v.TicketHash, v.CodeHash)
+			}
+			// รหัสใช้ซ้ำไม่ได้
+			if _, err := Verify(v, real, testConfig, t0); !errors.Is(err, ErrNoCode) {
+				t.Errorf("reusing code error = %v, want %v", err, ErrNoCode)
+			}
+		})
+	}
+}
+
+func TestVerifyTicketTTL(t *testing.T) {
+	for purpose, ttl := range map[string]time.Duration{
+		PurposeRegister:      testConfig.TicketTTL,
+		PurposePasswordReset: testConfig.ResetTicketTTL,
+	} {
+		v := newVerification(purpose)
+		code, _ := Issue(v, testConfig, t0)
+		if _, err := Verify(v, code, testConfig, t0); err != nil {
+			t.Fatalf("%s: Verify() error = %v", purpose, err)
+		}
+		if got := v.TicketExpiresAt.Sub(t0); got != ttl {
+			t.Errorf("%s: ticket TTL = %v, want %v", purpose, got, ttl)
+		}
+	}
+}
+
+func TestRedeem(t *testing.T) {
+	tests := []struct {
+		name   string
+		ticket string // "" = ticket จริง
+		at     time.Duration
+		twice  bool
+		err    error
+	}{
+		{name: "valid ticket"},
+		{name: "wrong ticket", ticket: "nope", err: ErrInvalidTicket},
+		{name: "expired ticket", at: testConfig.TicketTTL + time.Second, err: ErrTicketExpired},
+		{name: "ticket used twice", twice: true, err: ErrInvalidTicket},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newVerification(PurposeRegister)
+			code, _ := Issue(v, testConfig, t0)
+			ticket, err := Verify(v, code, testConfig, t0)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if tt.ticket != "" {
+				ticket = tt.ticket
+			}
+			if tt.twice {
+				if err := Redeem(v, ticket, t0); err != nil {
+					t.Fatalf("first Redeem() error = %v", err)
+				}
+			}
+			if err := Redeem(v, ticket, t0.Add(tt.at)); !errors.Is(err, tt.err) {
+				t.Errorf("Redeem() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRedeemOtherPhone(t *testing.T) {
+	v := newVerification(PurposeRegister)
+	code, _ := Issue(v, testConfig, t0)
+	ticket, _ := Verify(v, code, testConfig, t0)
+
+	// ticket ของเบอร์หนึ่งใช้กับอีกเบอร์ไม่ได้ แม้ hash จะถูกคัดลอกไป
+	other := newVerification(PurposeRegister)
+	other.Phone = "+66898765432"
+	other.TicketHash = v.TicketHash
+	other.TicketExpiresAt = v.TicketExpiresAt
+	if err := Redeem(other, ticket, t0); !errors.Is(err, ErrInvalidTicket) {
+		t.Errorf("Redeem() on another phone error = %v, want %v", err, ErrInvalidTicket)
+	}
+}
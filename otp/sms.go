@@ -0,0 +1,73 @@
+package otp
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Sender ส่งข้อความ SMS ไปยังเบอร์ปลายทาง (รูปแบบ E.164)
+// ต่อกับผู้ให้บริการ SMS จริงได้โดย implement interface นี้แล้วเลือกใช้ใน LoadSender
+type Sender interface {
+	Send(ctx context.Context, to, message string) error
+}
+
+// ConsoleSender พิมพ์ข้อความลง log แทนการส่งจริง (สำหรับพัฒนาบนเครื่อง)
+type ConsoleSender struct{}
+
+func (ConsoleSender) Send(ctx context.Context, to, message string) error {
+	log.Printf("[SMS to %s] %s", to, message)
+	return nil
+}
+
+// FileSender เขียนข้อความต่อท้ายไฟล์ (outbox) แทนการส่งจริง
+// เหมาะกับการทดสอบอัตโนมัติที่ต้องอ่านรหัส OTP กลับมา
+type FileSender struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (s *FileSender) Send(ctx context.Context, to, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%s\t%s\t%s\n", time.Now().Format(time.RFC3339), to, message)
+	return err
+}
+
+// LoadSender เลือกช่องทางส่ง SMS จาก SMS_SENDER ("console" หรือ "file") ต้องตั้งค่าเองเสมอ
+// ทั้งสองโหมดไม่ได้ส่ง SMS จริงและเก็บรหัส OTP เป็นข้อความธรรมดา จึงไม่มีค่าเริ่มต้น
+// เพื่อไม่ให้ production ที่ลืมตั้งค่าเขียนรหัส OTP ลง log โดยไม่มีใครรู้
+// โหมด "file" เขียนลงไฟล์ตาม SMS_OUTBOX_PATH (ค่าเริ่มต้น sms_outbox.log)
+func LoadSender() Sender {
+	switch mode := os.Getenv("SMS_SENDER"); mode {
+	case "":
+		log.Fatalf("SMS_SENDER is not set (use \"console\" or \"file\" for development, OTP codes are not sent as real SMS)")
+		return nil
+	case "console":
+		log.Printf("WARNING: SMS_SENDER=console, OTP codes are written to the server log instead of being sent")
+		return ConsoleSender{}
+	case "file":
+		path := os.Getenv("SMS_OUTBOX_PATH")
+		if path == "" {
+			path = "sms_outbox.log"
+		}
+		log.Printf("WARNING: SMS_SENDER=file, OTP codes are written to %s instead of being sent", path)
+		return &FileSender{Path: path}
+	default:
+		log.Fatalf("Unknown SMS_SENDER %q (expected \"console\" or \"file\")", mode)
+		return nil
+	}
+}
+
+// Message คือข้อความ SMS ที่มีรหัส OTP
+func Message(code string, ttl time.Duration) string {
+	return fmt.Sprintf("รหัสยืนยัน FlashDash ของคุณคือ %s (หมดอายุใน %d นาที) ห้ามบอกรหัสนี้กับผู้อื่น", code, int(ttl.Minutes()))
+}
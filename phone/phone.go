@@ -0,0 +1,70 @@
+// Package phone แปลงเบอร์โทรศัพท์ไทยให้อยู่ในรูปแบบเดียวกัน (E.164 เช่น +66812345678)
+// เบอร์โทรถูกใช้เป็น UID, อีเมลสังเคราะห์ และ receiverUID จึงต้องผ่าน Normalize ก่อนใช้งานทุกครั้ง
+// ไม่อย่างนั้น "0812345678", "081-234-5678" และ "+66812345678" จะกลายเป็นคนละบัญชี
+package phone
+
+import (
+	"errors"
+	"strings"
+)
+
+// CountryCode คือรหัสประเทศไทยในรูปแบบ E.164
+const CountryCode = "+66"
+
+// ErrInvalid หมายถึงไม่ใช่เบอร์มือถือไทยที่ถูกต้อง
+var ErrInvalid = errors.New("phone: not a valid Thai mobile number")
+
+// Normalize รับเบอร์ที่ผู้ใช้พิมพ์มา (มีขีด ช่องว่าง วงเล็บ หรือจุดได้) แล้วคืนเบอร์ในรูปแบบ E.164
+// รับทั้งแบบในประเทศ (0812345678) และแบบสากล (+66812345678, 66812345678, 0066812345678)
+// รับเฉพาะเบอร์มือถือ (ขึ้นต้นด้วย 06, 08, 09) เพราะทุกเบอร์ในระบบคือบัญชีผู้ใช้ที่ต้องรับ SMS ได้
+func Normalize(raw string) (string, error) {
+	// 1. ตัดตัวคั่นที่คนชอบพิมพ์ออก
+	cleaned := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')', '\t':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(raw))
+
+	// 2. ตัดรหัสประเทศ/เลข 0 นำหน้าออกให้เหลือเลขหมาย 9 หลัก
+	var national string
+	switch {
+	case strings.HasPrefix(cleaned, "+66"):
+		national = cleaned[3:]
+	case strings.HasPrefix(cleaned, "0066"):
+		national = cleaned[4:]
+	case strings.HasPrefix(cleaned, "66") && len(cleaned) == 11:
+		national = cleaned[2:]
+	case strings.HasPrefix(cleaned, "0"):
+		national = cleaned[1:]
+	default:
+		return "", ErrInvalid
+	}
+	// บางคนพิมพ์ 0 ต่อท้ายรหัสประเทศ เช่น +66 081 234 5678
+	if len(national) == 10 && national[0] == '0' {
+		national = national[1:]
+	}
+
+	// 3. ตรวจว่าเป็นเบอร์มือถือไทย: 9 หลัก ขึ้นต้นด้วย 6, 8 หรือ 9
+	if len(national) != 9 {
+		return "", ErrInvalid
+	}
+	for _, r := range national {
+		if r < '0' || r > '9' {
+			return "", ErrInvalid
+		}
+	}
+	switch national[0] {
+	case '6', '8', '9':
+	default:
+		return "", ErrInvalid
+	}
+	return CountryCode + national, nil
+}
+
+// IsNormalized บอกว่าเบอร์อยู่ในรูปแบบ E.164 ที่ Normalize คืนให้แล้วหรือไม่
+func IsNormalized(p string) bool {
+	normalized, err := Normalize(p)
+	return err == nil && normalized == p
+}
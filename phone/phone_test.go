@@ -0,0 +1,60 @@
+package phone
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+		err  error
+	}{
+		{raw: "0812345678", want: "+66812345678"},
+		{raw: "081-234-5678", want: "+66812345678"},
+		{raw: " (081) 234.5678 ", want: "+66812345678"},
+		{raw: "+66812345678", want: "+66812345678"},
+		{raw: "+66 81 234 5678", want: "+66812345678"},
+		{raw: "66812345678", want: "+66812345678"},
+		{raw: "0066812345678", want: "+66812345678"},
+		{raw: "+66 081 234 5678", want: "+66812345678"},
+		{raw: "0612345678", want: "+66612345678"},
+		{raw: "0912345678", want: "+66912345678"},
+		// เบอร์บ้าน/เบอร์ที่ไม่ใช่มือถือ
+		{raw: "021234567", err: ErrInvalid},
+		{raw: "0712345678", err: ErrInvalid},
+		// ความยาวผิด
+		{raw: "081234567", err: ErrInvalid},
+		{raw: "08123456789", err: ErrInvalid},
+		// ไม่ใช่ตัวเลข / รหัสประเทศอื่น
+		{raw: "08123456ab", err: ErrInvalid},
+		{raw: "+14155550123", err: ErrInvalid},
+		{raw: "812345678", err: ErrInvalid},
+		{raw: "", err: ErrInvalid},
+	}
+	for _, tt := range tests {
+		got, err := Normalize(tt.raw)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Normalize(%q) error = %v, want %v", tt.raw, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestIsNormalized(t *testing.T) {
+	tests := map[string]bool{
+		"+66812345678": true,
+		"0812345678":   false,
+		"66812345678":  false,
+		"":             false,
+	}
+	for p, want := range tests {
+		if got := IsNormalized(p); got != want {
+			t.Errorf("IsNormalized(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+
+	"api-flash-dash/geo"
+	"api-flash-dash/model"
+)
+
+// Currency คือสกุลเงินของค่าส่งทั้งหมด (จำนวนเงินเป็นบาทเต็ม)
+const Currency = "THB"
+
+// DefaultVehicleType ใช้เมื่อแอปไม่ได้ระบุประเภทรถมา
+const DefaultVehicleType = "motorcycle"
+
+// ErrUnknownVehicleType ถูกส่งกลับเมื่อประเภทรถไม่อยู่ในตารางราคา
+var ErrUnknownVehicleType = errors.New("unknown vehicle type")
+
+// Router คำนวณระยะทางระหว่าง 2 จุด (กม.)
+// เปลี่ยนเป็นระยะทางตามถนนจริงได้ด้วยการ implement interface นี้
+type Router interface {
+	DistanceKm(from, to model.Coordinates) (float64, error)
+}
+
+// HaversineRouter ใช้ระยะทางเส้นตรงบนผิวโลก
+type HaversineRouter struct{}
+
+func (HaversineRouter) DistanceKm(from, to model.Coordinates) (float64, error) {
+	return geo.DistanceKm(from.Latitude, from.Longitude, to.Latitude, to.Longitude), nil
+}
+
+// RateTier คืออัตราค่าส่งต่อกิโลเมตรสำหรับช่วงระยะทางหนึ่ง
+// UpToKm = 0 หมายถึงไม่มีขีดจำกัด (ใช้กับช่วงสุดท้าย)
+type RateTier struct {
+	UpToKm float64
+	PerKm  float64
+}
+
+// Config คือตารางราคาทั้งหมด
+type Config struct {
+	BaseFee            float64
+	MinimumFare        float64
+	PerKmRates         []RateTier
+	VehicleMultipliers map[string]float64
+}
+
+// DefaultConfig คือตารางราคาเริ่มต้น
+func DefaultConfig() Config {
+	return Config{
+		BaseFee:     25,
+		MinimumFare: 35,
+		PerKmRates: []RateTier{
+			{UpToKm: 5, PerKm: 8},
+			{UpToKm: 0, PerKm: 6},
+		},
+		VehicleMultipliers: map[string]float64{
+			"motorcycle": 1.0,
+			"car":        1.5,
+			"pickup":     2.0,
+		},
+	}
+}
+
+// LoadConfig อ่านตารางราคาจาก Environment Variables (ถ้าไม่ได้ตั้งไว้จะใช้ค่าเริ่มต้น)
+// PRICING_BASE_FEE, PRICING_MINIMUM_FARE, PRICING_PER_KM_FIRST_5KM, PRICING_PER_KM_AFTER_5KM
+func LoadConfig() Config {
+	cfg := DefaultConfig()
+	cfg.BaseFee = envFloat("PRICING_BASE_FEE", cfg.BaseFee)
+	cfg.MinimumFare = envFloat("PRICING_MINIMUM_FARE", cfg.MinimumFare)
+	cfg.PerKmRates[0].PerKm = envFloat("PRICING_PER_KM_FIRST_5KM", cfg.PerKmRates[0].PerKm)
+	cfg.PerKmRates[1].PerKm = envFloat("PRICING_PER_KM_AFTER_5KM", cfg.PerKmRates[1].PerKm)
+	return cfg
+}
+
+func envFloat(key string, fallback float64) float64 {
+	if raw := os.Getenv(key); raw != "" {
+		if v, err := strconv.ParseFloat(raw, 64); err == nil {
+			return v
+		}
+	}
+	return fallback
+}
+
+// Engine คำนวณค่าส่งจากตารางราคาและ Router
+type Engine struct {
+	Config Config
+	Router Router
+}
+
+// NewEngine สร้าง Engine (ถ้า router เป็น nil จะใช้ HaversineRouter)
+func NewEngine(cfg Config, router Router) *Engine {
+	if router == nil {
+		router = HaversineRouter{}
+	}
+	return &Engine{Config: cfg, Router: router}
+}
+
+// VehicleTypes คืนรายชื่อประเภทรถที่มีในตารางราคา
+func (e *Engine) VehicleTypes() []string {
+	types := make([]string, 0, len(e.Config.VehicleMultipliers))
+	for t := range e.Config.VehicleMultipliers {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Quote คำนวณค่าส่งจากจุดรับ (from) ไปจุดส่ง (to) ด้วยรถประเภท vehicleType
+func (e *Engine) Quote(from, to model.Coordinates, vehicleType string) (model.Fare, error) {
+	if vehicleType == "" {
+		vehicleType = DefaultVehicleType
+	}
+	multiplier, ok := e.Config.VehicleMultipliers[vehicleType]
+	if !ok {
+		return model.Fare{}, fmt.Errorf("%w %q", ErrUnknownVehicleType, vehicleType)
+	}
+
+	distanceKm, err := e.Router.DistanceKm(from, to)
+	if err != nil {
+		return model.Fare{}, err
+	}
+
+	// คิดค่าระยะทางแบบขั้นบันได
+	distanceFee := 0.0
+	covered := 0.0
+	for _, tier := range e.Config.PerKmRates {
+		if covered >= distanceKm {
+			break
+		}
+		upper := distanceKm
+		if tier.UpToKm > 0 && tier.UpToKm < upper {
+			upper = tier.UpToKm
+		}
+		if upper > covered {
+			distanceFee += (upper - covered) * tier.PerKm
+			covered = upper
+		}
+	}
+
+	baseFee := roundUp(e.Config.BaseFee)
+	distanceFeeBaht := roundUp(distanceFee)
+	total := roundUp(float64(baseFee+distanceFeeBaht) * multiplier)
+	if minimum := roundUp(e.Config.MinimumFare); total < minimum {
+		total = minimum
+	}
+
+	return model.Fare{
+		VehicleType: vehicleType,
+		DistanceKm:  math.Round(distanceKm*100) / 100,
+		BaseFee:     baseFee,
+		DistanceFee: distanceFeeBaht,
+		Multiplier:  multiplier,
+		Total:       total,
+		Currency:    Currency,
+	}, nil
+}
+
+// roundUp ปัดเศษขึ้นเป็นบาทเต็ม
+func roundUp(amount float64) int {
+	return int(math.Ceil(amount - 1e-9))
+}
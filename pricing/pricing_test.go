@@ -0,0 +1,76 @@
+package pricing
+
+import (
+	"errors"
+	"testing"
+
+	"api-flash-dash/model"
+)
+
+// fixedRouter คืนระยะทางคงที่ ไม่ว่าพิกัดจะเป็นอะไร
+type fixedRouter struct {
+	km  float64
+	err error
+}
+
+func (r fixedRouter) DistanceKm(from, to model.Coordinates) (float64, error) {
+	return r.km, r.err
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		name        string
+		km          float64
+		vehicleType string
+		wantType    string
+		distanceFee int
+		total       int
+		err         error
+	}{
+		{name: "zero distance hits minimum", km: 0, vehicleType: "motorcycle", wantType: "motorcycle", distanceFee: 0, total: 35},
+		{name: "first tier", km: 2, vehicleType: "motorcycle", wantType: "motorcycle", distanceFee: 16, total: 41},
+		{name: "fraction rounds up", km: 2.3, vehicleType: "motorcycle", wantType: "motorcycle", distanceFee: 19, total: 44},
+		{name: "tier boundary", km: 5, vehicleType: "motorcycle", wantType: "motorcycle", distanceFee: 40, total: 65},
+		{name: "second tier", km: 10, vehicleType: "motorcycle", wantType: "motorcycle", distanceFee: 70, total: 95},
+		{name: "car multiplier rounds up", km: 10, vehicleType: "car", wantType: "car", distanceFee: 70, total: 143},
+		{name: "pickup multiplier", km: 10, vehicleType: "pickup", wantType: "pickup", distanceFee: 70, total: 190},
+		{name: "default vehicle type", km: 2, vehicleType: "", wantType: DefaultVehicleType, distanceFee: 16, total: 41},
+		{name: "unknown vehicle type", km: 2, vehicleType: "boat", err: ErrUnknownVehicleType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewEngine(DefaultConfig(), fixedRouter{km: tt.km})
+			fare, err := engine.Quote(model.Coordinates{}, model.Coordinates{}, tt.vehicleType)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Quote() error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if fare.VehicleType != tt.wantType || fare.BaseFee != 25 || fare.DistanceFee != tt.distanceFee || fare.Total != tt.total || fare.Currency != Currency {
+				t.Errorf("Quote() = %+v, want type %s distanceFee %d total %d", fare, tt.wantType, tt.distanceFee, tt.total)
+			}
+		})
+	}
+}
+
+func TestQuoteRouterError(t *testing.T) {
+	routerErr := errors.New("routing unavailable")
+	engine := NewEngine(DefaultConfig(), fixedRouter{err: routerErr})
+	if _, err := engine.Quote(model.Coordinates{}, model.Coordinates{}, ""); !errors.Is(err, routerErr) {
+		t.Errorf("Quote() error = %v, want %v", err, routerErr)
+	}
+}
+
+func TestQuoteHaversine(t *testing.T) {
+	// อนุสาวรีย์ชัยฯ -> สยาม ประมาณ 2.5 กม.
+	from := model.Coordinates{Latitude: 13.7649, Longitude: 100.5383}
+	to := model.Coordinates{Latitude: 13.7456, Longitude: 100.5341}
+	fare, err := NewEngine(DefaultConfig(), nil).Quote(from, to, "")
+	if err != nil {
+		t.Fatalf("Quote() error = %v", err)
+	}
+	if fare.DistanceKm < 2 || fare.DistanceKm > 3 {
+		t.Errorf("DistanceKm = %v, want about 2.2", fare.DistanceKm)
+	}
+}
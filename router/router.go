@@ -1,8 +1,12 @@
 package router
 
 import (
+	"log"
+	"time"
+
 	"api-flash-dash/handler" // <-- import handler ของเรา
 	"api-flash-dash/middleware"
+	"api-flash-dash/model"
 
 	"github.com/gin-gonic/gin"
 )
@@ -12,73 +16,184 @@ import (
 func SetupRouter(authHandler *handler.AuthHandler) *gin.Engine {
 	// 1. สร้าง Router ด้วย Gin
 	router := gin.Default()
+	// ค่าเริ่มต้นของ gin เชื่อ X-Forwarded-For จากทุกที่ ต้องระบุ proxy ที่อยู่หน้าเซิร์ฟเวอร์จริงๆ เท่านั้น
+	if err := router.SetTrustedProxies(middleware.TrustedProxiesFromEnv()); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	// 2. จัดกลุ่ม Endpoint สำหรับ Auth
 	authRoutes := router.Group("/auth")
 	{
+		// จำกัดจำนวนคำขอต่อ IP สำหรับเส้นทางที่ส่ง SMS หรือรับรหัส OTP (กันยิง SMS และเดารหัสข้ามหลายเบอร์)
+		// และต่อเบอร์โทร (กันยิงใส่เบอร์เดียวจากหลาย IP)
+		sendLimited := authRoutes.Group("", middleware.RateLimit(10, 10*time.Minute), middleware.PhoneRateLimit(5, 10*time.Minute))
+		verifyLimited := authRoutes.Group("", middleware.RateLimit(30, 10*time.Minute), middleware.PhoneRateLimit(10, 10*time.Minute))
+
+		// ยืนยันเบอร์โทรด้วย OTP ก่อนสมัคร (ได้ verificationTicket ไปใช้ตอนสมัคร)
+		sendLimited.POST("/register/otp", authHandler.RequestRegistrationOTP)
+		verifyLimited.POST("/register/otp/verify", authHandler.VerifyRegistrationOTP)
+
 		// กำหนดเส้นทางใหม่สำหรับการสมัคร
 		authRoutes.POST("/register/customer", authHandler.RegisterCustomerHandler)
 		authRoutes.POST("/register/rider", authHandler.RegisterRiderHandler)
 
 		authRoutes.POST("/login", authHandler.LoginHandler)
+		// ขอ idToken ใหม่ด้วย refreshToken ที่ได้ตอนล็อกอิน
+		authRoutes.POST("/refresh", authHandler.RefreshTokenHandler)
+
+		// ลืมรหัสผ่าน: ขอ OTP -> ยืนยัน OTP ได้ resetTicket -> ตั้งรหัสผ่านใหม่
+		sendLimited.POST("/password/reset/request", authHandler.RequestPasswordReset)
+		verifyLimited.POST("/password/reset/verify", authHandler.VerifyPasswordResetOTP)
+		verifyLimited.POST("/password/reset", authHandler.ResetPassword)
 	}
 
 	private := router.Group("/api")
-	private.Use(middleware.AuthMiddleware(authHandler.AuthClient))
+	private.Use(middleware.AuthMiddleware(authHandler.AuthClient, authHandler.CheckRevoked))
 	{
+		// แยกกลุ่มตาม role ใน custom claims ของ Token (ตั้งค่าตอนสมัครใน registerUserCore)
+		// เส้นทางที่เรียกผ่าน private ตรงๆ ใช้ได้ทุกบทบาทที่ล็อกอินแล้ว
+		customer := private.Group("", middleware.RequireRole(model.RoleCustomer))
+		rider := private.Group("", middleware.RequireRole(model.RoleRider))
+
 		// **** จุดแก้ไข: เปลี่ยน userHandler เป็น authHandler ****
 		// เพราะเราส่ง authHandler เข้ามาในฟังก์ชันนี้
 		private.PUT("/user/profile", authHandler.UpdateUserProfile)
+		// Endpoint: POST /api/logout (เพิกถอน session ทุกอุปกรณ์)
+		private.POST("/logout", authHandler.LogoutHandler)
+		// Endpoint: DELETE /api/user/account (ลบบัญชีตาม PDPA ต้องส่ง password มายืนยัน)
+		private.DELETE("/user/account", authHandler.DeleteAccount)
+		// ส่งออกข้อมูลส่วนบุคคลทั้งหมด (PDPA): เริ่มงาน -> poll สถานะ -> ดาวน์โหลด
+		// Endpoint: POST /api/user/exports (body: {"format": "json" | "zip"})
+		private.POST("/user/exports", authHandler.RequestDataExport)
+		private.GET("/user/exports", authHandler.ListDataExports)
+		private.GET("/user/exports/:exportId", authHandler.GetDataExport)
+		private.GET("/user/exports/:exportId/download", authHandler.DownloadDataExport)
 
 		// เส้นทางสำหรับจัดการที่อยู่
 		// Endpoint: POST /api/user/addresses
-		private.POST("/user/addresses", authHandler.AddUserAddress)
+		customer.POST("/user/addresses", authHandler.AddUserAddress)
 
 		// Endpoint: PUT /api/user/addresses/:addressId
-		private.PUT("/user/addresses/:addressId", authHandler.UpdateUserAddress)
+		customer.PUT("/user/addresses/:addressId", authHandler.UpdateUserAddress)
+		// Endpoint: DELETE /api/user/addresses/:addressId
+		customer.DELETE("/user/addresses/:addressId", authHandler.DeleteUserAddress)
+		// Endpoint: POST /api/user/addresses/:addressId/default (ตั้งเป็นที่อยู่หลัก)
+		customer.POST("/user/addresses/:addressId/default", authHandler.SetDefaultUserAddress)
 		// เส้นทางสำหรับค้นหาผู้ใช้
 		// Endpoint: GET /api/users/find?phone=xxxxxxxxxx
-		private.GET("/users/find", authHandler.FindUserByPhone)
+		customer.GET("/users/find", authHandler.FindUserByPhone)
 		// เส้นทางสำหรับสร้างการจัดส่ง
 		// Endpoint: POST /api/deliveries
-		private.POST("/deliveries", authHandler.CreateDeliveryHandler)
+		customer.POST("/deliveries", authHandler.CreateDeliveryHandler)
+		// Endpoint: POST /api/deliveries/quote
+		// ขอราคาค่าส่งล่วงหน้า (เรียกก่อนสร้างการจัดส่ง)
+		customer.POST("/deliveries/quote", authHandler.QuoteDelivery)
 		// Endpoint: GET /api/user/deliveries
-		private.GET("/user/deliveries", authHandler.GetUserDeliveries)
+		customer.GET("/user/deliveries", authHandler.GetUserDeliveries)
+		// Endpoint: GET /api/deliveries/{deliveryId}/timeline
+		// ดูประวัติการเปลี่ยนสถานะของการจัดส่ง (ผู้ส่ง ผู้รับ และไรเดอร์)
+		private.GET("/deliveries/:deliveryId/timeline", authHandler.GetDeliveryTimeline)
+		// Endpoint: GET /api/deliveries/{deliveryId}/tracking
+		// ผู้ส่ง/ผู้รับดูตำแหน่งล่าสุดของไรเดอร์ (เฉพาะตอน accepted หรือ picked_up)
+		customer.GET("/deliveries/:deliveryId/tracking", authHandler.GetDeliveryTracking)
+		// Endpoint: GET /api/deliveries/{deliveryId}/stream
+		// Server-Sent Events: การเปลี่ยนสถานะและตำแหน่งไรเดอร์แบบ real-time (แทนการ poll)
+		private.GET("/deliveries/:deliveryId/stream", authHandler.StreamDelivery)
+		// Endpoint: POST /api/deliveries/{deliveryId}/cancel
+		// ผู้ส่งยกเลิกการจัดส่ง (ต้องระบุ reason ถ้าไรเดอร์รับงานแล้ว)
+		customer.POST("/deliveries/:deliveryId/cancel", authHandler.CancelDelivery)
+		// Endpoint: POST /api/deliveries/{deliveryId}/pin/reset
+		// ผู้รับขอ PIN ยืนยันการรับของใหม่ (เช่น หลังใส่ผิดจนถูกล็อก)
+		customer.POST("/deliveries/:deliveryId/pin/reset", authHandler.ResetDeliveryPIN)
+		// Endpoint: POST /api/deliveries/{deliveryId}/rating
+		// ผู้ส่ง/ผู้รับให้คะแนนไรเดอร์ 1-5 ดาว (ครั้งเดียวต่อ delivery หลังส่งสำเร็จ)
+		customer.POST("/deliveries/:deliveryId/rating", authHandler.RateRider)
+		// Endpoint: GET /api/riders/{riderId}/ratings
+		private.GET("/riders/:riderId/ratings", authHandler.GetRiderRatings)
+		// Endpoint: GET /api/user/notifications
+		private.GET("/user/notifications", authHandler.GetUserNotifications)
 
 		// +++ เส้นทางใหม่สำหรับดึงลูกค้ทั้งหมด +++
         // Endpoint: GET /api/users/customers
-        private.GET("/users/customers", authHandler.GetAllCustomersHandler)
+        customer.GET("/users/customers", authHandler.GetAllCustomersHandler)
 
 		// --- เส้นทางสำหรับ Rider ---
 		// Endpoint: PUT /api/rider/profile
 		// เราจะเรียกใช้ฟังก์ชัน UpdateRiderProfile ที่อยู่ใน AuthHandler
-		private.PUT("/rider/profile", authHandler.UpdateRiderProfile)
+		rider.PUT("/rider/profile", authHandler.UpdateRiderProfile)
 
         // --- เพิ่มเส้นทางสำหรับ Rider ที่นี่ ---
         // Endpoint: GET /api/rider/deliveries/pending
-        private.GET("/rider/deliveries/pending", authHandler.GetPendingDeliveries)
+        rider.GET("/rider/deliveries/pending", authHandler.GetPendingDeliveries)
 		// +++ เส้นทางใหม่สำหรับ Rider รับงาน +++
 		// Endpoint: POST /api/rider/deliveries/{deliveryId}/accept
 		// เมื่อ Rider กดรับงาน, App จะยิงมาที่เส้นทางนี้
 		// โดย :deliveryId คือ ID ของงานที่ต้องการรับ
-		private.POST("/rider/deliveries/:deliveryId/accept", authHandler.AcceptDelivery)
+		rider.POST("/rider/deliveries/:deliveryId/accept", authHandler.AcceptDelivery)
+		// Endpoint: POST /api/rider/deliveries/{deliveryId}/release
+		// ไรเดอร์คืนงานที่รับไว้ (ต้องระบุ reason) งานจะกลับไปเป็น pending
+		rider.POST("/rider/deliveries/:deliveryId/release", authHandler.ReleaseDelivery)
 
 		// ++ เพิ่มเส้นทางใหม่สำหรับอัปเดตตำแหน่งของไรเดอร์ ++
         // Endpoint: POST /api/rider/location
-        private.POST("/rider/location", authHandler.UpdateRiderLocation)
+        rider.POST("/rider/location", authHandler.UpdateRiderLocation)
 
 
 		// +++ เส้นทางใหม่สำหรับยืนยันการรับสินค้า +++
 		// Endpoint: PUT /api/rider/deliveries/{deliveryId}/pickup
-		private.PUT("/rider/deliveries/:deliveryId/pickup", authHandler.ConfirmPickup)
+		rider.PUT("/rider/deliveries/:deliveryId/pickup", authHandler.ConfirmPickup)
 
 				// +++ เส้นทางใหม่สำหรับยืนยันการส่งสินค้า +++
 		// Endpoint: PUT /api/rider/deliveries/{deliveryId}/deliver
-		private.PUT("/rider/deliveries/:deliveryId/deliver", authHandler.ConfirmDelivery)
+		rider.PUT("/rider/deliveries/:deliveryId/deliver", authHandler.ConfirmDelivery)
 		
         // +++ เพิ่มเส้นทางใหม่สำหรับเช็คงานที่ค้างอยู่ตรงนี้ +++
         // Endpoint: GET /api/rider/deliveries/current
-        private.GET("/rider/deliveries/current", authHandler.GetCurrentDelivery)
+        rider.GET("/rider/deliveries/current", authHandler.GetCurrentDelivery)
+
+		// --- การยืนยันตัวตนไรเดอร์ ---
+		// Endpoint: GET /api/rider/verification
+		rider.GET("/rider/verification", authHandler.GetRiderVerification)
+		// Endpoint: PUT /api/rider/documents (ใบขับขี่ บัตรประชาชน เล่มทะเบียนรถ)
+		rider.PUT("/rider/documents", authHandler.UploadRiderDocuments)
+
+		// --- รายได้ของไรเดอร์ ---
+		// Endpoint: GET /api/rider/earnings/balance
+		rider.GET("/rider/earnings/balance", authHandler.GetRiderBalance)
+		// Endpoint: GET /api/rider/earnings/statement?period=daily|weekly&date=YYYY-MM-DD
+		rider.GET("/rider/earnings/statement", authHandler.GetRiderStatement)
+
+		// --- เส้นทางสำหรับแอดมิน (/api/admin) ---
+		// ทุกเส้นทางในกลุ่มนี้ต้องเป็นผู้ใช้ที่มี role "admin" ทั้งใน Token และในข้อมูลล่าสุด (ดู AdminOnly)
+		admin := private.Group("/admin", middleware.RequireRole(model.RoleAdmin), authHandler.AdminOnly())
+		{
+			// ผู้ใช้: GET /api/admin/users?role=&status=&q=
+			admin.GET("/users", authHandler.ListUsersForAdmin)
+			admin.GET("/users/:uid", authHandler.GetUserForAdmin)
+			// ระงับ/เปิดใช้งานบัญชี (suspend ต้องระบุ reason)
+			admin.POST("/users/:uid/suspend", authHandler.SuspendUser)
+			admin.POST("/users/:uid/reactivate", authHandler.ReactivateUser)
+			// ให้/ถอนสิทธิ์แอดมิน
+			admin.POST("/users/:uid/admin", authHandler.GrantAdmin)
+			admin.DELETE("/users/:uid/admin", authHandler.RevokeAdmin)
+
+			// การจัดส่ง: GET /api/admin/deliveries?status=pending,accepted&riderUID=
+			admin.GET("/deliveries", authHandler.ListDeliveriesForAdmin)
+			admin.GET("/deliveries/:deliveryId", authHandler.GetDeliveryForAdmin)
+			admin.POST("/deliveries/:deliveryId/cancel", authHandler.ForceCancelDelivery)
+			admin.POST("/deliveries/:deliveryId/reassign", authHandler.ReassignDelivery)
+
+			// ไรเดอร์: เอกสาร และบัญชีรายได้ (ฝ่ายการเงิน)
+			// GET /api/admin/riders?verificationStatus=pending_verification
+			admin.GET("/riders", authHandler.ListRidersForVerification)
+			admin.GET("/riders/:riderId", authHandler.GetRiderDocumentsForAdmin)
+			admin.POST("/riders/:riderId/approve", authHandler.ApproveRider)
+			admin.POST("/riders/:riderId/reject", authHandler.RejectRider)
+			admin.GET("/riders/:riderId/earnings/statement", authHandler.GetRiderStatementForAdmin)
+			admin.POST("/riders/:riderId/payouts", authHandler.RecordRiderPayout)
+			// type = "penalty" (หักเงิน) หรือ "adjustment" (ปรับปรุงยอด บวกหรือลบ)
+			admin.POST("/riders/:riderId/adjustments", authHandler.RecordRiderAdjustment)
+		}
 
 	}
 
@@ -0,0 +1,910 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"api-flash-dash/model"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	latlng "google.golang.org/genproto/googleapis/type/latlng"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// firestoreStore คือ implementation ที่เก็บข้อมูลจริงลง Cloud Firestore
+type firestoreStore struct {
+	client *firestore.Client
+}
+
+// NewFirestore สร้าง Store ที่ใช้ Firestore เป็น backend
+func NewFirestore(client *firestore.Client) *Store {
+	s := &firestoreStore{client: client}
+	return &Store{
+		Users:         s,
+		Addresses:     s,
+		Riders:        s,
+		Deliveries:    s,
+		Notifications: s,
+		Ledger:        s,
+		Verifications: s,
+		Exports:       s,
+	}
+}
+
+// notFound แปลง error NotFound ของ Firestore ให้เป็น ErrNotFound
+func notFound(err error) error {
+	if status.Code(err) == codes.NotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+// alreadyExists แปลง error AlreadyExists ของ Firestore ให้เป็น ErrAlreadyExists
+func alreadyExists(err error) error {
+	if status.Code(err) == codes.AlreadyExists {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+// --- users ---
+
+func (s *firestoreStore) CreateUser(ctx context.Context, uid string, user model.UserProfile) error {
+	_, err := s.client.Collection("users").Doc(uid).Set(ctx, user)
+	return err
+}
+
+func (s *firestoreStore) GetUser(ctx context.Context, uid string) (*model.UserProfile, error) {
+	doc, err := s.client.Collection("users").Doc(uid).Get(ctx)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return userFromDoc(doc)
+}
+
+func (s *firestoreStore) FindUserByPhone(ctx context.Context, phone string) (*model.UserProfile, error) {
+	iter := s.client.Collection("users").Where("phone", "==", phone).Limit(1).Documents(ctx)
+	defer iter.Stop()
+	doc, err := iter.Next()
+	if err == iterator.Done {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return userFromDoc(doc)
+}
+
+func (s *firestoreStore) ListUsersByRole(ctx context.Context, role string) ([]model.UserProfile, error) {
+	var users []model.UserProfile
+	query := s.client.Collection("users").Query
+	if role != "" {
+		query = query.Where("role", "==", role)
+	}
+	iter := query.Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		user, err := userFromDoc(doc)
+		if err != nil {
+			continue // ข้ามเอกสารที่มีปัญหา
+		}
+		users = append(users, *user)
+	}
+	return users, nil
+}
+
+func (s *firestoreStore) UpdateUser(ctx context.Context, uid string, update UserUpdate) error {
+	if update.IsEmpty() {
+		return nil
+	}
+	_, err := s.client.Collection("users").Doc(uid).Update(ctx, userUpdates(update))
+	return notFound(err)
+}
+
+func (s *firestoreStore) DeleteUser(ctx context.Context, uid string) error {
+	return s.deleteDocument(ctx, s.client.Collection("users").Doc(uid), "addresses", "notifications")
+}
+
+// deleteDocument ลบเอกสารพร้อม sub-collection ที่ระบุ (Firestore ไม่ลบ sub-collection ให้เมื่อลบเอกสารแม่)
+func (s *firestoreStore) deleteDocument(ctx context.Context, ref *firestore.DocumentRef, subcollections ...string) error {
+	for _, name := range subcollections {
+		refs, err := ref.Collection(name).DocumentRefs(ctx).GetAll()
+		if err != nil {
+			return err
+		}
+		// batch เขียนได้ไม่เกิน 500 รายการต่อครั้ง
+		for start := 0; start < len(refs); start += 500 {
+			end := start + 500
+			if end > len(refs) {
+				end = len(refs)
+			}
+			batch := s.client.Batch()
+			for _, child := range refs[start:end] {
+				batch.Delete(child)
+			}
+			if _, err := batch.Commit(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := ref.Delete(ctx)
+	return err
+}
+
+func userFromDoc(doc *firestore.DocumentSnapshot) (*model.UserProfile, error) {
+	var user model.UserProfile
+	if err := doc.DataTo(&user); err != nil {
+		return nil, err
+	}
+	user.UID = doc.Ref.ID
+	return &user, nil
+}
+
+func userUpdates(update UserUpdate) []firestore.Update {
+	var updates []firestore.Update
+	if update.Name != nil {
+		updates = append(updates, firestore.Update{Path: "name", Value: *update.Name})
+	}
+	if update.ImageProfile != nil {
+		updates = append(updates, firestore.Update{Path: "image_profile", Value: *update.ImageProfile})
+	}
+	if update.Role != nil {
+		updates = append(updates, firestore.Update{Path: "role", Value: *update.Role})
+	}
+	if update.Status != nil {
+		updates = append(updates, firestore.Update{Path: "status", Value: *update.Status})
+	}
+	if update.SuspendedReason != nil {
+		updates = append(updates, firestore.Update{Path: "suspendedReason", Value: *update.SuspendedReason})
+	}
+	if update.SuspendedAt != nil {
+		updates = append(updates, firestore.Update{Path: "suspendedAt", Value: *update.SuspendedAt})
+	}
+	return updates
+}
+
+// --- addresses ---
+
+func (s *firestoreStore) addresses(uid string) *firestore.CollectionRef {
+	return s.client.Collection("users").Doc(uid).Collection("addresses")
+}
+
+func (s *firestoreStore) AddAddress(ctx context.Context, uid string, address model.AddressPayload) (string, error) {
+	ref := s.addresses(uid).NewDoc()
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docs, err := tx.Documents(s.addresses(uid)).GetAll()
+		if err != nil {
+			return err
+		}
+		// ใช้สำเนา เพราะ Transaction อาจถูกรันซ้ำ
+		address := address
+		if len(docs) == 0 {
+			address.IsDefault = true
+		}
+		return s.putAddress(tx, docs, ref, address)
+	})
+	if err != nil {
+		return "", err
+	}
+	return ref.ID, nil
+}
+
+func (s *firestoreStore) SetAddress(ctx context.Context, uid, addressID string, address model.AddressPayload) error {
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var docs []*firestore.DocumentSnapshot
+		if address.IsDefault {
+			var err error
+			if docs, err = tx.Documents(s.addresses(uid)).GetAll(); err != nil {
+				return err
+			}
+		}
+		return s.putAddress(tx, docs, s.addresses(uid).Doc(addressID), address)
+	})
+}
+
+// putAddress เขียนที่อยู่ภายใน Transaction และยกเลิกที่อยู่หลักเดิม (จาก docs ที่อ่านไว้แล้ว) ถ้าที่อยู่นี้เป็นที่อยู่หลัก
+func (s *firestoreStore) putAddress(tx *firestore.Transaction, docs []*firestore.DocumentSnapshot, ref *firestore.DocumentRef, address model.AddressPayload) error {
+	if address.IsDefault {
+		for _, doc := range docs {
+			if isDefault, _ := doc.DataAt("isDefault"); isDefault == true && doc.Ref.ID != ref.ID {
+				if err := tx.Update(doc.Ref, []firestore.Update{{Path: "isDefault", Value: false}}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return tx.Set(ref, address)
+}
+
+func (s *firestoreStore) GetAddress(ctx context.Context, uid, addressID string) (*model.Address, error) {
+	doc, err := s.addresses(uid).Doc(addressID).Get(ctx)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	var address model.Address
+	if err := doc.DataTo(&address); err != nil {
+		return nil, err
+	}
+	address.ID = doc.Ref.ID
+	return &address, nil
+}
+
+func (s *firestoreStore) ListAddresses(ctx context.Context, uid string) ([]model.Address, error) {
+	var addresses []model.Address
+	iter := s.addresses(uid).Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var address model.Address
+		if err := doc.DataTo(&address); err != nil {
+			continue // ข้ามที่อยู่ที่มีปัญหาไป
+		}
+		address.ID = doc.Ref.ID
+		addresses = append(addresses, address)
+	}
+	return addresses, nil
+}
+
+func (s *firestoreStore) DeleteAddress(ctx context.Context, uid, addressID string) error {
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docs, err := tx.Documents(s.addresses(uid)).GetAll()
+		if err != nil {
+			return err
+		}
+		var target *firestore.DocumentSnapshot
+		var rest []*firestore.DocumentSnapshot
+		for _, doc := range docs {
+			if doc.Ref.ID == addressID {
+				target = doc
+			} else {
+				rest = append(rest, doc)
+			}
+		}
+		if target == nil {
+			return ErrNotFound
+		}
+		if isDefault, _ := target.DataAt("isDefault"); isDefault == true && len(rest) > 0 {
+			if err := tx.Update(rest[0].Ref, []firestore.Update{{Path: "isDefault", Value: true}}); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(target.Ref)
+	})
+}
+
+func (s *firestoreStore) SetDefaultAddress(ctx context.Context, uid, addressID string) error {
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docs, err := tx.Documents(s.addresses(uid)).GetAll()
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, doc := range docs {
+			found = found || doc.Ref.ID == addressID
+		}
+		if !found {
+			return ErrNotFound
+		}
+		for _, doc := range docs {
+			want := doc.Ref.ID == addressID
+			if current, _ := doc.DataAt("isDefault"); current == want {
+				continue
+			}
+			if err := tx.Update(doc.Ref, []firestore.Update{{Path: "isDefault", Value: want}}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// --- riders ---
+
+func (s *firestoreStore) CreateRider(ctx context.Context, uid string, rider model.Rider) error {
+	_, err := s.client.Collection("riders").Doc(uid).Set(ctx, rider)
+	return err
+}
+
+func (s *firestoreStore) GetRider(ctx context.Context, uid string) (*model.Rider, error) {
+	doc, err := s.client.Collection("riders").Doc(uid).Get(ctx)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	var rider model.Rider
+	if err := doc.DataTo(&rider); err != nil {
+		return nil, err
+	}
+	return &rider, nil
+}
+
+func (s *firestoreStore) UpdateRiderProfile(ctx context.Context, uid string, user UserUpdate, rider RiderUpdate) error {
+	if user.IsEmpty() && rider.IsEmpty() {
+		return nil
+	}
+
+	// ใช้ Transaction เพราะต้องอ่านสถานะการตรวจสอบก่อน (เปลี่ยนข้อมูลรถแล้วต้องกลับไปรอตรวจสอบ ดู model.Rider.ApplyVehicleUpdate)
+	riderRef := s.client.Collection("riders").Doc(uid)
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var riderUpdates []firestore.Update
+		if !rider.IsEmpty() {
+			doc, err := tx.Get(riderRef)
+			if err != nil {
+				return notFound(err)
+			}
+			var current model.Rider
+			if err := doc.DataTo(&current); err != nil {
+				return err
+			}
+			if rider.ImageVehicle != nil {
+				riderUpdates = append(riderUpdates, firestore.Update{Path: "image_vehicle", Value: *rider.ImageVehicle})
+			}
+			if rider.VehicleRegistration != nil {
+				riderUpdates = append(riderUpdates, firestore.Update{Path: "vehicle_registration", Value: *rider.VehicleRegistration})
+			}
+			if current.ApplyVehicleUpdate(rider.ImageVehicle, rider.VehicleRegistration, time.Now()) {
+				riderUpdates = append(riderUpdates,
+					firestore.Update{Path: "verificationStatus", Value: current.VerificationStatus},
+					firestore.Update{Path: "submittedAt", Value: current.SubmittedAt},
+				)
+			}
+		}
+		if !user.IsEmpty() {
+			if err := tx.Update(s.client.Collection("users").Doc(uid), userUpdates(user)); err != nil {
+				return err
+			}
+		}
+		if len(riderUpdates) > 0 {
+			return tx.Update(riderRef, riderUpdates)
+		}
+		return nil
+	})
+	return notFound(err)
+}
+
+func (s *firestoreStore) UpdateRiderLocation(ctx context.Context, uid string, latitude, longitude float64) error {
+	// ใช้ Set กับ MergeAll เพื่อสร้าง document ถ้ายังไม่มี หรืออัปเดต field ถ้ามีอยู่แล้ว
+	_, err := s.client.Collection("riders").Doc(uid).Set(ctx, map[string]interface{}{
+		"currentLocation": &latlng.LatLng{Latitude: latitude, Longitude: longitude},
+		"updatedAt":       firestore.ServerTimestamp,
+	}, firestore.MergeAll)
+	return err
+}
+
+func (s *firestoreStore) AddRating(ctx context.Context, rating model.Rating) (*model.Rider, error) {
+	riderRef := s.client.Collection("riders").Doc(rating.RiderUID)
+	ratingRef := riderRef.Collection("ratings").Doc(RatingID(rating.DeliveryID, rating.RaterUID))
+	var rider model.Rider
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		// อ่านทั้งหมดก่อนเขียน (ข้อกำหนดของ Transaction)
+		doc, err := tx.Get(riderRef)
+		if err != nil {
+			return notFound(err)
+		}
+		rider = model.Rider{}
+		if err := doc.DataTo(&rider); err != nil {
+			return err
+		}
+		if _, err := tx.Get(ratingRef); err == nil {
+			return ErrAlreadyExists
+		} else if status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		rider.AddRating(rating.Score)
+		if err := tx.Create(ratingRef, rating); err != nil {
+			return err
+		}
+		return tx.Update(riderRef, []firestore.Update{
+			{Path: "ratingAverage", Value: rider.RatingAverage},
+			{Path: "ratingCount", Value: rider.RatingCount},
+			{Path: "ratingTotal", Value: rider.RatingTotal},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &rider, nil
+}
+
+func (s *firestoreStore) UpdateRider(ctx context.Context, uid string, fn func(rider *model.Rider) error) error {
+	ref := s.client.Collection("riders").Doc(uid)
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return notFound(err)
+		}
+		var rider model.Rider
+		if err := doc.DataTo(&rider); err != nil {
+			return err
+		}
+		if err := fn(&rider); err != nil {
+			return err
+		}
+		return tx.Set(ref, rider)
+	})
+}
+
+func (s *firestoreStore) ListRidersByVerificationStatus(ctx context.Context, status string) (map[string]model.Rider, error) {
+	riders := make(map[string]model.Rider)
+	iter := s.client.Collection("riders").Where("verificationStatus", "==", status).Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var rider model.Rider
+		if err := doc.DataTo(&rider); err != nil {
+			continue // ข้ามเอกสารที่มีปัญหา
+		}
+		riders[doc.Ref.ID] = rider
+	}
+	return riders, nil
+}
+
+func (s *firestoreStore) DeleteRider(ctx context.Context, uid string) error {
+	return s.deleteDocument(ctx, s.client.Collection("riders").Doc(uid), "ratings")
+}
+
+// AnonymizeRatingsBy ต้องย้ายเอกสารไปยัง ID ใหม่ด้วย เพราะ ID ของรีวิวมี UID ของผู้ให้คะแนนอยู่ (ดู RatingID)
+// หมายเหตุ: query แบบ collection group ต้องเปิด single-field index ของ ratings.raterUID ก่อน
+func (s *firestoreStore) AnonymizeRatingsBy(ctx context.Context, raterUID, alias string) error {
+	docs, err := s.client.CollectionGroup("ratings").Where("raterUID", "==", raterUID).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		var rating model.Rating
+		if err := doc.DataTo(&rating); err != nil {
+			return err
+		}
+		rating.RaterUID = alias
+		batch := s.client.Batch()
+		batch.Set(doc.Ref.Parent.Doc(RatingID(rating.DeliveryID, alias)), rating)
+		batch.Delete(doc.Ref)
+		if _, err := batch.Commit(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *firestoreStore) ListRatings(ctx context.Context, riderUID string) ([]model.Rating, error) {
+	var ratings []model.Rating
+	iter := s.client.Collection("riders").Doc(riderUID).Collection("ratings").OrderBy("createdAt", firestore.Desc).Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var rating model.Rating
+		if err := doc.DataTo(&rating); err != nil {
+			return nil, err
+		}
+		rating.ID = doc.Ref.ID
+		ratings = append(ratings, rating)
+	}
+	return ratings, nil
+}
+
+// --- deliveries ---
+
+func (s *firestoreStore) CreateDelivery(ctx context.Context, delivery model.Delivery, change model.StatusChange) (string, error) {
+	ref := s.client.Collection("deliveries").NewDoc()
+	batch := s.client.Batch()
+	batch.Create(ref, delivery)
+	batch.Create(ref.Collection("statusHistory").NewDoc(), change)
+	if _, err := batch.Commit(ctx); err != nil {
+		return "", err
+	}
+	return ref.ID, nil
+}
+
+func (s *firestoreStore) GetDelivery(ctx context.Context, id string) (*model.Delivery, error) {
+	doc, err := s.client.Collection("deliveries").Doc(id).Get(ctx)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return deliveryFromDoc(doc)
+}
+
+func (s *firestoreStore) ListDeliveries(ctx context.Context, filter DeliveryFilter) ([]model.Delivery, error) {
+	query := s.client.Collection("deliveries").Query
+	if filter.SenderUID != "" {
+		query = query.Where("senderUID", "==", filter.SenderUID)
+	}
+	if filter.ReceiverUID != "" {
+		query = query.Where("receiverUID", "==", filter.ReceiverUID)
+	}
+	if filter.RiderUID != "" {
+		query = query.Where("riderUID", "==", filter.RiderUID)
+	}
+	if len(filter.Statuses) == 1 {
+		query = query.Where("status", "==", filter.Statuses[0])
+	} else if len(filter.Statuses) > 1 {
+		query = query.Where("status", "in", filter.Statuses)
+	}
+	if filter.SenderGeohashStart != "" {
+		// ต้องมี composite index (status, senderGeohash) ใน Firestore
+		query = query.OrderBy("senderGeohash", firestore.Asc).StartAt(filter.SenderGeohashStart).EndAt(filter.SenderGeohashEnd)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	var deliveries []model.Delivery
+	iter := query.Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		delivery, err := deliveryFromDoc(doc)
+		if err != nil {
+			continue // ข้ามเอกสารที่มีปัญหา
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+	return deliveries, nil
+}
+
+func (s *firestoreStore) UpdateDelivery(ctx context.Context, id string, fn func(delivery *model.Delivery) (*DeliveryWrite, error)) error {
+	ref := s.client.Collection("deliveries").Doc(id)
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref) // อ่านข้อมูลล่าสุดภายใน Transaction
+		if err != nil {
+			return notFound(err)
+		}
+		delivery, err := deliveryFromDoc(doc)
+		if err != nil {
+			return err
+		}
+		write, err := fn(delivery)
+		if err != nil {
+			return err
+		}
+		if write == nil {
+			write = &DeliveryWrite{}
+		}
+
+		// อ่านทั้งหมดให้เสร็จก่อนเขียน (ข้อกำหนดของ Transaction ใน Firestore)
+		var creditRef *firestore.DocumentRef
+		if write.Credit != nil {
+			creditRef = s.ledger(write.Credit.RiderUID).Doc(write.Credit.ID)
+			if _, err := tx.Get(creditRef); err == nil {
+				creditRef = nil // บันทึกไปแล้ว
+			} else if status.Code(err) != codes.NotFound {
+				return err
+			}
+		}
+		var riderRef *firestore.DocumentRef
+		var riderUpdates []firestore.Update
+		if release := write.Release; release != nil {
+			riderRef = s.client.Collection("riders").Doc(release.RiderUID)
+			riderDoc, err := tx.Get(riderRef)
+			if err != nil && status.Code(err) != codes.NotFound {
+				return err
+			}
+			if err == nil {
+				var rider model.Rider
+				if err := riderDoc.DataTo(&rider); err != nil {
+					return err
+				}
+				flagged := rider.RecordRelease(time.Now(), release.FlagAt)
+				riderUpdates = []firestore.Update{
+					{Path: "releaseCount", Value: rider.ReleaseCount},
+					{Path: "lastReleasedAt", Value: *rider.LastReleasedAt},
+				}
+				if flagged {
+					riderUpdates = append(riderUpdates, firestore.Update{Path: "releaseFlaggedAt", Value: *rider.ReleaseFlaggedAt})
+				}
+			}
+		}
+
+		if err := tx.Set(ref, delivery); err != nil {
+			return err
+		}
+		if write.Change != nil {
+			if err := tx.Create(ref.Collection("statusHistory").NewDoc(), write.Change); err != nil {
+				return err
+			}
+		}
+		if creditRef != nil {
+			if err := tx.Create(creditRef, *write.Credit); err != nil {
+				return err
+			}
+		}
+		if len(riderUpdates) > 0 {
+			return tx.Update(riderRef, riderUpdates)
+		}
+		return nil
+	})
+}
+
+func (s *firestoreStore) ListStatusHistory(ctx context.Context, id string) ([]model.StatusChange, error) {
+	var history []model.StatusChange
+	iter := s.client.Collection("deliveries").Doc(id).Collection("statusHistory").OrderBy("at", firestore.Asc).Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var change model.StatusChange
+		if err := doc.DataTo(&change); err != nil {
+			continue // ข้ามเอกสารที่มีปัญหา
+		}
+		change.ID = doc.Ref.ID
+		history = append(history, change)
+	}
+	return history, nil
+}
+
+func (s *firestoreStore) AnonymizeStatusHistory(ctx context.Context, id, uid, alias string) error {
+	docs, err := s.client.Collection("deliveries").Doc(id).Collection("statusHistory").Where("actorUID", "==", uid).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if _, err := doc.Ref.Update(ctx, []firestore.Update{{Path: "actorUID", Value: alias}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// --- notifications ---
+
+func (s *firestoreStore) AddNotification(ctx context.Context, uid string, notification model.Notification) error {
+	_, _, err := s.client.Collection("users").Doc(uid).Collection("notifications").Add(ctx, notification)
+	return err
+}
+
+func (s *firestoreStore) ListNotifications(ctx context.Context, uid string) ([]model.Notification, error) {
+	var notifications []model.Notification
+	iter := s.client.Collection("users").Doc(uid).Collection("notifications").OrderBy("createdAt", firestore.Desc).Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var notification model.Notification
+		if err := doc.DataTo(&notification); err != nil {
+			continue // ข้ามเอกสารที่มีปัญหา
+		}
+		notification.ID = doc.Ref.ID
+		notifications = append(notifications, notification)
+	}
+	return notifications, nil
+}
+
+func deliveryFromDoc(doc *firestore.DocumentSnapshot) (*model.Delivery, error) {
+	var delivery model.Delivery
+	if err := doc.DataTo(&delivery); err != nil {
+		return nil, err
+	}
+	delivery.ID = doc.Ref.ID
+	return &delivery, nil
+}
+
+// --- ledger ---
+
+// ledger คือ sub-collection "ledger" ของไรเดอร์
+func (s *firestoreStore) ledger(riderUID string) *firestore.CollectionRef {
+	return s.client.Collection("riders").Doc(riderUID).Collection("ledger")
+}
+
+func (s *firestoreStore) AddLedgerEntry(ctx context.Context, entry model.LedgerEntry) (string, error) {
+	ledger := s.ledger(entry.RiderUID)
+	ref := ledger.NewDoc()
+	if entry.ID != "" {
+		ref = ledger.Doc(entry.ID)
+	}
+	// ใช้ Create (ไม่ใช่ Set) เพื่อไม่ให้เขียนทับรายการเดิม
+	if _, err := ref.Create(ctx, entry); err != nil {
+		return "", alreadyExists(err)
+	}
+	return ref.ID, nil
+}
+
+func (s *firestoreStore) AddPayout(ctx context.Context, entry model.LedgerEntry) (int, error) {
+	ref := s.ledger(entry.RiderUID).Doc(entry.ID)
+	var balance int
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		// อ่านรายการทั้งหมดใน Transaction การจ่ายเงินพร้อมกันจึงหักยอดเดียวกันซ้ำไม่ได้
+		docs, err := tx.Documents(s.ledger(entry.RiderUID)).GetAll()
+		if err != nil {
+			return err
+		}
+		balance = 0
+		duplicate := false
+		for _, doc := range docs {
+			var existing model.LedgerEntry
+			if err := doc.DataTo(&existing); err != nil {
+				return err
+			}
+			balance += existing.Amount
+			duplicate = duplicate || doc.Ref.ID == entry.ID
+		}
+		if duplicate {
+			return ErrAlreadyExists
+		}
+		if balance+entry.Amount < 0 {
+			return ErrInsufficientBalance
+		}
+		return tx.Create(ref, entry)
+	})
+	return balance, alreadyExists(err)
+}
+
+// AnonymizeLedger ย้ายทีละรายการ (สร้างใต้ alias แล้วลบของเดิมใน batch เดียวกัน) ถ้าล้มเหลวกลางทางเรียกซ้ำได้
+func (s *firestoreStore) AnonymizeLedger(ctx context.Context, riderUID, alias string) error {
+	docs, err := s.ledger(riderUID).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		var entry model.LedgerEntry
+		if err := doc.DataTo(&entry); err != nil {
+			return err
+		}
+		entry.RiderUID = alias
+		batch := s.client.Batch()
+		batch.Set(s.ledger(alias).Doc(doc.Ref.ID), entry)
+		batch.Delete(doc.Ref)
+		if _, err := batch.Commit(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *firestoreStore) ListLedgerEntries(ctx context.Context, riderUID string, from, to time.Time) ([]model.LedgerEntry, error) {
+	query := s.ledger(riderUID).Query
+	if !from.IsZero() {
+		query = query.Where("createdAt", ">=", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("createdAt", "<", to)
+	}
+	iter := query.OrderBy("createdAt", firestore.Asc).Documents(ctx)
+	defer iter.Stop()
+
+	var entries []model.LedgerEntry
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var entry model.LedgerEntry
+		if err := doc.DataTo(&entry); err != nil {
+			return nil, err
+		}
+		entry.ID = doc.Ref.ID
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// --- phoneVerifications ---
+
+func (s *firestoreStore) UpdatePhoneVerification(ctx context.Context, purpose, phone string, fn func(v *model.PhoneVerification) error) error {
+	ref := s.client.Collection("phoneVerifications").Doc(VerificationID(purpose, phone))
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		v := model.PhoneVerification{Phone: phone, Purpose: purpose}
+		doc, err := tx.Get(ref)
+		if err == nil {
+			if err := doc.DataTo(&v); err != nil {
+				return err
+			}
+		} else if status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err := fn(&v); err != nil {
+			return err
+		}
+		return tx.Set(ref, v)
+	})
+}
+
+func (s *firestoreStore) DeletePhoneVerifications(ctx context.Context, phone string) error {
+	docs, err := s.client.Collection("phoneVerifications").Where("phone", "==", phone).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if _, err := doc.Ref.Delete(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// --- dataExports ---
+
+func (s *firestoreStore) CreateExport(ctx context.Context, export model.DataExport) (string, error) {
+	ref := s.client.Collection("dataExports").NewDoc()
+	if _, err := ref.Create(ctx, export); err != nil {
+		return "", err
+	}
+	return ref.ID, nil
+}
+
+func (s *firestoreStore) GetExport(ctx context.Context, id string) (*model.DataExport, error) {
+	doc, err := s.client.Collection("dataExports").Doc(id).Get(ctx)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	var export model.DataExport
+	if err := doc.DataTo(&export); err != nil {
+		return nil, err
+	}
+	export.ID = doc.Ref.ID
+	return &export, nil
+}
+
+func (s *firestoreStore) SaveExport(ctx context.Context, export model.DataExport) error {
+	_, err := s.client.Collection("dataExports").Doc(export.ID).Set(ctx, export)
+	return err
+}
+
+func (s *firestoreStore) ListExports(ctx context.Context, uid string) ([]model.DataExport, error) {
+	docs, err := s.client.Collection("dataExports").Where("uid", "==", uid).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	exports := make([]model.DataExport, 0, len(docs))
+	for _, doc := range docs {
+		var export model.DataExport
+		if err := doc.DataTo(&export); err != nil {
+			return nil, err
+		}
+		export.ID = doc.Ref.ID
+		exports = append(exports, export)
+	}
+	// เรียงในหน่วยความจำ เพื่อไม่ต้องสร้าง composite index (uid + createdAt)
+	sort.Slice(exports, func(i, j int) bool { return exports[i].CreatedAt.After(exports[j].CreatedAt) })
+	return exports, nil
+}
+
+func (s *firestoreStore) DeleteExport(ctx context.Context, id string) error {
+	_, err := s.client.Collection("dataExports").Doc(id).Delete(ctx)
+	return err
+}
@@ -0,0 +1,688 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"api-flash-dash/model"
+
+	latlng "google.golang.org/genproto/googleapis/type/latlng"
+)
+
+// memoryStore คือ implementation ที่เก็บข้อมูลทั้งหมดไว้ในหน่วยความจำ
+// ใช้สำหรับรัน API หรือทดสอบโดยไม่ต้องมีโปรเจกต์ Firebase (ข้อมูลจะหายเมื่อปิดเซิร์ฟเวอร์)
+type memoryStore struct {
+	mu         sync.Mutex
+	users      map[string]model.UserProfile
+	addresses  map[string]map[string]model.AddressPayload // uid -> addressID -> address
+	riders     map[string]model.Rider
+	deliveries map[string]model.Delivery
+	history    map[string][]model.StatusChange    // deliveryID -> statusHistory
+	notices    map[string][]model.Notification    // uid -> notifications
+	ratings    map[string][]model.Rating          // riderUID -> ratings (เก่าไปใหม่)
+	ledger     map[string][]model.LedgerEntry     // riderUID -> ledger (ตามลำดับที่บันทึก)
+	verify     map[string]model.PhoneVerification // VerificationID -> สถานะ OTP
+	exports    map[string]model.DataExport        // exportID -> งานส่งออกข้อมูล
+}
+
+// NewMemory สร้าง Store ที่เก็บข้อมูลไว้ในหน่วยความจำ
+func NewMemory() *Store {
+	s := &memoryStore{
+		users:      make(map[string]model.UserProfile),
+		addresses:  make(map[string]map[string]model.AddressPayload),
+		riders:     make(map[string]model.Rider),
+		deliveries: make(map[string]model.Delivery),
+		history:    make(map[string][]model.StatusChange),
+		notices:    make(map[string][]model.Notification),
+		ratings:    make(map[string][]model.Rating),
+		ledger:     make(map[string][]model.LedgerEntry),
+		verify:     make(map[string]model.PhoneVerification),
+		exports:    make(map[string]model.DataExport),
+	}
+	return &Store{
+		Users:         s,
+		Addresses:     s,
+		Riders:        s,
+		Deliveries:    s,
+		Notifications: s,
+		Ledger:        s,
+		Verifications: s,
+		Exports:       s,
+	}
+}
+
+// newID สร้าง ID แบบสุ่ม 20 ตัวอักษร เลียนแบบ Document ID ของ Firestore
+func newID() string {
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, 20)
+	rand.Read(b)
+	for i := range b {
+		b[i] = alphabet[int(b[i])%len(alphabet)]
+	}
+	return string(b)
+}
+
+// --- users ---
+
+func (s *memoryStore) CreateUser(ctx context.Context, uid string, user model.UserProfile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user.UID = uid
+	s.users[uid] = user
+	return nil
+}
+
+func (s *memoryStore) GetUser(ctx context.Context, uid string) (*model.UserProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[uid]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (s *memoryStore) FindUserByPhone(ctx context.Context, phone string) (*model.UserProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, uid := range sortedKeys(s.users) {
+		if user := s.users[uid]; user.Phone == phone {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) ListUsersByRole(ctx context.Context, role string) ([]model.UserProfile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var users []model.UserProfile
+	for _, uid := range sortedKeys(s.users) {
+		if user := s.users[uid]; role == "" || user.Role == role {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (s *memoryStore) UpdateUser(ctx context.Context, uid string, update UserUpdate) error {
+	if update.IsEmpty() {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[uid]
+	if !ok {
+		return ErrNotFound
+	}
+	s.users[uid] = applyUserUpdate(user, update)
+	return nil
+}
+
+func (s *memoryStore) DeleteUser(ctx context.Context, uid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.users, uid)
+	delete(s.addresses, uid)
+	delete(s.notices, uid)
+	return nil
+}
+
+func applyUserUpdate(user model.UserProfile, update UserUpdate) model.UserProfile {
+	if update.Name != nil {
+		user.Name = *update.Name
+	}
+	if update.ImageProfile != nil {
+		user.ImageProfile = *update.ImageProfile
+	}
+	if update.Role != nil {
+		user.Role = *update.Role
+	}
+	if update.Status != nil {
+		user.Status = *update.Status
+	}
+	if update.SuspendedReason != nil {
+		user.SuspendedReason = *update.SuspendedReason
+	}
+	if update.SuspendedAt != nil {
+		suspendedAt := *update.SuspendedAt
+		user.SuspendedAt = &suspendedAt
+	}
+	return user
+}
+
+// --- addresses ---
+
+func (s *memoryStore) AddAddress(ctx context.Context, uid string, address model.AddressPayload) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.addresses[uid]) == 0 {
+		address.IsDefault = true
+	}
+	id := newID()
+	s.putAddress(uid, id, address)
+	return id, nil
+}
+
+func (s *memoryStore) SetAddress(ctx context.Context, uid, addressID string, address model.AddressPayload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.putAddress(uid, addressID, address)
+	return nil
+}
+
+// putAddress เขียนที่อยู่ และยกเลิกที่อยู่หลักเดิมถ้าที่อยู่นี้เป็นที่อยู่หลัก
+// ต้องถูกเรียกขณะถือ s.mu อยู่แล้ว
+func (s *memoryStore) putAddress(uid, addressID string, address model.AddressPayload) {
+	if s.addresses[uid] == nil {
+		s.addresses[uid] = make(map[string]model.AddressPayload)
+	}
+	if address.IsDefault {
+		for id, other := range s.addresses[uid] {
+			if other.IsDefault && id != addressID {
+				other.IsDefault = false
+				s.addresses[uid][id] = other
+			}
+		}
+	}
+	s.addresses[uid][addressID] = address
+}
+
+func (s *memoryStore) GetAddress(ctx context.Context, uid, addressID string) (*model.Address, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payload, ok := s.addresses[uid][addressID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	address := addressFromPayload(addressID, payload)
+	return &address, nil
+}
+
+func (s *memoryStore) ListAddresses(ctx context.Context, uid string) ([]model.Address, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var addresses []model.Address
+	for _, id := range sortedKeys(s.addresses[uid]) {
+		addresses = append(addresses, addressFromPayload(id, s.addresses[uid][id]))
+	}
+	return addresses, nil
+}
+
+func (s *memoryStore) DeleteAddress(ctx context.Context, uid, addressID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	address, ok := s.addresses[uid][addressID]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(s.addresses[uid], addressID)
+	if address.IsDefault {
+		if ids := sortedKeys(s.addresses[uid]); len(ids) > 0 {
+			next := s.addresses[uid][ids[0]]
+			next.IsDefault = true
+			s.addresses[uid][ids[0]] = next
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) SetDefaultAddress(ctx context.Context, uid, addressID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.addresses[uid][addressID]; !ok {
+		return ErrNotFound
+	}
+	for id, address := range s.addresses[uid] {
+		address.IsDefault = id == addressID
+		s.addresses[uid][id] = address
+	}
+	return nil
+}
+
+func addressFromPayload(id string, payload model.AddressPayload) model.Address {
+	return model.Address{
+		ID:           id,
+		Detail:       payload.Detail,
+		Coordinates:  payload.Coordinates,
+		Label:        payload.Label,
+		IsDefault:    payload.IsDefault,
+		ContactName:  payload.ContactName,
+		ContactPhone: payload.ContactPhone,
+		AccessNotes:  payload.AccessNotes,
+		Geocode:      payload.Geocode,
+	}
+}
+
+// --- riders ---
+
+func (s *memoryStore) CreateRider(ctx context.Context, uid string, rider model.Rider) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.riders[uid] = rider
+	return nil
+}
+
+func (s *memoryStore) GetRider(ctx context.Context, uid string) (*model.Rider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rider, ok := s.riders[uid]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &rider, nil
+}
+
+func (s *memoryStore) UpdateRiderProfile(ctx context.Context, uid string, user UserUpdate, rider RiderUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// ตรวจสอบก่อนว่ามีเอกสารครบ เพื่อให้ทำงานแบบ all-or-nothing เหมือน batch
+	currentUser, ok := s.users[uid]
+	if !user.IsEmpty() && !ok {
+		return ErrNotFound
+	}
+	currentRider, ok := s.riders[uid]
+	if !rider.IsEmpty() && !ok {
+		return ErrNotFound
+	}
+
+	if !user.IsEmpty() {
+		s.users[uid] = applyUserUpdate(currentUser, user)
+	}
+	if !rider.IsEmpty() {
+		currentRider.ApplyVehicleUpdate(rider.ImageVehicle, rider.VehicleRegistration, time.Now())
+		s.riders[uid] = currentRider
+	}
+	return nil
+}
+
+func (s *memoryStore) UpdateRiderLocation(ctx context.Context, uid string, latitude, longitude float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	rider := s.riders[uid]
+	rider.CurrentLocation = &latlng.LatLng{Latitude: latitude, Longitude: longitude}
+	rider.UpdatedAt = &now
+	s.riders[uid] = rider
+	return nil
+}
+
+func (s *memoryStore) AddRating(ctx context.Context, rating model.Rating) (*model.Rider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rider, ok := s.riders[rating.RiderUID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	rating.ID = RatingID(rating.DeliveryID, rating.RaterUID)
+	for _, existing := range s.ratings[rating.RiderUID] {
+		if existing.ID == rating.ID {
+			return nil, ErrAlreadyExists
+		}
+	}
+	rider.AddRating(rating.Score)
+	s.riders[rating.RiderUID] = rider
+	s.ratings[rating.RiderUID] = append(s.ratings[rating.RiderUID], rating)
+	return &rider, nil
+}
+
+func (s *memoryStore) UpdateRider(ctx context.Context, uid string, fn func(rider *model.Rider) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rider, ok := s.riders[uid]
+	if !ok {
+		return ErrNotFound
+	}
+	// แก้ไขบนสำเนา ถ้า fn ล้มเหลวข้อมูลเดิมจะไม่ถูกแตะต้อง
+	if err := fn(&rider); err != nil {
+		return err
+	}
+	s.riders[uid] = rider
+	return nil
+}
+
+func (s *memoryStore) ListRidersByVerificationStatus(ctx context.Context, status string) (map[string]model.Rider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	riders := make(map[string]model.Rider)
+	for uid, rider := range s.riders {
+		if rider.VerificationStatus == status {
+			riders[uid] = rider
+		}
+	}
+	return riders, nil
+}
+
+func (s *memoryStore) ListRatings(ctx context.Context, riderUID string) ([]model.Rating, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ratings []model.Rating
+	for i := len(s.ratings[riderUID]) - 1; i >= 0; i-- {
+		ratings = append(ratings, s.ratings[riderUID][i])
+	}
+	return ratings, nil
+}
+
+func (s *memoryStore) DeleteRider(ctx context.Context, uid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.riders, uid)
+	delete(s.ratings, uid)
+	return nil
+}
+
+func (s *memoryStore) AnonymizeRatingsBy(ctx context.Context, raterUID, alias string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for riderUID, ratings := range s.ratings {
+		for i, rating := range ratings {
+			if rating.RaterUID == raterUID {
+				rating.RaterUID = alias
+				rating.ID = RatingID(rating.DeliveryID, alias)
+				s.ratings[riderUID][i] = rating
+			}
+		}
+	}
+	return nil
+}
+
+// --- deliveries ---
+
+func (s *memoryStore) CreateDelivery(ctx context.Context, delivery model.Delivery, change model.StatusChange) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delivery.ID = newID()
+	s.deliveries[delivery.ID] = delivery
+	s.appendHistory(delivery.ID, change)
+	return delivery.ID, nil
+}
+
+func (s *memoryStore) GetDelivery(ctx context.Context, id string) (*model.Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &delivery, nil
+}
+
+func (s *memoryStore) ListDeliveries(ctx context.Context, filter DeliveryFilter) ([]model.Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deliveries []model.Delivery
+	for _, id := range sortedKeys(s.deliveries) {
+		delivery := s.deliveries[id]
+		if !matchDelivery(delivery, filter) {
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+		if filter.Limit > 0 && len(deliveries) == filter.Limit {
+			break
+		}
+	}
+	return deliveries, nil
+}
+
+func (s *memoryStore) UpdateDelivery(ctx context.Context, id string, fn func(delivery *model.Delivery) (*DeliveryWrite, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return ErrNotFound
+	}
+	// แก้ไขบนสำเนา ถ้า fn ล้มเหลวข้อมูลเดิมจะไม่ถูกแตะต้อง
+	write, err := fn(&delivery)
+	if err != nil {
+		return err
+	}
+	delivery.ID = id
+	s.deliveries[id] = delivery
+	if write == nil {
+		return nil
+	}
+	if write.Change != nil {
+		s.appendHistory(id, *write.Change)
+	}
+	if write.Credit != nil {
+		s.appendLedger(*write.Credit) // มีรายการนี้อยู่แล้วก็ข้ามไป
+	}
+	if release := write.Release; release != nil {
+		if rider, ok := s.riders[release.RiderUID]; ok {
+			rider.RecordRelease(time.Now(), release.FlagAt)
+			s.riders[release.RiderUID] = rider
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) ListStatusHistory(ctx context.Context, id string) ([]model.StatusChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]model.StatusChange(nil), s.history[id]...), nil
+}
+
+func (s *memoryStore) AnonymizeStatusHistory(ctx context.Context, id, uid, alias string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, change := range s.history[id] {
+		if change.ActorUID == uid {
+			s.history[id][i].ActorUID = alias
+		}
+	}
+	return nil
+}
+
+// appendHistory ต้องถูกเรียกขณะถือ s.mu อยู่แล้ว
+func (s *memoryStore) appendHistory(id string, change model.StatusChange) {
+	change.ID = newID()
+	s.history[id] = append(s.history[id], change)
+}
+
+// --- notifications ---
+
+func (s *memoryStore) AddNotification(ctx context.Context, uid string, notification model.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	notification.ID = newID()
+	s.notices[uid] = append(s.notices[uid], notification)
+	return nil
+}
+
+func (s *memoryStore) ListNotifications(ctx context.Context, uid string) ([]model.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// เก็บไว้เรียงจากเก่าไปใหม่ จึงต้องกลับลำดับก่อนส่งออก
+	var notifications []model.Notification
+	for i := len(s.notices[uid]) - 1; i >= 0; i-- {
+		notifications = append(notifications, s.notices[uid][i])
+	}
+	return notifications, nil
+}
+
+// --- ledger ---
+
+func (s *memoryStore) AddLedgerEntry(ctx context.Context, entry model.LedgerEntry) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry.ID == "" {
+		entry.ID = newID()
+	}
+	return entry.ID, s.appendLedger(entry)
+}
+
+func (s *memoryStore) AddPayout(ctx context.Context, entry model.LedgerEntry) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	balance, duplicate := 0, false
+	for _, existing := range s.ledger[entry.RiderUID] {
+		balance += existing.Amount
+		duplicate = duplicate || existing.ID == entry.ID
+	}
+	if duplicate {
+		return balance, ErrAlreadyExists
+	}
+	if balance+entry.Amount < 0 {
+		return balance, ErrInsufficientBalance
+	}
+	return balance, s.appendLedger(entry)
+}
+
+func (s *memoryStore) AnonymizeLedger(ctx context.Context, riderUID, alias string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.ledger[riderUID] {
+		entry.RiderUID = alias
+		s.ledger[alias] = append(s.ledger[alias], entry)
+	}
+	delete(s.ledger, riderUID)
+	return nil
+}
+
+// appendLedger เพิ่มรายการลงบัญชี (คืนค่า ErrAlreadyExists ถ้ามีรายการ ID นี้อยู่แล้ว)
+// ต้องถูกเรียกขณะถือ s.mu อยู่แล้ว
+func (s *memoryStore) appendLedger(entry model.LedgerEntry) error {
+	for _, existing := range s.ledger[entry.RiderUID] {
+		if existing.ID == entry.ID {
+			return ErrAlreadyExists
+		}
+	}
+	s.ledger[entry.RiderUID] = append(s.ledger[entry.RiderUID], entry)
+	return nil
+}
+
+func (s *memoryStore) ListLedgerEntries(ctx context.Context, riderUID string, from, to time.Time) ([]model.LedgerEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var entries []model.LedgerEntry
+	for _, entry := range s.ledger[riderUID] {
+		if !from.IsZero() && entry.CreatedAt.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !entry.CreatedAt.Before(to) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+	return entries, nil
+}
+
+func matchDelivery(delivery model.Delivery, filter DeliveryFilter) bool {
+	if filter.SenderUID != "" && delivery.SenderUID != filter.SenderUID {
+		return false
+	}
+	if filter.ReceiverUID != "" && delivery.ReceiverUID != filter.ReceiverUID {
+		return false
+	}
+	if filter.RiderUID != "" && (delivery.RiderUID == nil || *delivery.RiderUID != filter.RiderUID) {
+		return false
+	}
+	if filter.SenderGeohashStart != "" &&
+		(delivery.SenderGeohash < filter.SenderGeohashStart || delivery.SenderGeohash > filter.SenderGeohashEnd) {
+		return false
+	}
+	if len(filter.Statuses) > 0 {
+		for _, status := range filter.Statuses {
+			if delivery.Status == status {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// sortedKeys คืนค่า key ของ map แบบเรียงลำดับ เพื่อให้ผลลัพธ์คงที่ทุกครั้ง
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// --- phoneVerifications ---
+
+func (s *memoryStore) UpdatePhoneVerification(ctx context.Context, purpose, phone string, fn func(v *model.PhoneVerification) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := VerificationID(purpose, phone)
+	v, ok := s.verify[id]
+	if !ok {
+		v = model.PhoneVerification{Phone: phone, Purpose: purpose}
+	}
+	if err := fn(&v); err != nil {
+		return err
+	}
+	s.verify[id] = v
+	return nil
+}
+
+func (s *memoryStore) DeletePhoneVerifications(ctx context.Context, phone string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, v := range s.verify {
+		if v.Phone == phone {
+			delete(s.verify, id)
+		}
+	}
+	return nil
+}
+
+// --- dataExports ---
+
+func (s *memoryStore) CreateExport(ctx context.Context, export model.DataExport) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	export.ID = newID()
+	s.exports[export.ID] = export
+	return export.ID, nil
+}
+
+func (s *memoryStore) GetExport(ctx context.Context, id string) (*model.DataExport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	export, ok := s.exports[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &export, nil
+}
+
+func (s *memoryStore) SaveExport(ctx context.Context, export model.DataExport) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.exports[export.ID]; !ok {
+		return ErrNotFound
+	}
+	s.exports[export.ID] = export
+	return nil
+}
+
+func (s *memoryStore) ListExports(ctx context.Context, uid string) ([]model.DataExport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var exports []model.DataExport
+	for _, export := range s.exports {
+		if export.UID == uid {
+			exports = append(exports, export)
+		}
+	}
+	sort.Slice(exports, func(i, j int) bool { return exports[i].CreatedAt.After(exports[j].CreatedAt) })
+	return exports, nil
+}
+
+func (s *memoryStore) DeleteExport(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.exports, id)
+	return nil
+}
@@ -0,0 +1,211 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"api-flash-dash/model"
+)
+
+// ErrNotFound ถูกส่งกลับเมื่อไม่พบเอกสารที่ต้องการ (ไม่ว่าจะใช้ backend แบบไหน)
+var ErrNotFound = errors.New("document not found")
+
+// ErrAlreadyExists ถูกส่งกลับเมื่อสร้างเอกสารที่มีอยู่แล้ว
+var ErrAlreadyExists = errors.New("document already exists")
+
+// ErrInsufficientBalance ถูกส่งกลับเมื่อรายการจ่ายเงินทำให้ยอดคงเหลือของไรเดอร์ติดลบ
+var ErrInsufficientBalance = errors.New("insufficient balance")
+
+// UserStore จัดการข้อมูลใน collection "users"
+type UserStore interface {
+	CreateUser(ctx context.Context, uid string, user model.UserProfile) error
+	GetUser(ctx context.Context, uid string) (*model.UserProfile, error)
+	FindUserByPhone(ctx context.Context, phone string) (*model.UserProfile, error)
+	// ListUsersByRole ดึงผู้ใช้ตามบทบาท (role ว่าง = ผู้ใช้ทั้งหมด)
+	ListUsersByRole(ctx context.Context, role string) ([]model.UserProfile, error)
+	UpdateUser(ctx context.Context, uid string, update UserUpdate) error
+	// DeleteUser ลบ "users/{uid}" พร้อม sub-collection ทั้งหมด (addresses, notifications)
+	// ไม่มีเอกสารอยู่แล้วไม่ถือว่าผิดพลาด (เรียกซ้ำได้)
+	DeleteUser(ctx context.Context, uid string) error
+}
+
+// AddressStore จัดการ sub-collection "addresses" ของผู้ใช้แต่ละคน
+type AddressStore interface {
+	// AddAddress เพิ่มที่อยู่ใหม่ ที่อยู่แรกของผู้ใช้เป็นที่อยู่หลักเสมอ
+	// ถ้า address.IsDefault ที่อยู่หลักเดิมจะถูกยกเลิกใน Transaction เดียวกัน
+	AddAddress(ctx context.Context, uid string, address model.AddressPayload) (string, error)
+	// SetAddress เขียนทับที่อยู่ทั้งหมด ถ้า address.IsDefault ที่อยู่หลักเดิมจะถูกยกเลิกใน Transaction เดียวกัน
+	SetAddress(ctx context.Context, uid, addressID string, address model.AddressPayload) error
+	GetAddress(ctx context.Context, uid, addressID string) (*model.Address, error)
+	ListAddresses(ctx context.Context, uid string) ([]model.Address, error)
+	// DeleteAddress ลบที่อยู่ (คืนค่า ErrNotFound ถ้าไม่มี) ถ้าเป็นที่อยู่หลัก ที่อยู่ที่เหลือตัวแรกจะเป็นที่อยู่หลักแทน
+	// delivery ที่สร้างไปแล้วไม่ได้รับผลกระทบ เพราะเก็บสำเนาของที่อยู่ไว้เอง
+	DeleteAddress(ctx context.Context, uid, addressID string) error
+	// SetDefaultAddress ตั้งที่อยู่นี้เป็นที่อยู่หลัก และยกเลิกที่อยู่หลักเดิมใน Transaction เดียวกัน
+	SetDefaultAddress(ctx context.Context, uid, addressID string) error
+}
+
+// RiderStore จัดการข้อมูลใน collection "riders"
+type RiderStore interface {
+	CreateRider(ctx context.Context, uid string, rider model.Rider) error
+	GetRider(ctx context.Context, uid string) (*model.Rider, error)
+	// UpdateRiderProfile อัปเดตทั้ง "users" และ "riders" ในครั้งเดียว (Transaction)
+	// ไรเดอร์ที่ผ่านการตรวจสอบแล้วเปลี่ยนข้อมูลรถ จะกลับไปรอตรวจสอบใหม่ในการเขียนเดียวกัน (ดู model.Rider.ApplyVehicleUpdate)
+	UpdateRiderProfile(ctx context.Context, uid string, user UserUpdate, rider RiderUpdate) error
+	UpdateRiderLocation(ctx context.Context, uid string, latitude, longitude float64) error
+	// AddRating บันทึกรีวิวและอัปเดตคะแนนเฉลี่ยของไรเดอร์ใน Transaction เดียวกัน
+	// คืนค่า ErrAlreadyExists ถ้าผู้ให้คะแนนเคยรีวิว delivery นี้ไปแล้ว
+	AddRating(ctx context.Context, rating model.Rating) (*model.Rider, error)
+	// ListRatings ดึงรีวิวทั้งหมดของไรเดอร์ เรียงจากใหม่ไปเก่า
+	ListRatings(ctx context.Context, riderUID string) ([]model.Rating, error)
+	// UpdateRider อ่าน-แก้ไข-เขียนข้อมูลไรเดอร์ภายใน Transaction
+	// ถ้า fn คืนค่า error จะไม่มีการเขียนข้อมูลใดๆ และ error นั้นจะถูกส่งกลับไปตรงๆ
+	UpdateRider(ctx context.Context, uid string, fn func(rider *model.Rider) error) error
+	// ListRidersByVerificationStatus ดึงไรเดอร์ตามสถานะการตรวจสอบเอกสาร (คืนค่าเป็น uid -> rider)
+	ListRidersByVerificationStatus(ctx context.Context, status string) (map[string]model.Rider, error)
+	// DeleteRider ลบ "riders/{uid}" พร้อมรีวิว (ratings) เรียกซ้ำได้
+	// ไม่ลบบัญชีรายได้ (ledger) ต้องย้ายไปไว้ใต้ alias ด้วย LedgerStore.AnonymizeLedger ก่อน
+	DeleteRider(ctx context.Context, uid string) error
+	// AnonymizeRatingsBy เปลี่ยน raterUID ในรีวิวทั้งหมดที่ผู้ใช้คนนี้เคยให้ไรเดอร์คนอื่นเป็น alias
+	AnonymizeRatingsBy(ctx context.Context, raterUID, alias string) error
+}
+
+// RatingID คือ ID ของรีวิว 1 รายการ (ผู้ให้คะแนน 1 คนต่อ 1 delivery)
+func RatingID(deliveryID, raterUID string) string {
+	return deliveryID + "_" + raterUID
+}
+
+// DeliveryStore จัดการข้อมูลใน collection "deliveries"
+type DeliveryStore interface {
+	// CreateDelivery สร้าง delivery พร้อมบันทึกประวัติรายการแรกลง "statusHistory"
+	CreateDelivery(ctx context.Context, delivery model.Delivery, change model.StatusChange) (string, error)
+	GetDelivery(ctx context.Context, id string) (*model.Delivery, error)
+	ListDeliveries(ctx context.Context, filter DeliveryFilter) ([]model.Delivery, error)
+	// UpdateDelivery อ่าน-แก้ไข-เขียน delivery ภายใน Transaction
+	// ถ้า fn คืนค่า DeliveryWrite กลับมา ข้อมูลในนั้นจะถูกบันทึกใน Transaction เดียวกัน
+	// ถ้า fn คืนค่า error จะไม่มีการเขียนข้อมูลใดๆ และ error นั้นจะถูกส่งกลับไปตรงๆ
+	UpdateDelivery(ctx context.Context, id string, fn func(delivery *model.Delivery) (*DeliveryWrite, error)) error
+	// ListStatusHistory ดึงประวัติการเปลี่ยนสถานะทั้งหมด เรียงจากเก่าไปใหม่
+	ListStatusHistory(ctx context.Context, id string) ([]model.StatusChange, error)
+	// AnonymizeStatusHistory เปลี่ยน actorUID ที่เป็น uid ในประวัติสถานะของ delivery เป็น alias
+	AnonymizeStatusHistory(ctx context.Context, id, uid, alias string) error
+}
+
+// NotificationStore จัดการ sub-collection "notifications" ของผู้ใช้แต่ละคน
+type NotificationStore interface {
+	AddNotification(ctx context.Context, uid string, notification model.Notification) error
+	// ListNotifications ดึงการแจ้งเตือนทั้งหมด เรียงจากใหม่ไปเก่า
+	ListNotifications(ctx context.Context, uid string) ([]model.Notification, error)
+}
+
+// LedgerStore จัดการบัญชีรายได้ของไรเดอร์ (sub-collection "ledger" ของ riders/{uid})
+// รายการเพิ่มได้อย่างเดียว ไม่มีการแก้ไขหรือลบ
+type LedgerStore interface {
+	// AddLedgerEntry เพิ่มรายการใหม่ ถ้า entry.ID ไม่ว่างจะใช้เป็น ID ของเอกสาร
+	// และคืนค่า ErrAlreadyExists ถ้ามีรายการ ID นี้อยู่แล้ว (ป้องกันการบันทึกซ้ำ)
+	AddLedgerEntry(ctx context.Context, entry model.LedgerEntry) (string, error)
+	// ListLedgerEntries ดึงรายการในช่วง [from, to) เรียงจากเก่าไปใหม่ (ค่า zero = ไม่จำกัดขอบเขต)
+	ListLedgerEntries(ctx context.Context, riderUID string, from, to time.Time) ([]model.LedgerEntry, error)
+	// AddPayout บันทึกรายการจ่ายเงิน (entry.Amount ติดลบ และ entry.ID ต้องไม่ว่าง) ถ้ายอดคงเหลือพอ
+	// ตรวจยอดคงเหลือและบันทึกใน Transaction เดียวกัน คืนค่ายอดคงเหลือก่อนหัก
+	// คืนค่า ErrInsufficientBalance ถ้ายอดไม่พอ หรือ ErrAlreadyExists ถ้ามีรายการ ID นี้อยู่แล้ว (คำขอซ้ำ)
+	AddPayout(ctx context.Context, entry model.LedgerEntry) (int, error)
+	// AnonymizeLedger ย้ายรายการทั้งหมดของไรเดอร์ไปไว้ใต้ alias (เก็บเป็นหลักฐานทางบัญชีหลังลบบัญชี) เรียกซ้ำได้
+	AnonymizeLedger(ctx context.Context, riderUID, alias string) error
+}
+
+// VerificationStore จัดการสถานะการยืนยันเบอร์โทรด้วย OTP (collection "phoneVerifications")
+type VerificationStore interface {
+	// UpdatePhoneVerification อ่าน-แก้ไข-เขียนภายใน Transaction ถ้ายังไม่มีเอกสาร fn จะได้ค่าว่าง
+	// (Phone และ Purpose ถูกตั้งให้แล้ว) ถ้า fn คืนค่า error จะไม่มีการเขียนข้อมูลใดๆ
+	UpdatePhoneVerification(ctx context.Context, purpose, phone string, fn func(v *model.PhoneVerification) error) error
+	// DeletePhoneVerifications ลบสถานะ OTP ทุกจุดประสงค์ของเบอร์นี้
+	DeletePhoneVerifications(ctx context.Context, phone string) error
+}
+
+// VerificationID คือ ID ของเอกสารการยืนยันเบอร์โทร (1 เบอร์ต่อ 1 จุดประสงค์)
+func VerificationID(purpose, phone string) string {
+	return purpose + "_" + phone
+}
+
+// ExportStore จัดการสถานะของงานส่งออกข้อมูลส่วนบุคคล (collection "dataExports")
+type ExportStore interface {
+	CreateExport(ctx context.Context, export model.DataExport) (string, error)
+	GetExport(ctx context.Context, id string) (*model.DataExport, error)
+	// SaveExport เขียนทับเอกสารของงาน (งานเบื้องหลังเป็นผู้เขียนเพียงคนเดียวหลังสร้าง)
+	SaveExport(ctx context.Context, export model.DataExport) error
+	// ListExports ดึงงานทั้งหมดของผู้ใช้ เรียงจากใหม่ไปเก่า
+	ListExports(ctx context.Context, uid string) ([]model.DataExport, error)
+	// DeleteExport ลบเอกสารของงาน เรียกซ้ำได้
+	DeleteExport(ctx context.Context, id string) error
+}
+
+// Store รวม Store ทุกตัวไว้ด้วยกัน เพื่อให้ส่งต่อไปยัง Handler ได้สะดวก
+type Store struct {
+	Users         UserStore
+	Addresses     AddressStore
+	Riders        RiderStore
+	Deliveries    DeliveryStore
+	Notifications NotificationStore
+	Ledger        LedgerStore
+	Verifications VerificationStore
+	Exports       ExportStore
+}
+
+// DeliveryWrite คือข้อมูลที่ต้องบันทึกเพิ่มใน Transaction เดียวกับการแก้ไข delivery (ดู DeliveryStore.UpdateDelivery)
+type DeliveryWrite struct {
+	// Change ถูกบันทึกลง "statusHistory"
+	Change *model.StatusChange
+	// Credit คือรายการรายได้ของไรเดอร์ (ID ต้องไม่ว่าง ถ้ามีรายการ ID นี้อยู่แล้วจะข้ามไป)
+	Credit *model.LedgerEntry
+	// Release คือการคืนงานของไรเดอร์ที่ต้องนับลงเอกสาร "riders"
+	Release *RiderRelease
+}
+
+// RiderRelease คือการนับการคืนงานของไรเดอร์ (ดู model.Rider.RecordRelease)
+// ถ้าไม่มีเอกสารของไรเดอร์คนนี้จะข้ามไป ไม่ให้การคืนงานล้มเหลว
+type RiderRelease struct {
+	RiderUID string
+	FlagAt   int // จำนวนครั้งที่ถือว่าควรให้แอดมินตรวจสอบไรเดอร์
+}
+
+// UserUpdate คือฟิลด์ของ "users" ที่อัปเดตได้ (nil = ไม่เปลี่ยนแปลง)
+type UserUpdate struct {
+	Name         *string
+	ImageProfile *string
+	// ฟิลด์ที่แอดมินเท่านั้นที่เปลี่ยนได้
+	Role            *string
+	Status          *string
+	SuspendedReason *string
+	SuspendedAt     *time.Time
+}
+
+// IsEmpty บอกว่าไม่มีฟิลด์ไหนต้องอัปเดตเลย
+func (u UserUpdate) IsEmpty() bool {
+	return u.Name == nil && u.ImageProfile == nil && u.Role == nil &&
+		u.Status == nil && u.SuspendedReason == nil && u.SuspendedAt == nil
+}
+
+// RiderUpdate คือฟิลด์ของ "riders" ที่อัปเดตได้ (nil = ไม่เปลี่ยนแปลง)
+type RiderUpdate struct {
+	ImageVehicle        *string
+	VehicleRegistration *string
+}
+
+// IsEmpty บอกว่าไม่มีฟิลด์ไหนต้องอัปเดตเลย
+func (u RiderUpdate) IsEmpty() bool {
+	return u.ImageVehicle == nil && u.VehicleRegistration == nil
+}
+
+// DeliveryFilter คือเงื่อนไขการค้นหา delivery (ฟิลด์ที่เป็นค่าว่างจะไม่ถูกนำมาใช้กรอง)
+type DeliveryFilter struct {
+	SenderUID   string
+	ReceiverUID string
+	RiderUID    string
+	Statuses    []string
+	// ช่วงของ senderGeohash (ใช้ค้นหางานตามพื้นที่ ดู geo.QueryRanges)
+	SenderGeohashStart string
+	SenderGeohashEnd   string
+	Limit              int
+}